@@ -0,0 +1,234 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
+
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
+)
+
+// forceDetachOptions are command line options of the force-detach
+// subcommand.
+type forceDetachOptions struct {
+	subcommandOptions
+	volumeAttachment              string
+	node                          string
+	skipUnpublish                 bool
+	yes                           bool
+	storageClassPublishSecret     bool
+	defaultPublishSecretName      string
+	defaultPublishSecretNamespace string
+	auditLog                      string
+	auditLogMaxSize               int64
+	auditLogMaxBackups            int
+}
+
+// runForceDetach implements the force-detach subcommand. It detaches deleted
+// VolumeAttachments that the controller cannot detach, for example because
+// their node is gone, and removes their finalizer.
+func runForceDetach(args []string) error {
+	var opts forceDetachOptions
+	fs := newSubcommandFlagSet("force-detach", "Calls ControllerUnpublish of deleted VolumeAttachments and removes their finalizer.", &opts.subcommandOptions)
+	fs.StringVar(&opts.volumeAttachment, "volumeattachment", "", "Name of the VolumeAttachment to detach.")
+	fs.StringVar(&opts.node, "node", "", "Name of the node. All deleted VolumeAttachments of the driver on the node are detached.")
+	fs.BoolVar(&opts.skipUnpublish, "skip-unpublish", false, "Do not call ControllerUnpublish, only remove the finalizer. The volumes may stay attached in the storage backend.")
+	fs.BoolVar(&opts.yes, "yes", false, "Do not ask for confirmation.")
+	fs.BoolVar(&opts.storageClassPublishSecret, "storage-class-publish-secret", false, "The same as the option of the external-attacher.")
+	fs.StringVar(&opts.defaultPublishSecretName, "default-publish-secret-name", "", "The same as the option of the external-attacher.")
+	fs.StringVar(&opts.defaultPublishSecretNamespace, "default-publish-secret-namespace", "", "The same as the option of the external-attacher.")
+	fs.StringVar(&opts.auditLog, "audit-log", "", "Path to a file to which every ControllerUnpublishVolume call is recorded as a JSON line, in the same format as the audit log of the external-attacher. \"-\" writes the records to stdout. The audit log is disabled when empty.")
+	fs.Int64Var(&opts.auditLogMaxSize, "audit-log-max-size", 100, "The same as the option of the external-attacher.")
+	fs.IntVar(&opts.auditLogMaxBackups, "audit-log-max-backups", 5, "The same as the option of the external-attacher.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if (opts.volumeAttachment == "") == (opts.node == "") {
+		return fmt.Errorf("exactly one of -volumeattachment and -node must be set")
+	}
+	if opts.csiAddress == "" && !opts.skipUnpublish {
+		return fmt.Errorf("-csi-address is required to call ControllerUnpublish")
+	}
+	if (opts.defaultPublishSecretName == "") != (opts.defaultPublishSecretNamespace == "") {
+		return fmt.Errorf("-default-publish-secret-name and -default-publish-secret-namespace must be set together")
+	}
+	if opts.auditLogMaxSize < 0 || opts.auditLogMaxBackups < 0 {
+		return fmt.Errorf("-audit-log-max-size and -audit-log-max-backups must not be negative")
+	}
+	if opts.auditLogMaxSize > 0 && opts.auditLogMaxBackups == 0 {
+		return fmt.Errorf("-audit-log-max-backups must be at least 1 when -audit-log-max-size is set")
+	}
+	return forceDetach(opts, os.Stdin, os.Stdout)
+}
+
+func forceDetach(opts forceDetachOptions, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	env, err := newSubcommandEnv(ctx, opts.subcommandOptions)
+	if err != nil {
+		return err
+	}
+	defer env.close()
+
+	var volAttacher attacher.Attacher
+	if env.csiConn != nil {
+		volAttacher = attacher.NewAttacher(env.csiConn)
+		if opts.auditLog != "" {
+			auditWriter, err := openAuditLog(opts.auditLog, opts.auditLogMaxSize, opts.auditLogMaxBackups)
+			if err != nil {
+				return fmt.Errorf("failed to open audit log %s: %w", opts.auditLog, err)
+			}
+			if f, ok := auditWriter.(*attacher.RotatingFile); ok {
+				defer f.Close()
+			}
+			replica, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("failed to get hostname for the audit log: %w", err)
+			}
+			volAttacher = attacher.NewAuditAttacher(volAttacher, auditWriter, attacher.AuditOptions{
+				Driver:  env.driverName,
+				Replica: replica,
+			})
+		}
+	}
+	var scInformer storageinformers.StorageClassInformer
+	if opts.storageClassPublishSecret {
+		scInformer = env.factory.Storage().V1().StorageClasses()
+	}
+	var defaultSecretRef *v1.SecretReference
+	if opts.defaultPublishSecretName != "" {
+		defaultSecretRef = &v1.SecretReference{
+			Name:      opts.defaultPublishSecretName,
+			Namespace: opts.defaultPublishSecretNamespace,
+		}
+	}
+	handler := env.newHandler(volAttacher, nil /* no lister */, opts.timeout, scInformer, defaultSecretRef)
+	if err := env.startInformers(ctx); err != nil {
+		return err
+	}
+	vas, err := selectForceDetach(env, opts, out)
+	if err != nil {
+		return err
+	}
+	if len(vas) == 0 {
+		fmt.Fprintln(out, "No VolumeAttachments to detach.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPV\tNODE\tDETACH ERROR")
+	for _, va := range vas {
+		pvName := "-"
+		if va.Spec.Source.PersistentVolumeName != nil {
+			pvName = *va.Spec.Source.PersistentVolumeName
+		}
+		detachError := "-"
+		if va.Status.DetachError != nil {
+			detachError = va.Status.DetachError.Message
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", va.Name, pvName, va.Spec.NodeName, detachError)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if opts.skipUnpublish {
+		fmt.Fprintln(out, "ControllerUnpublish will NOT be called, the volumes may stay attached in the storage backend.")
+	}
+	if !opts.yes && !confirm(in, out, fmt.Sprintf("Force detach %d VolumeAttachment(s)?", len(vas))) {
+		return fmt.Errorf("aborted")
+	}
+
+	var errs []error
+	for _, va := range vas {
+		// A new context, the confirmation may take longer than the timeout.
+		// ControllerUnpublish uses the timeout of the handler.
+		if _, err := handler.(controller.ForceDetacher).ForceDetach(context.Background(), va, opts.skipUnpublish); err != nil {
+			fmt.Fprintf(out, "%s: %s\n", va.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", va.Name, err))
+			continue
+		}
+		fmt.Fprintf(out, "%s: detached\n", va.Name)
+	}
+	if len(errs) > 0 && !opts.skipUnpublish {
+		fmt.Fprintln(out, "Use -skip-unpublish when ControllerUnpublish cannot succeed, for example when the PersistentVolume was deleted.")
+	}
+	return errors.Join(errs...)
+}
+
+// selectForceDetach returns VolumeAttachments selected by the command line
+// options. VolumeAttachments that are not deleted are skipped, the
+// controller would attach them again.
+func selectForceDetach(env *subcommandEnv, opts forceDetachOptions, out io.Writer) ([]*storage.VolumeAttachment, error) {
+	vas, err := env.listVolumeAttachments()
+	if err != nil {
+		return nil, err
+	}
+	if opts.volumeAttachment != "" {
+		for _, va := range vas {
+			if va.Name != opts.volumeAttachment {
+				continue
+			}
+			if va.DeletionTimestamp == nil {
+				return nil, fmt.Errorf("VolumeAttachment %s is not being deleted, delete it first", va.Name)
+			}
+			return []*storage.VolumeAttachment{va}, nil
+		}
+		return nil, fmt.Errorf("VolumeAttachment %s of driver %s not found", opts.volumeAttachment, env.driverName)
+	}
+
+	var selected []*storage.VolumeAttachment
+	for _, va := range vas {
+		if va.Spec.NodeName != opts.node {
+			continue
+		}
+		if va.DeletionTimestamp == nil {
+			fmt.Fprintf(out, "Skipping VolumeAttachment %s, it is not being deleted.\n", va.Name)
+			continue
+		}
+		selected = append(selected, va)
+	}
+	return selected, nil
+}
+
+// confirm asks a yes / no question and returns true when the answer is yes.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
+)
+
+// runInspect implements the inspect subcommand. It prints VolumeAttachments
+// of a CSI driver with their node IDs and errors. When the CSI driver socket
+// is available, it also compares them with volumes published by the driver.
+// Nothing is changed, neither in the API server nor in the driver.
+func runInspect(args []string) error {
+	var opts subcommandOptions
+	fs := newSubcommandFlagSet("inspect", "Prints state of VolumeAttachments of a CSI driver.", &opts)
+	output := fs.String("output", "table", "Output format, one of table, json or yaml.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	switch *output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported output format %q", *output)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	states, err := inspect(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return printAttachmentStates(os.Stdout, *output, states)
+}
+
+func inspect(ctx context.Context, opts subcommandOptions) ([]controller.AttachmentState, error) {
+	logger := klog.FromContext(ctx)
+	env, err := newSubcommandEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer env.close()
+
+	var lister controller.VolumeLister
+	if env.csiConn != nil {
+		supportsService, err := supportsPluginControllerService(ctx, env.csiConn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if the CSI driver supports the CONTROLLER_SERVICE: %w", err)
+		}
+		if supportsService {
+			_, _, supportsListVolumesPublishedNodes, supportsGetVolume, _, err := supportsControllerCapabilities(ctx, env.csiConn)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check controller capabilities: %w", err)
+			}
+			// The same listers as the reconciler uses.
+			if supportsListVolumesPublishedNodes {
+				lister = attacher.NewVolumeLister(env.csiConn, 0 /* no limit of entries */)
+			} else if supportsGetVolume {
+				lister = attacher.NewGetVolumeLister(env.csiConn, 1 /* worker */)
+			}
+		}
+		if lister == nil {
+			logger.Info("CSI driver cannot list published volumes, VolumeAttachments are not compared with the driver")
+		}
+	}
+
+	handler := env.newHandler(nil /* nothing is attached or detached */, lister, opts.timeout, nil, nil)
+	if err := env.startInformers(ctx); err != nil {
+		return nil, err
+	}
+	vas, err := env.listVolumeAttachments()
+	if err != nil {
+		return nil, err
+	}
+	return handler.(controller.Inspector).InspectVolumeAttachments(ctx, vas)
+}
+
+func printAttachmentStates(w io.Writer, output string, states []controller.AttachmentState) error {
+	if states == nil {
+		states = []controller.AttachmentState{}
+	}
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(states)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPV\tNODE\tNODE ID\tATTACHED\tPUBLISHED\tDRIFT\tLAST ERROR\tERROR")
+	for _, s := range states {
+		published := "-"
+		if s.Published != nil {
+			published = strconv.FormatBool(*s.Published)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%t\t%s\t%s\n",
+			s.Name, orDash(s.PersistentVolume), s.Node, orDash(s.NodeID), s.Attached, published, s.Drift, orDash(s.LastError), orDash(s.Error))
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -20,18 +20,26 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/server"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	utilflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/featuregate"
 	"k8s.io/component-base/logs"
@@ -51,8 +59,11 @@ import (
 	"github.com/kubernetes-csi/csi-lib-utils/rpc"
 	"github.com/kubernetes-csi/csi-lib-utils/standardflags"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
+	attacherconfig "github.com/kubernetes-csi/external-attacher/v4/pkg/config"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/features"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/sharding"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/tracing"
 	"google.golang.org/grpc"
 )
 
@@ -60,23 +71,56 @@ const (
 
 	// Default timeout of short CSI calls like GetPluginInfo
 	csiTimeout = time.Second
+
+	// Timeout of flushing remaining spans on exit
+	tracingFlushTimeout = 5 * time.Second
 )
 
 // Command line flags
 var (
+	configFile         = flag.String("config", "", "Path to a configuration file. Options in the file override command line options. The file is watched and changes of timeout, retry intervals, retry policy, reconcile-sync, reconcile-batch-size, reconcile-max-requeues, max-attach-attempts and orphan-detach-grace-period are applied without a restart.")
 	resync             = flag.Duration("resync", 10*time.Minute, "Resync interval of the controller.")
 	timeout            = flag.Duration("timeout", 15*time.Second, "Timeout for waiting for attaching or detaching the volume.")
 	retryIntervalStart = flag.Duration("retry-interval-start", time.Second, "Initial retry interval of failed provisioning or deletion. It doubles with each failure, up to retry-interval-max.")
 	retryIntervalMax   = flag.Duration("retry-interval-max", 5*time.Minute, "Maximum retry interval of failed provisioning or deletion.")
+	maxAttachAttempts  = flag.Int("max-attach-attempts", 0, "Maximum number of failed attach attempts of a VolumeAttachment, after which the attacher stops retrying until the VolumeAttachment or its PersistentVolume changes. 0 means no limit.")
+	retryPolicyFile    = flag.String("retry-policy-file", "", "Path to a YAML file with retry intervals of VolumeAttachments per gRPC error code. When not set, a default policy based on retry-interval-start and retry-interval-max is used.")
 	workerThreads      = flag.Uint("worker-threads", 10, "Number of attacher worker threads")
 	maxEntries         = flag.Int("max-entries", 0, "Max entries per each page in volume lister call, 0 means no limit.")
+	getVolumeWorkers   = flag.Int("get-volume-workers", 10, "Maximum number of parallel ControllerGetVolume calls when reconciling VolumeAttachments with a driver that supports GET_VOLUME, but not LIST_VOLUMES_PUBLISHED_NODES.")
+	secretCacheTTL     = flag.Duration("secret-cache-ttl", 0, "Time for which ControllerPublish secrets are cached. 0 disables the cache.")
+	secretNamespaces   = flag.String("secret-namespaces", "", "Comma separated list of namespaces with ControllerPublish secrets. When set together with --secret-cache-ttl, the attacher watches Secrets in these namespaces and re-queues VolumeAttachments that use a secret when the secret is created or updated.")
+	maxNodeOperations  = flag.Int("max-node-operations", 0, "Maximum number of concurrent ControllerPublish and ControllerUnpublish calls per node, 0 means no limit.")
 
 	defaultFSType = flag.String("default-fstype", "", "The default filesystem type of the volume to publish. Defaults to empty string")
 
-	reconcileSync = flag.Duration("reconcile-sync", 1*time.Minute, "Resync interval of the VolumeAttachment reconciler.")
+	storageClassPublishSecret     = flag.Bool("storage-class-publish-secret", false, "Use ControllerPublish secret from StorageClass parameters csi.storage.k8s.io/controller-publish-secret-name and csi.storage.k8s.io/controller-publish-secret-namespace for PersistentVolumes that do not have ControllerPublishSecretRef.")
+	defaultPublishSecretName      = flag.String("default-publish-secret-name", "", "Name of ControllerPublish secret of PersistentVolumes that do not have ControllerPublishSecretRef and do not get one from their StorageClass. ${pv.name}, ${pvc.namespace} and ${pvc.name} are replaced with the PV name, PVC namespace and PVC name.")
+	defaultPublishSecretNamespace = flag.String("default-publish-secret-namespace", "", "Namespace of the default ControllerPublish secret. ${pv.name} and ${pvc.namespace} are replaced with the PV name and PVC namespace.")
+	reconcileSync                 = flag.Duration("reconcile-sync", 1*time.Minute, "Resync interval of the VolumeAttachment reconciler.")
+	reconcileBatchSize            = flag.Int("reconcile-batch-size", 0, "Maximum number of VolumeAttachments checked by each run of the VolumeAttachment reconciler. The next run continues with the next VolumeAttachments. 0 means no limit, all VolumeAttachments are checked in each run.")
+	reconcileMaxRequeues          = flag.Int("reconcile-max-requeues", 0, "Maximum number of VolumeAttachments the VolumeAttachment reconciler requeues for processing in each run. The next run continues with the first VolumeAttachment that was not requeued. 0 means no limit.")
+	orphanDetachGracePeriod       = flag.Duration("orphan-detach-grace-period", 0, "Time after which the VolumeAttachment reconciler detaches a volume that the CSI driver reports as published on a node without a VolumeAttachment. 0 disables detaching, such volumes are only reported.")
+
+	dryRun = flag.Bool("dry-run", false, "Run the controller without attaching or detaching any volume and without modifying any PersistentVolume or VolumeAttachment. The intended actions are logged instead.")
 
 	maxGRPCLogLength = flag.Int("max-grpc-log-length", -1, "The maximum amount of characters logged for every grpc responses. Defaults to no limit")
 
+	tracingExporter      = flag.String("tracing-exporter", "", "Exporter of OpenTelemetry traces of VolumeAttachment and PersistentVolume processing: \"otlp\" or \"file\". Tracing is disabled when empty.")
+	tracingEndpoint      = flag.String("tracing-endpoint", "", "OTLP gRPC endpoint of the otlp tracing exporter. Defaults to OTEL_EXPORTER_OTLP_ENDPOINT environment variable or localhost:4317.")
+	tracingInsecure      = flag.Bool("tracing-insecure", false, "Connect to --tracing-endpoint without TLS.")
+	tracingFile          = flag.String("tracing-file", "", "Path to a file to which the file tracing exporter appends spans as JSON lines.")
+	tracingSamplingRatio = flag.Float64("tracing-sampling-ratio", 1, "Ratio of traced VolumeAttachment and PersistentVolume syncs, from 0 to 1.")
+
+	auditLog               = flag.String("audit-log", "", "Path to a file to which every ControllerPublishVolume and ControllerUnpublishVolume call is recorded as a JSON line. \"-\" writes the records to stdout. The audit log is disabled when empty.")
+	auditLogMaxSize        = flag.Int64("audit-log-max-size", 100, "Maximum size of the audit log file in megabytes, after which it is rotated. 0 disables rotation.")
+	auditLogMaxBackups     = flag.Int("audit-log-max-backups", 5, "Maximum number of rotated audit log files to keep. Must be at least 1 when the audit log is rotated.")
+	auditLogPublishContext = flag.Bool("audit-log-publish-context", false, "Record the publish context returned by ControllerPublishVolume in the audit log.")
+
+	enableDebugEndpoints = flag.Bool("enable-debug-endpoints", false, "Expose internal state of the attacher at /debug/attacher/ paths of --http-endpoint. The state includes names of VolumeAttachments, PersistentVolumes and nodes and error messages of the CSI driver, the endpoints are not authenticated.")
+
+	enableSharding = flag.Bool("sharding", false, "Run all replicas of the attacher at the same time, each processing VolumeAttachments of a part of nodes. Replicas find each other through Leases in the leader election namespace and use leader election lease duration, renew deadline and retry period. It cannot be used together with --leader-election.")
+
 	featureGates map[string]bool
 )
 
@@ -84,7 +128,24 @@ var (
 	version = "unknown"
 )
 
+// subcommands are tools for administrators that have their own options.
+var subcommands = map[string]func(args []string) error{
+	"inspect":      runInspect,
+	"force-detach": runForceDetach,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, found := subcommands[os.Args[1]]; found {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+			}
+			klog.Flush()
+			return
+		}
+	}
+
 	flag.Var(utilflag.NewMapStringBool(&featureGates), "feature-gates", "A set of key=value pairs that describe feature gates for alpha/experimental features. "+
 		"Options are:\n"+strings.Join(utilfeature.DefaultFeatureGate.KnownFeatures(), "\n"))
 
@@ -121,6 +182,10 @@ func main() {
 	if addr == "" {
 		addr = standardflags.Configuration.HttpEndpoint
 	}
+	if *enableDebugEndpoints && addr == "" {
+		logger.Error(nil, "Option --enable-debug-endpoints requires --http-endpoint")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
 
 	// Create the client config. Use kubeconfig if given, otherwise assume in-cluster.
 	config, err := libconfig.BuildConfig(standardflags.Configuration.KubeConfig, standardflags.Configuration)
@@ -135,26 +200,118 @@ func main() {
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
+	if (*defaultPublishSecretName == "") != (*defaultPublishSecretNamespace == "") {
+		logger.Error(nil, "Options -default-publish-secret-name and -default-publish-secret-namespace must be set together")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	if *enableSharding && standardflags.Configuration.LeaderElection {
+		logger.Error(nil, "Options -sharding and -leader-election cannot be used together")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	if *auditLogMaxSize < 0 || *auditLogMaxBackups < 0 {
+		logger.Error(nil, "Options -audit-log-max-size and -audit-log-max-backups must not be negative")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	if *auditLogMaxSize > 0 && *auditLogMaxBackups == 0 {
+		logger.Error(nil, "Option -audit-log-max-backups must be at least 1 when -audit-log-max-size is set, rotation would drop the audit log")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	var auditWriter io.Writer
+	if *auditLog != "" {
+		auditWriter, err = openAuditLog(*auditLog, *auditLogMaxSize, *auditLogMaxBackups)
+		if err != nil {
+			logger.Error(err, "Failed to open audit log", "path", *auditLog)
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
+
+	flagConfig := configurationFromFlags()
+	cfg := flagConfig
+	if *configFile != "" {
+		cfg, err = attacherconfig.Load(*configFile, flagConfig)
+		if err != nil {
+			logger.Error(err, "Failed to load configuration")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
+
+	retryPolicyConfig, err := getRetryPolicyConfig(cfg)
+	if err != nil {
+		logger.Error(err, "Failed to load retry policy")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	retryPolicy, err := controller.NewRetryPolicy(retryPolicyConfig)
+	if err != nil {
+		logger.Error(err, "Invalid retry policy")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	pvRetryPolicy, err := controller.NewRetryPolicy(getPVRetryPolicyConfig(cfg))
+	if err != nil {
+		logger.Error(err, "Invalid retry policy")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		logger.Error(err, "Failed to create a Clientset")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	factory := informers.NewSharedInformerFactory(clientset, *resync)
+	// client is used for all writes done by the controller.
+	var client kubernetes.Interface = clientset
+	if *dryRun {
+		logger.Info("Running in dry-run mode, no volumes will be attached or detached")
+		client = controller.NewDryRunClient(clientset)
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, cfg.Resync.Duration)
+	// secretFactories watch Secrets, one per namespace.
+	var secretFactories []informers.SharedInformerFactory
 	var handler controller.Handler
+	// handlerSynced are informers used by the handler.
+	var handlerSynced []cache.InformerSynced
 	metricsManager := metrics.NewCSIMetricsManager("" /* driverName */)
 
+	ctx := context.Background()
+	connectionOptions := []connection.Option{connection.OnConnectionLoss(connection.ExitOnConnectionLoss())}
+	// flushTracing flushes remaining spans on exit.
+	flushTracing := func() {}
+	if *tracingExporter != "" {
+		shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+			Exporter:      *tracingExporter,
+			Endpoint:      *tracingEndpoint,
+			Insecure:      *tracingInsecure,
+			File:          *tracingFile,
+			SamplingRatio: *tracingSamplingRatio,
+		})
+		if err != nil {
+			logger.Error(err, "Failed to set up tracing")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		flushTracing = func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+			defer cancel()
+			if err := shutdownTracing(flushCtx); err != nil {
+				logger.Error(err, "Failed to flush traces")
+			}
+		}
+		defer flushTracing()
+		// Propagate the trace context to the CSI driver.
+		connectionOptions = append(connectionOptions, connection.WithOtelTracing())
+		logger.Info("Tracing enabled", "exporter", *tracingExporter)
+	}
+
 	// Connect to CSI.
 	connection.SetMaxGRPCLogLength(*maxGRPCLogLength)
-	ctx := context.Background()
-	csiConn, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connection.OnConnectionLoss(connection.ExitOnConnectionLoss()))
+	csiConn, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connectionOptions...)
 	if err != nil {
 		logger.Error(err, "Failed to connect to the CSI driver", "csiAddress", standardflags.Configuration.CSIAddress)
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	err = rpc.ProbeForever(ctx, csiConn, *timeout)
+	err = rpc.ProbeForever(ctx, csiConn, cfg.Timeout.Duration)
 	if err != nil {
 		logger.Error(err, "Failed to probe the CSI driver")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -175,7 +332,7 @@ func main() {
 	translator := csitrans.New()
 	if translator.IsMigratedCSIDriverByName(csiAttacher) {
 		metricsManager = metrics.NewCSIMetricsManagerWithOptions(csiAttacher, metrics.WithMigration())
-		migratedCsiClient, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connection.OnConnectionLoss(connection.ExitOnConnectionLoss()))
+		migratedCsiClient, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connectionOptions...)
 		if err != nil {
 			logger.Error(err, "Failed to connect to the CSI driver", "csiAddress", standardflags.Configuration.CSIAddress, "migrated", true)
 			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -183,7 +340,7 @@ func main() {
 		csiConn.Close()
 		csiConn = migratedCsiClient
 
-		err = rpc.ProbeForever(ctx, csiConn, *timeout)
+		err = rpc.ProbeForever(ctx, csiConn, cfg.Timeout.Duration)
 		if err != nil {
 			logger.Error(err, "Failed to probe the CSI driver", "migrated", true)
 			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -191,7 +348,9 @@ func main() {
 	}
 
 	// Add default legacy registry so that metrics manager serves Go runtime and process metrics.
-	// Also registers the `k8s.io/component-base/` work queue and leader election metrics we anonymously import.
+	// Also registers the `k8s.io/component-base/` work queue and leader election metrics we anonymously import
+	// and metrics of the controller.
+	controller.RegisterMetrics()
 	metricsManager.WithAdditionalRegistry(legacyregistry.DefaultGatherer)
 
 	// Prepare http endpoint for metrics + leader election healthz
@@ -209,6 +368,16 @@ func main() {
 		}()
 	}
 
+	// Prepare event recorder. The broadcaster's default event correlator
+	// aggregates identical events, so repeated failures during exponential
+	// backoff do not flood the API server.
+	eventBroadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	eventBroadcaster.StartStructuredLogging(0)
+	if !*dryRun {
+		eventBroadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: clientset.CoreV1().Events(v1.NamespaceAll)})
+	}
+	eventRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "external-attacher-" + controller.SanitizeDriverName(csiAttacher)})
+
 	cancelationCtx, cancel = context.WithTimeout(ctx, csiTimeout)
 	cancelationCtx = klog.NewContext(cancelationCtx, logger)
 	defer cancel()
@@ -222,61 +391,201 @@ func main() {
 		supportsAttach                    bool
 		supportsReadOnly                  bool
 		supportsListVolumesPublishedNodes bool
+		supportsGetVolume                 bool
 		supportsSingleNodeMultiWriter     bool
 	)
 	if !supportsService {
-		handler = controller.NewTrivialHandler(clientset)
+		handler = controller.NewTrivialHandler(client, eventRecorder, factory.Core().V1().PersistentVolumes().Lister())
 		logger.V(2).Info("CSI driver does not support Plugin Controller Service, using trivial handler")
 	} else {
-		supportsAttach, supportsReadOnly, supportsListVolumesPublishedNodes, supportsSingleNodeMultiWriter, err = supportsControllerCapabilities(cancelationCtx, csiConn)
+		supportsAttach, supportsReadOnly, supportsListVolumesPublishedNodes, supportsGetVolume, supportsSingleNodeMultiWriter, err = supportsControllerCapabilities(cancelationCtx, csiConn)
 		if err != nil {
 			logger.Error(err, "Failed to controller capability check")
 			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 		}
 
 		if supportsAttach {
-			pvLister := factory.Core().V1().PersistentVolumes().Lister()
-			vaLister := factory.Storage().V1().VolumeAttachments().Lister()
+			pvIndexer := factory.Core().V1().PersistentVolumes().Informer().GetIndexer()
+			vaIndexer := factory.Storage().V1().VolumeAttachments().Informer().GetIndexer()
 			csiNodeLister := factory.Storage().V1().CSINodes().Lister()
 			volAttacher := attacher.NewAttacher(csiConn)
-			CSIVolumeLister := attacher.NewVolumeLister(csiConn, *maxEntries)
+			if *dryRun {
+				volAttacher = attacher.NewDryRunAttacher()
+			}
+			if auditWriter != nil {
+				replica, err := os.Hostname()
+				if err != nil {
+					logger.Error(err, "Failed to get hostname for the audit log")
+				}
+				volAttacher = attacher.NewAuditAttacher(volAttacher, auditWriter, attacher.AuditOptions{
+					Driver:                csiAttacher,
+					Replica:               replica,
+					IncludePublishContext: *auditLogPublishContext,
+					DryRun:                *dryRun,
+				})
+			}
+			handlerSynced = append(handlerSynced, factory.Storage().V1().CSINodes().Informer().HasSynced)
+			var secretInformers []coreinformers.SecretInformer
+			if cfg.SecretCacheTTL.Duration > 0 {
+				for _, namespace := range cfg.SecretNamespaces {
+					secretFactory := informers.NewSharedInformerFactoryWithOptions(clientset, cfg.Resync.Duration,
+						informers.WithNamespace(namespace), informers.WithTransform(controller.StripSecretData))
+					secretInformer := secretFactory.Core().V1().Secrets()
+					secretInformers = append(secretInformers, secretInformer)
+					secretFactories = append(secretFactories, secretFactory)
+					handlerSynced = append(handlerSynced, secretInformer.Informer().HasSynced)
+				}
+			}
+			var scInformer storageinformers.StorageClassInformer
+			if cfg.StorageClassPublishSecret {
+				// A StorageClass missing from an unsynced cache would
+				// silently fall back to the default secret.
+				scInformer = factory.Storage().V1().StorageClasses()
+				handlerSynced = append(handlerSynced, factory.Storage().V1().StorageClasses().Informer().HasSynced)
+			}
+			var defaultSecretRef *v1.SecretReference
+			if cfg.DefaultPublishSecretName != "" {
+				defaultSecretRef = &v1.SecretReference{
+					Name:      cfg.DefaultPublishSecretName,
+					Namespace: cfg.DefaultPublishSecretNamespace,
+				}
+			}
+			var CSIVolumeLister controller.VolumeLister
+			if supportsListVolumesPublishedNodes {
+				CSIVolumeLister = attacher.NewVolumeLister(csiConn, cfg.MaxEntries)
+			} else {
+				CSIVolumeLister = attacher.NewGetVolumeLister(csiConn, cfg.GetVolumeWorkers)
+			}
 			handler = controller.NewCSIHandler(
-				clientset,
+				client,
+				eventRecorder,
 				csiAttacher,
 				volAttacher,
 				CSIVolumeLister,
-				pvLister,
+				pvIndexer,
 				csiNodeLister,
-				vaLister,
-				timeout,
+				vaIndexer,
+				&cfg.Timeout.Duration,
 				supportsReadOnly,
 				supportsSingleNodeMultiWriter,
 				csitrans.New(),
-				*defaultFSType,
+				cfg.DefaultFSType,
+				controller.CSIHandlerOptions{
+					MaxNodeOperations:        cfg.MaxNodeOperations,
+					SecretInformers:          secretInformers,
+					PersistentVolumeInformer: factory.Core().V1().PersistentVolumes(),
+					SecretCacheTTL:           cfg.SecretCacheTTL.Duration,
+					StorageClassInformer:     scInformer,
+					DefaultSecretRef:         defaultSecretRef,
+					RetryPolicy:              retryPolicy,
+					MaxRetryDelay:            cfg.RetryIntervalMax.Duration,
+					MaxAttachAttempts:        cfg.MaxAttachAttempts,
+					OrphanDetachGracePeriod:  cfg.OrphanDetachGracePeriod.Duration,
+					ReconcileBatchSize:       cfg.ReconcileBatchSize,
+					ReconcileMaxRequeues:     cfg.ReconcileMaxRequeues,
+				},
 			)
 			logger.V(2).Info("CSI driver supports ControllerPublishUnpublish, using real CSI handler")
 		} else {
-			handler = controller.NewTrivialHandler(clientset)
+			handler = controller.NewTrivialHandler(client, eventRecorder, factory.Core().V1().PersistentVolumes().Lister())
 			logger.V(2).Info("CSI driver does not support ControllerPublishUnpublish, using trivial handler")
 		}
 	}
 
-	if supportsListVolumesPublishedNodes {
-		logger.V(2).Info("CSI driver supports list volumes published nodes. Using capability to reconcile volume attachment objects with actual backend state")
+	shouldReconcileVolumeAttachment := false
+	if supportsAttach {
+		if supportsListVolumesPublishedNodes {
+			logger.V(2).Info("CSI driver supports list volumes published nodes. Using capability to reconcile volume attachment objects with actual backend state")
+			shouldReconcileVolumeAttachment = true
+		} else if supportsGetVolume {
+			logger.V(2).Info("CSI driver supports get volume. Using capability to reconcile volume attachment objects with actual backend state")
+			shouldReconcileVolumeAttachment = true
+		}
 	}
 
 	ctrl := controller.NewCSIAttachController(
 		logger,
-		clientset,
+		client,
 		csiAttacher,
 		handler,
 		factory.Storage().V1().VolumeAttachments(),
 		factory.Core().V1().PersistentVolumes(),
-		workqueue.NewTypedItemExponentialFailureRateLimiter[string](*retryIntervalStart, *retryIntervalMax),
-		workqueue.NewTypedItemExponentialFailureRateLimiter[string](*retryIntervalStart, *retryIntervalMax),
-		supportsListVolumesPublishedNodes,
-		*reconcileSync,
+		retryPolicy,
+		pvRetryPolicy,
+		shouldReconcileVolumeAttachment,
+		cfg.ReconcileSync.Duration,
 	)
+	var sharder *sharding.Sharder
+	if *enableSharding {
+		sharder, err = newSharder(clientset, csiAttacher, func() { ctrl.RequeueAll(logger) })
+		if err != nil {
+			logger.Error(err, "Failed to set up sharding")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		ctrl.SetShard(sharder)
+	}
+	ctrl.AddCacheSync(handlerSynced...)
+	legacyregistry.CustomMustRegister(controller.NewVolumeAttachmentStateCollector(csiAttacher, factory.Storage().V1().VolumeAttachments().Informer().GetIndexer()))
+
+	if *enableDebugEndpoints {
+		ctrl.RegisterDebugHandlers(mux, controller.DriverCapabilities{
+			DriverName:                 csiAttacher,
+			ControllerService:          supportsService,
+			PublishUnpublishVolume:     supportsAttach,
+			PublishReadOnly:            supportsReadOnly,
+			ListVolumesPublishedNodes:  supportsListVolumesPublishedNodes,
+			GetVolume:                  supportsGetVolume,
+			SingleNodeMultiWriter:      supportsSingleNodeMultiWriter,
+			ReconcileVolumeAttachments: shouldReconcileVolumeAttachment,
+		})
+	}
+
+	if *configFile != "" {
+		// Apply changes of the configuration file that are safe to change
+		// while the controller runs.
+		err := attacherconfig.Watch(klog.NewContext(ctx, logger), *configFile, flagConfig, func(newCfg attacherconfig.Configuration) {
+			if fields := attacherconfig.RestartRequired(&cfg, &newCfg); len(fields) > 0 {
+				logger.Info("Configuration changes that require a restart are ignored", "fields", fields)
+			}
+			newRetryPolicyConfig, err := getRetryPolicyConfig(newCfg)
+			if err != nil {
+				logger.Error(err, "Ignoring configuration with invalid retry policy")
+				return
+			}
+			if err := newRetryPolicyConfig.Validate(); err != nil {
+				logger.Error(err, "Ignoring configuration with invalid retry policy")
+				return
+			}
+			newPVRetryPolicyConfig := getPVRetryPolicyConfig(newCfg)
+			if err := newPVRetryPolicyConfig.Validate(); err != nil {
+				logger.Error(err, "Ignoring configuration with invalid retry intervals")
+				return
+			}
+			// Both configs are valid, the updates cannot fail.
+			if err := retryPolicy.Update(newRetryPolicyConfig); err != nil {
+				logger.Error(err, "Failed to update retry policy")
+			}
+			if err := pvRetryPolicy.Update(newPVRetryPolicyConfig); err != nil {
+				logger.Error(err, "Failed to update retry intervals")
+			}
+			handler.UpdateSettings(controller.HandlerSettings{
+				Timeout:                 newCfg.Timeout.Duration,
+				MaxRetryDelay:           newCfg.RetryIntervalMax.Duration,
+				MaxAttachAttempts:       newCfg.MaxAttachAttempts,
+				OrphanDetachGracePeriod: newCfg.OrphanDetachGracePeriod.Duration,
+				ReconcileBatchSize:      newCfg.ReconcileBatchSize,
+				ReconcileMaxRequeues:    newCfg.ReconcileMaxRequeues,
+			})
+			ctrl.SetReconcileSync(newCfg.ReconcileSync.Duration)
+			logger.Info("Applied configuration changes", "timeout", newCfg.Timeout.Duration, "retryIntervalStart", newCfg.RetryIntervalStart.Duration,
+				"retryIntervalMax", newCfg.RetryIntervalMax.Duration, "reconcileSync", newCfg.ReconcileSync.Duration, "maxAttachAttempts", newCfg.MaxAttachAttempts, "orphanDetachGracePeriod", newCfg.OrphanDetachGracePeriod.Duration,
+				"reconcileBatchSize", newCfg.ReconcileBatchSize, "reconcileMaxRequeues", newCfg.ReconcileMaxRequeues)
+		})
+		if err != nil {
+			logger.Error(err, "Failed to watch configuration file")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
 	// handle SIGTERM and SIGINT by cancelling the context.
 	var (
 		terminate       func()          // called when all controllers are finished
@@ -297,44 +606,126 @@ func main() {
 			<-shutdownHandler
 			logger.Info("Received SIGTERM or SIGINT signal, shutting down controller.")
 		}()
+	} else if *tracingExporter != "" {
+		// Without ReleaseLeaderElectionOnExit, run never returns and the
+		// deferred flush does not run. Flush the traces before the signal
+		// would kill the process.
+		shutdownHandler = server.SetupSignalHandler()
+		go func() {
+			<-shutdownHandler
+			logger.Info("Received SIGTERM or SIGINT signal, flushing traces.")
+			flushTracing()
+			klog.FlushAndExit(klog.ExitFlushTimeout, 0)
+		}()
 	}
 
 	run := func(ctx context.Context) {
 		if utilfeature.DefaultFeatureGate.Enabled(features.ReleaseLeaderElectionOnExit) {
 			var wg sync.WaitGroup
 			factory.Start(shutdownHandler)
-			ctrl.Run(controllerCtx, int(*workerThreads), &wg)
+			for _, secretFactory := range secretFactories {
+				secretFactory.Start(shutdownHandler)
+			}
+			if sharder != nil {
+				go sharder.Run(controllerCtx)
+			}
+			ctrl.Run(controllerCtx, int(cfg.WorkerThreads), &wg)
 			wg.Wait()
 			terminate()
 		} else {
 			stopCh := ctx.Done()
 			factory.Start(stopCh)
-			ctrl.Run(ctx, int(*workerThreads), nil)
+			for _, secretFactory := range secretFactories {
+				secretFactory.Start(stopCh)
+			}
+			if sharder != nil {
+				go sharder.Run(ctx)
+			}
+			ctrl.Run(ctx, int(cfg.WorkerThreads), nil)
 		}
 	}
 
+	// Use a separate lock in dry-run mode, so a dry-run instance never takes
+	// over leadership from a real external-attacher of the same driver.
+	lockName := "external-attacher-leader-" + csiAttacher
+	if *dryRun {
+		lockName += "-dry-run"
+	}
 	leaderelection.RunWithLeaderElection(
 		ctx,
 		config,
 		standardflags.Configuration,
 		run,
-		"external-attacher-leader-"+csiAttacher,
+		lockName,
 		mux,
 		utilfeature.DefaultFeatureGate.Enabled(features.ReleaseLeaderElectionOnExit),
 	)
 }
 
-func supportsControllerCapabilities(ctx context.Context, csiConn *grpc.ClientConn) (bool, bool, bool, bool, error) {
+// configurationFromFlags returns configuration with values of the command line
+// options.
+func configurationFromFlags() attacherconfig.Configuration {
+	return attacherconfig.Configuration{
+		Timeout:                       metav1.Duration{Duration: *timeout},
+		RetryIntervalStart:            metav1.Duration{Duration: *retryIntervalStart},
+		RetryIntervalMax:              metav1.Duration{Duration: *retryIntervalMax},
+		ReconcileSync:                 metav1.Duration{Duration: *reconcileSync},
+		MaxAttachAttempts:             *maxAttachAttempts,
+		OrphanDetachGracePeriod:       metav1.Duration{Duration: *orphanDetachGracePeriod},
+		ReconcileBatchSize:            *reconcileBatchSize,
+		ReconcileMaxRequeues:          *reconcileMaxRequeues,
+		Resync:                        metav1.Duration{Duration: *resync},
+		WorkerThreads:                 *workerThreads,
+		MaxEntries:                    *maxEntries,
+		GetVolumeWorkers:              *getVolumeWorkers,
+		SecretCacheTTL:                metav1.Duration{Duration: *secretCacheTTL},
+		SecretNamespaces:              splitList(*secretNamespaces),
+		MaxNodeOperations:             *maxNodeOperations,
+		DefaultFSType:                 *defaultFSType,
+		StorageClassPublishSecret:     *storageClassPublishSecret,
+		DefaultPublishSecretName:      *defaultPublishSecretName,
+		DefaultPublishSecretNamespace: *defaultPublishSecretNamespace,
+	}
+}
+
+// getRetryPolicyConfig returns the retry policy of VolumeAttachments, either
+// from the configuration file, from --retry-policy-file or the default one.
+func getRetryPolicyConfig(cfg attacherconfig.Configuration) (controller.RetryPolicyConfig, error) {
+	policy := controller.DefaultRetryPolicyConfig(cfg.RetryIntervalStart.Duration, cfg.RetryIntervalMax.Duration)
+	switch {
+	case cfg.RetryPolicy != nil && *retryPolicyFile != "":
+		return controller.RetryPolicyConfig{}, fmt.Errorf("retryPolicy in the configuration file and --retry-policy-file cannot be used together")
+	case cfg.RetryPolicy != nil:
+		return *cfg.RetryPolicy, nil
+	case *retryPolicyFile != "":
+		return controller.LoadRetryPolicyConfig(*retryPolicyFile, policy)
+	}
+	return policy, nil
+}
+
+// getPVRetryPolicyConfig returns the retry policy of PersistentVolumes, an
+// exponential backoff between the retry intervals.
+func getPVRetryPolicyConfig(cfg attacherconfig.Configuration) controller.RetryPolicyConfig {
+	return controller.RetryPolicyConfig{
+		Default: controller.RetryRule{
+			InitialDelay: cfg.RetryIntervalStart,
+			MaxDelay:     cfg.RetryIntervalMax,
+		},
+	}
+}
+
+func supportsControllerCapabilities(ctx context.Context, csiConn *grpc.ClientConn) (bool, bool, bool, bool, bool, error) {
 	caps, err := rpc.GetControllerCapabilities(ctx, csiConn)
 	if err != nil {
-		return false, false, false, false, err
+		return false, false, false, false, false, err
 	}
 
 	supportsControllerPublish := caps[csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME]
 	supportsPublishReadOnly := caps[csi.ControllerServiceCapability_RPC_PUBLISH_READONLY]
 	supportsListVolumesPublishedNodes := caps[csi.ControllerServiceCapability_RPC_LIST_VOLUMES] && caps[csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES]
+	supportsGetVolume := caps[csi.ControllerServiceCapability_RPC_GET_VOLUME]
 	supportsSingleNodeMultiWriter := caps[csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER]
-	return supportsControllerPublish, supportsPublishReadOnly, supportsListVolumesPublishedNodes, supportsSingleNodeMultiWriter, nil
+	return supportsControllerPublish, supportsPublishReadOnly, supportsListVolumesPublishedNodes, supportsGetVolume, supportsSingleNodeMultiWriter, nil
 }
 
 func supportsPluginControllerService(ctx context.Context, csiConn *grpc.ClientConn) (bool, error) {
@@ -345,3 +736,65 @@ func supportsPluginControllerService(ctx context.Context, csiConn *grpc.ClientCo
 
 	return caps[csi.PluginCapability_Service_CONTROLLER_SERVICE], nil
 }
+
+// openAuditLog opens the audit log at path, "-" is stdout. maxSize is in
+// megabytes.
+func openAuditLog(path string, maxSize int64, maxBackups int) (io.Writer, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return attacher.OpenRotatingFile(path, maxSize*1024*1024, maxBackups)
+}
+
+// newSharder returns a Sharder of the driver with options of the leader
+// election.
+func newSharder(client kubernetes.Interface, driver string, onChange func()) (*sharding.Sharder, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	namespace := standardflags.Configuration.LeaderElectionNamespace
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+	// Use a separate group in dry-run mode, so a dry-run instance never
+	// takes VolumeAttachments from a real external-attacher of the same
+	// driver.
+	group := strings.ToLower(controller.SanitizeDriverName(driver))
+	if *dryRun {
+		group += "-dry-run"
+	}
+	return sharding.NewSharder(client, sharding.Config{
+		Namespace:     namespace,
+		Group:         group,
+		Identity:      strings.ToLower(identity),
+		LeaseDuration: standardflags.Configuration.LeaderElectionLeaseDuration,
+		RenewDeadline: standardflags.Configuration.LeaderElectionRenewDeadline,
+		RetryPeriod:   standardflags.Configuration.LeaderElectionRetryPeriod,
+	}, onChange)
+}
+
+// podNamespace returns the namespace of the attacher pod, the same one as
+// the default namespace of the leader election.
+func podNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// splitList returns non-empty items of a comma separated list.
+func splitList(list string) []string {
+	var items []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
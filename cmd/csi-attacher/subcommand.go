@@ -0,0 +1,192 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	csitrans "k8s.io/csi-translation-lib"
+	"k8s.io/klog/v2"
+
+	libconfig "github.com/kubernetes-csi/csi-lib-utils/config"
+	"github.com/kubernetes-csi/csi-lib-utils/connection"
+	"github.com/kubernetes-csi/csi-lib-utils/rpc"
+	"github.com/kubernetes-csi/csi-lib-utils/standardflags"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
+	"google.golang.org/grpc"
+)
+
+// subcommandOptions are command line options common to all subcommands.
+type subcommandOptions struct {
+	kubeconfig string
+	csiAddress string
+	driver     string
+	timeout    time.Duration
+}
+
+// newSubcommandFlagSet returns flags of a subcommand with the common
+// options and klog options.
+func newSubcommandFlagSet(name, description string, opts *subcommandOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options]\n\n%s\n\nOptions:\n", os.Args[0], name, description)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Absolute path to the kubeconfig file. Required only when running out of cluster.")
+	fs.StringVar(&opts.csiAddress, "csi-address", "", "Address of the CSI driver socket. When set, the driver name is read from the driver.")
+	fs.StringVar(&opts.driver, "driver", "", "Name of the CSI driver. Required when -csi-address is not set.")
+	fs.DurationVar(&opts.timeout, "timeout", time.Minute, "Timeout of each step of the command, such as connecting to the API server and the CSI driver, listing objects and each CSI call.")
+	klog.InitFlags(fs)
+	return fs
+}
+
+func (opts *subcommandOptions) validate() error {
+	if opts.csiAddress == "" && opts.driver == "" {
+		return fmt.Errorf("either -csi-address or -driver must be set")
+	}
+	return nil
+}
+
+// subcommandEnv is the connection to the API server and, optionally, to
+// the CSI driver that subcommands use.
+type subcommandEnv struct {
+	driverName string
+	clientset  kubernetes.Interface
+	// csiConn is nil when -csi-address is not set.
+	csiConn *grpc.ClientConn
+	factory informers.SharedInformerFactory
+	// stopInformers stops informers of the factory.
+	stopInformers context.CancelFunc
+}
+
+// newSubcommandEnv connects to the API server and to the CSI driver, when
+// its address is set.
+func newSubcommandEnv(ctx context.Context, opts subcommandOptions) (*subcommandEnv, error) {
+	config, err := libconfig.BuildConfig(opts.kubeconfig, standardflags.Configuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a Kubernetes config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a Clientset: %w", err)
+	}
+	env := &subcommandEnv{
+		driverName: opts.driver,
+		clientset:  clientset,
+		factory:    informers.NewSharedInformerFactory(clientset, 0),
+	}
+	if opts.csiAddress == "" {
+		return env, nil
+	}
+
+	csiConn, err := connection.ConnectWithoutMetrics(ctx, opts.csiAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the CSI driver: %w", err)
+	}
+	if err := rpc.ProbeForever(ctx, csiConn, csiTimeout); err != nil {
+		csiConn.Close()
+		return nil, fmt.Errorf("failed to probe the CSI driver: %w", err)
+	}
+	name, err := rpc.GetDriverName(ctx, csiConn)
+	if err != nil {
+		csiConn.Close()
+		return nil, fmt.Errorf("failed to get the CSI driver name: %w", err)
+	}
+	if env.driverName != "" && env.driverName != name {
+		csiConn.Close()
+		return nil, fmt.Errorf("-driver %s does not match name %s of the CSI driver", env.driverName, name)
+	}
+	env.driverName = name
+	env.csiConn = csiConn
+	return env, nil
+}
+
+func (env *subcommandEnv) close() {
+	if env.stopInformers != nil {
+		env.stopInformers()
+	}
+	env.factory.Shutdown()
+	if env.csiConn != nil {
+		env.csiConn.Close()
+	}
+}
+
+// newHandler returns a CSI handler that uses informers of the environment.
+// It must be called before startInformers.
+func (env *subcommandEnv) newHandler(volAttacher attacher.Attacher, lister controller.VolumeLister, timeout time.Duration, scInformer storageinformers.StorageClassInformer, defaultSecretRef *v1.SecretReference) controller.Handler {
+	return controller.NewCSIHandler(
+		env.clientset,
+		&record.FakeRecorder{},
+		env.driverName,
+		volAttacher,
+		lister,
+		env.factory.Core().V1().PersistentVolumes().Informer().GetIndexer(),
+		env.factory.Storage().V1().CSINodes().Lister(),
+		env.factory.Storage().V1().VolumeAttachments().Informer().GetIndexer(),
+		&timeout,
+		false, /* PUBLISH_READONLY is used only by attach */
+		false, /* SINGLE_NODE_MULTI_WRITER is used only by attach */
+		csitrans.New(),
+		"", /* default fstype is used only by attach */
+		controller.CSIHandlerOptions{
+			StorageClassInformer: scInformer,
+			DefaultSecretRef:     defaultSecretRef,
+		},
+	)
+}
+
+// startInformers starts all informers created so far and waits for their
+// caches. The informers run until close.
+func (env *subcommandEnv) startInformers(ctx context.Context) error {
+	informerCtx, stopInformers := context.WithCancel(context.Background())
+	env.stopInformers = stopInformers
+	env.factory.Start(informerCtx.Done())
+	for informerType, synced := range env.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer of %v", informerType)
+		}
+	}
+	return nil
+}
+
+// listVolumeAttachments returns VolumeAttachments of the driver from the
+// informer cache.
+func (env *subcommandEnv) listVolumeAttachments() ([]*storage.VolumeAttachment, error) {
+	allVAs, err := env.factory.Storage().V1().VolumeAttachments().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VolumeAttachments: %w", err)
+	}
+	var vas []*storage.VolumeAttachment
+	for _, va := range allVAs {
+		if va.Spec.Attacher == env.driverName {
+			vas = append(vas, va)
+		}
+	}
+	return vas, nil
+}
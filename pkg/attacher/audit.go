@@ -0,0 +1,316 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// AuditSchemaVersion is the version of AuditRecord. Fields of a version are
+// never renamed, removed or changed, new fields may be added.
+const AuditSchemaVersion = 1
+
+// Operations in AuditRecord.
+const (
+	AuditOperationPublish   = "ControllerPublishVolume"
+	AuditOperationUnpublish = "ControllerUnpublishVolume"
+)
+
+// redacted replaces values of secrets in AuditRecord.Error.
+const redacted = "<redacted>"
+
+// Results in AuditRecord.
+const (
+	AuditResultSuccess = "Success"
+	AuditResultFailure = "Failure"
+)
+
+// AuditRecord is one line of the audit log, a ControllerPublishVolume or
+// ControllerUnpublishVolume call.
+type AuditRecord struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Time is when the call started.
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Driver    string    `json:"driver"`
+	// Replica is the identity of the external-attacher replica that made
+	// the call.
+	Replica  string `json:"replica"`
+	VolumeID string `json:"volumeID"`
+	NodeID   string `json:"nodeID"`
+	// Node, VolumeAttachment and PersistentVolume are names of the
+	// Kubernetes objects of the call, when known.
+	Node             string `json:"node,omitempty"`
+	VolumeAttachment string `json:"volumeAttachment,omitempty"`
+	PersistentVolume string `json:"persistentVolume,omitempty"`
+	// ReadOnly is set only for ControllerPublishVolume.
+	ReadOnly *bool  `json:"readOnly,omitempty"`
+	Result   string `json:"result"`
+	// Code is the gRPC code of the call.
+	Code string `json:"code"`
+	// Error is the message of a failed call, without the gRPC code and
+	// with values of the secrets of the call redacted.
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	// SecretKeys are keys of the secrets passed to the call. Values of the
+	// secrets are never recorded.
+	SecretKeys []string `json:"secretKeys,omitempty"`
+	// PublishContext is the publish context returned by a successful
+	// ControllerPublishVolume, when enabled.
+	PublishContext map[string]string `json:"publishContext,omitempty"`
+	// DryRun is true when the call was only simulated.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// AuditInfo are names of Kubernetes objects of a call, recorded in the audit
+// log.
+type AuditInfo struct {
+	Node             string
+	VolumeAttachment string
+	PersistentVolume string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns a context with names of Kubernetes objects of a call
+// for the audit log.
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// AuditOptions are options of the audit log.
+type AuditOptions struct {
+	Driver  string
+	Replica string
+	// IncludePublishContext records the publish context returned by
+	// ControllerPublishVolume. It may contain sensitive data of the driver.
+	IncludePublishContext bool
+	DryRun                bool
+}
+
+// auditAttacher is an Attacher that records all calls of another Attacher
+// in the audit log.
+type auditAttacher struct {
+	attacher Attacher
+	opts     AuditOptions
+	mutex    sync.Mutex
+	w        io.Writer
+	clock    func() time.Time
+}
+
+var (
+	_ Attacher = &auditAttacher{}
+)
+
+// NewAuditAttacher provides a new Attacher that calls the given attacher and
+// writes an AuditRecord of each call to w as a JSON line. A failure to write
+// the record is logged, it does not fail the call.
+func NewAuditAttacher(attacher Attacher, w io.Writer, opts AuditOptions) Attacher {
+	return &auditAttacher{
+		attacher: attacher,
+		opts:     opts,
+		w:        w,
+		clock:    time.Now,
+	}
+}
+
+func (a *auditAttacher) Attach(ctx context.Context, volumeID string, readOnly bool, nodeID string, caps *csi.VolumeCapability, context, secrets map[string]string) (metadata map[string]string, detached bool, err error) {
+	start := a.clock()
+	metadata, detached, err = a.attacher.Attach(ctx, volumeID, readOnly, nodeID, caps, context, secrets)
+	record := a.newRecord(ctx, AuditOperationPublish, start, volumeID, nodeID, secrets, err)
+	record.ReadOnly = &readOnly
+	if err == nil && a.opts.IncludePublishContext {
+		record.PublishContext = metadata
+	}
+	a.write(ctx, record)
+	return metadata, detached, err
+}
+
+func (a *auditAttacher) Detach(ctx context.Context, volumeID string, nodeID string, secrets map[string]string) error {
+	start := a.clock()
+	err := a.attacher.Detach(ctx, volumeID, nodeID, secrets)
+	a.write(ctx, a.newRecord(ctx, AuditOperationUnpublish, start, volumeID, nodeID, secrets, err))
+	return err
+}
+
+func (a *auditAttacher) newRecord(ctx context.Context, operation string, start time.Time, volumeID, nodeID string, secrets map[string]string, err error) *AuditRecord {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	record := &AuditRecord{
+		SchemaVersion:    AuditSchemaVersion,
+		Time:             start.UTC(),
+		Operation:        operation,
+		Driver:           a.opts.Driver,
+		Replica:          a.opts.Replica,
+		VolumeID:         volumeID,
+		NodeID:           nodeID,
+		Node:             info.Node,
+		VolumeAttachment: info.VolumeAttachment,
+		PersistentVolume: info.PersistentVolume,
+		Result:           AuditResultSuccess,
+		Code:             status.Code(err).String(),
+		DurationSeconds:  a.clock().Sub(start).Seconds(),
+		SecretKeys:       slices.Sorted(maps.Keys(secrets)),
+		DryRun:           a.opts.DryRun,
+	}
+	if err != nil {
+		record.Result = AuditResultFailure
+		record.Error = sanitizeError(err, secrets)
+	}
+	return record
+}
+
+// sanitizeError returns the status message of err with all values of secrets
+// replaced, in case the driver echoes them in the error.
+func sanitizeError(err error, secrets map[string]string) string {
+	message := status.Convert(err).Message()
+	// Replace longer values first, a value may contain a shorter one.
+	values := slices.Collect(maps.Values(secrets))
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	for _, value := range values {
+		if value != "" {
+			message = strings.ReplaceAll(message, value, redacted)
+		}
+	}
+	return message
+}
+
+func (a *auditAttacher) write(ctx context.Context, record *AuditRecord) {
+	line, err := json.Marshal(record)
+	if err == nil {
+		a.mutex.Lock()
+		_, err = a.w.Write(append(line, '\n'))
+		a.mutex.Unlock()
+	}
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to write audit record", "operation", record.Operation, "volumeID", record.VolumeID, "nodeID", record.NodeID)
+	}
+}
+
+// RotatingFile is a file that is rotated when it reaches its maximum size.
+// The rotated files get suffixes .1, .2, ... up to the maximum number of
+// backups, .1 is the newest one. Each write is synced to the disk. It is not
+// safe for concurrent use.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenRotatingFile opens the file for appending. Zero maxSize disables
+// rotation. At least one backup is kept, so records are never dropped by a
+// rotation.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: max(maxBackups, 1)}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write writes p to the file. The file is rotated before the write when p
+// does not fit into it. A single write is never split between files. When
+// the rotation fails, p is still appended to the current file and the error
+// is returned. When the file could not be opened again after a rotation, it
+// is opened by the next write.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, fmt.Errorf("failed to open %s: %w", f.path, err)
+		}
+	}
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+		if f.file == nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", f.path, rotateErr)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = f.file.Sync()
+	}
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("failed to rotate %s: %w", f.path, rotateErr)
+	}
+	return n, err
+}
+
+// rotate moves the file to the first backup and opens a new one. When the
+// backups cannot be moved, the current file is opened again.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		err = f.moveToBackup()
+	}
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (f *RotatingFile) moveToBackup() error {
+	for i := f.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(f.backupPath(i), f.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.backupPath(1))
+}
+
+func (f *RotatingFile) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
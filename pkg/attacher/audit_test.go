@@ -0,0 +1,204 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAttacher is an Attacher that returns preset results.
+type fakeAttacher struct {
+	publishContext map[string]string
+	err            error
+}
+
+func (a *fakeAttacher) Attach(ctx context.Context, volumeID string, readOnly bool, nodeID string, caps *csi.VolumeCapability, context, secrets map[string]string) (map[string]string, bool, error) {
+	if a.err != nil {
+		return nil, true, a.err
+	}
+	return a.publishContext, false, nil
+}
+
+func (a *fakeAttacher) Detach(ctx context.Context, volumeID string, nodeID string, secrets map[string]string) error {
+	return a.err
+}
+
+func TestAuditAttacher(t *testing.T) {
+	secrets := map[string]string{"password": "secret-value", "user": "admin"}
+	publishContext := map[string]string{"devicePath": "/dev/sdb"}
+	info := AuditInfo{Node: "node1", VolumeAttachment: "va1", PersistentVolume: "pv1"}
+
+	tests := []struct {
+		name                  string
+		detach                bool
+		err                   error
+		includePublishContext bool
+		expectedRecord        string
+	}{
+		{
+			name:           "publish",
+			expectedRecord: `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerPublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","readOnly":true,"result":"Success","code":"OK","durationSeconds":1.5,"secretKeys":["password","user"]}`,
+		},
+		{
+			name:                  "publish with publish context",
+			includePublishContext: true,
+			expectedRecord:        `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerPublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","readOnly":true,"result":"Success","code":"OK","durationSeconds":1.5,"secretKeys":["password","user"],"publishContext":{"devicePath":"/dev/sdb"}}`,
+		},
+		{
+			name:                  "publish error",
+			err:                   status.Error(codes.NotFound, "volume not found"),
+			includePublishContext: true,
+			expectedRecord:        `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerPublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","readOnly":true,"result":"Failure","code":"NotFound","error":"volume not found","durationSeconds":1.5,"secretKeys":["password","user"]}`,
+		},
+		{
+			name:           "publish error with a secret",
+			err:            status.Error(codes.PermissionDenied, "invalid credentials admin:secret-value"),
+			expectedRecord: `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerPublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","readOnly":true,"result":"Failure","code":"PermissionDenied","error":"invalid credentials \u003credacted\u003e:\u003credacted\u003e","durationSeconds":1.5,"secretKeys":["password","user"]}`,
+		},
+		{
+			name:           "unpublish",
+			detach:         true,
+			expectedRecord: `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerUnpublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","result":"Success","code":"OK","durationSeconds":1.5,"secretKeys":["password","user"]}`,
+		},
+		{
+			name:           "unpublish error",
+			detach:         true,
+			err:            status.Error(codes.DeadlineExceeded, "timeout"),
+			expectedRecord: `{"schemaVersion":1,"time":"2026-01-01T00:00:00Z","operation":"ControllerUnpublishVolume","driver":"csi/test","replica":"attacher-0","volumeID":"vol1","nodeID":"nodeID1","node":"node1","volumeAttachment":"va1","persistentVolume":"pv1","result":"Failure","code":"DeadlineExceeded","error":"timeout","durationSeconds":1.5,"secretKeys":["password","user"]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			fake := &fakeAttacher{publishContext: publishContext, err: test.err}
+			a := NewAuditAttacher(fake, &out, AuditOptions{Driver: "csi/test", Replica: "attacher-0", IncludePublishContext: test.includePublishContext}).(*auditAttacher)
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			a.clock = func() time.Time {
+				// The first call is the start of the CSI call, the
+				// second one is its end.
+				current := now
+				now = now.Add(1500 * time.Millisecond)
+				return current
+			}
+
+			ctx := WithAuditInfo(context.Background(), info)
+			var err error
+			if test.detach {
+				err = a.Detach(ctx, "vol1", "nodeID1", secrets)
+			} else {
+				_, _, err = a.Attach(ctx, "vol1", true, "nodeID1", nil, nil, secrets)
+			}
+			if err != test.err {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+			if got := strings.TrimSuffix(out.String(), "\n"); got != test.expectedRecord {
+				t.Errorf("expected record:\n%s\ngot:\n%s", test.expectedRecord, got)
+			}
+			if strings.Contains(out.String(), "secret-value") {
+				t.Errorf("audit record contains a secret value: %s", out.String())
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n", "a very long line5\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write %q: %v", line, err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "a very long line5\n",
+		path + ".1": "line4\n",
+		path + ".2": "line3\n",
+	}
+	for p, content := range expected {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", p, err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %s to contain %q, got %q", p, content, string(data))
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no more than 2 backups, got %v", err)
+	}
+}
+
+func TestRotatingFileKeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"line1\n", "line2\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write %q: %v", line, err)
+		}
+	}
+	data, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if string(data) != "line1\n" {
+		t.Errorf("expected backup to contain %q, got %q", "line1\n", string(data))
+	}
+}
+
+func TestRotatingFileReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenRotatingFile(path, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	// The file could not be opened again after a rotation.
+	f.file.Close()
+	f.file = nil
+	if _, err := f.Write([]byte("line1\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "line1\n" {
+		t.Errorf("expected file to contain %q, got %q", "line1\n", string(data))
+	}
+}
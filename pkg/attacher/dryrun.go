@@ -0,0 +1,47 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/klog/v2"
+)
+
+// dryRunAttacher is an Attacher that only logs the calls it would make to
+// the CSI driver and reports them as successful.
+type dryRunAttacher struct{}
+
+var (
+	_ Attacher = &dryRunAttacher{}
+)
+
+// NewDryRunAttacher provides a new Attacher that does not call the CSI driver.
+func NewDryRunAttacher() Attacher {
+	return &dryRunAttacher{}
+}
+
+func (a *dryRunAttacher) Attach(ctx context.Context, volumeID string, readOnly bool, nodeID string, caps *csi.VolumeCapability, context, secrets map[string]string) (metadata map[string]string, detached bool, err error) {
+	klog.FromContext(ctx).Info("Dry run: skipping ControllerPublishVolume", "volumeID", volumeID, "nodeID", nodeID, "readOnly", readOnly)
+	return nil, false, nil
+}
+
+func (a *dryRunAttacher) Detach(ctx context.Context, volumeID string, nodeID string, secrets map[string]string) error {
+	klog.FromContext(ctx).Info("Dry run: skipping ControllerUnpublishVolume", "volumeID", volumeID, "nodeID", nodeID)
+	return nil
+}
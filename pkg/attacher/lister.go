@@ -19,12 +19,53 @@ package attacher
 import (
 	"context"
 	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// VolumeStatus is status of a volume as reported by the driver.
+type VolumeStatus struct {
+	// PublishedNodeIDs are IDs of nodes the volume is published on.
+	PublishedNodeIDs []string
+	// Condition is the condition of the volume. It is nil when the driver
+	// does not report it.
+	Condition *csi.VolumeCondition
+}
+
+// VolumePages is a sequence of pages of volumes reported by the driver. Each
+// page maps VolumeIDs to the volume status. An error ends the sequence.
+type VolumePages = iter.Seq2[map[string]VolumeStatus, error]
+
+// CollectVolumePages returns all volumes of the pages in a single map.
+func CollectVolumePages(pages VolumePages) (map[string]VolumeStatus, error) {
+	p := map[string]VolumeStatus{}
+	for page, err := range pages {
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(p, page)
+	}
+	return p, nil
+}
+
+// withPageTimeout returns a context for a call that gets a single page.
+// Zero pageTimeout means no timeout.
+func withPageTimeout(ctx context.Context, pageTimeout time.Duration) (context.Context, context.CancelFunc) {
+	if pageTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, pageTimeout)
+}
+
 type CSIVolumeLister struct {
 	client     csi.ControllerClient
 	maxEntries int32
@@ -38,32 +79,161 @@ func NewVolumeLister(conn *grpc.ClientConn, maxEntries int) *CSIVolumeLister {
 	}
 }
 
-func (a *CSIVolumeLister) ListVolumes(ctx context.Context) (map[string]([]string), error) {
-	p := map[string][]string{}
+// ListVolumes calls ListVolumes on the driver and returns all volumes it
+// reports. volumeIDs are ignored, the driver returns all its volumes anyway.
+func (a *CSIVolumeLister) ListVolumes(ctx context.Context, volumeIDs []string) (map[string]VolumeStatus, error) {
+	return CollectVolumePages(a.ListVolumePages(ctx, volumeIDs, 0))
+}
 
-	tok := ""
-	for {
-		rsp, err := a.client.ListVolumes(ctx, &csi.ListVolumesRequest{
-			StartingToken: tok,
-			MaxEntries:    a.maxEntries,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list volumes: %v", err)
-		}
+// ListsAllVolumes returns true, ListVolumePages returns all volumes of the
+// driver.
+func (a *CSIVolumeLister) ListsAllVolumes() bool {
+	return true
+}
 
-		for _, e := range rsp.Entries {
-			if e.GetVolume() == nil || e.GetStatus() == nil {
-				continue
+// ListVolumePages calls ListVolumes on the driver and returns the volumes
+// page by page, as the driver returns them. Each ListVolumes call gets its own
+// pageTimeout. volumeIDs are ignored, the driver returns all its volumes
+// anyway.
+func (a *CSIVolumeLister) ListVolumePages(ctx context.Context, volumeIDs []string, pageTimeout time.Duration) VolumePages {
+	return func(yield func(map[string]VolumeStatus, error) bool) {
+		tok := ""
+		for {
+			pageCtx, cancel := withPageTimeout(ctx, pageTimeout)
+			rsp, err := a.client.ListVolumes(pageCtx, &csi.ListVolumesRequest{
+				StartingToken: tok,
+				MaxEntries:    a.maxEntries,
+			})
+			cancel()
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to list volumes: %v", err))
+				return
 			}
 
-			p[e.GetVolume().VolumeId] = e.GetStatus().GetPublishedNodeIds()
+			page := make(map[string]VolumeStatus, len(rsp.Entries))
+			for _, e := range rsp.Entries {
+				if e.GetVolume() == nil || e.GetStatus() == nil {
+					continue
+				}
+
+				page[e.GetVolume().VolumeId] = VolumeStatus{
+					PublishedNodeIDs: e.GetStatus().GetPublishedNodeIds(),
+					Condition:        e.GetStatus().GetVolumeCondition(),
+				}
+			}
+			if !yield(page, nil) {
+				return
+			}
+			tok = rsp.NextToken
+
+			if len(tok) == 0 {
+				return
+			}
 		}
-		tok = rsp.NextToken
+	}
+}
+
+// getVolumePageSize is the number of volumes CSIGetVolumeLister gets in a
+// single page.
+const getVolumePageSize = 100
+
+// CSIGetVolumeLister lists volumes using ControllerGetVolume. It is meant for
+// drivers that support GET_VOLUME, but not LIST_VOLUMES_PUBLISHED_NODES.
+type CSIGetVolumeLister struct {
+	client  csi.ControllerClient
+	workers int
+}
 
-		if len(tok) == 0 {
+// NewGetVolumeLister provides a new CSIGetVolumeLister object that issues at
+// most workers ControllerGetVolume calls in parallel.
+func NewGetVolumeLister(conn *grpc.ClientConn, workers int) *CSIGetVolumeLister {
+	if workers < 1 {
+		workers = 1
+	}
+	return &CSIGetVolumeLister{
+		client:  csi.NewControllerClient(conn),
+		workers: workers,
+	}
+}
+
+// ListVolumes calls ControllerGetVolume for each of given volumeIDs and
+// returns a map with keys of VolumeID and values of the volume status.
+// Volumes that the driver does not know are not included in the map. Any
+// other error fails the whole call.
+func (a *CSIGetVolumeLister) ListVolumes(ctx context.Context, volumeIDs []string) (map[string]VolumeStatus, error) {
+	return CollectVolumePages(a.ListVolumePages(ctx, volumeIDs, 0))
+}
+
+// ListVolumePages calls ControllerGetVolume for each of given volumeIDs and
+// returns the volumes in pages of at most getVolumePageSize volumes. All
+// ControllerGetVolume calls of a page share the pageTimeout. Volumes that the
+// driver does not know are not included in the pages.
+func (a *CSIGetVolumeLister) ListVolumePages(ctx context.Context, volumeIDs []string, pageTimeout time.Duration) VolumePages {
+	return func(yield func(map[string]VolumeStatus, error) bool) {
+		for ids := range slices.Chunk(volumeIDs, getVolumePageSize) {
+			pageCtx, cancel := withPageTimeout(ctx, pageTimeout)
+			page, err := a.getVolumes(pageCtx, ids)
+			cancel()
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// getVolumes calls ControllerGetVolume for each of given volumeIDs, with at
+// most a.workers calls in parallel. Any error other than NotFound fails the
+// whole call.
+func (a *CSIGetVolumeLister) getVolumes(ctx context.Context, volumeIDs []string) (map[string]VolumeStatus, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mux      sync.Mutex
+		p        = map[string]VolumeStatus{}
+		firstErr error
+	)
+	sem := make(chan struct{}, a.workers)
+	for _, volumeID := range volumeIDs {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			// A previous call failed, don't start any new ones.
+			<-sem
 			break
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rsp, err := a.client.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volumeID})
+			mux.Lock()
+			defer mux.Unlock()
+			if err != nil {
+				if status.Code(err) == codes.NotFound {
+					// The volume does not exist, it can't be published anywhere.
+					return
+				}
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to get volume %s: %v", volumeID, err)
+					cancel()
+				}
+				return
+			}
+			if rsp.GetVolume() == nil || rsp.GetStatus() == nil {
+				return
+			}
+			p[rsp.GetVolume().VolumeId] = VolumeStatus{
+				PublishedNodeIDs: rsp.GetStatus().GetPublishedNodeIds(),
+				Condition:        rsp.GetStatus().GetVolumeCondition(),
+			}
+		}()
 	}
+	wg.Wait()
 
+	if firstErr != nil {
+		return nil, firstErr
+	}
 	return p, nil
 }
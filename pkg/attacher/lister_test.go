@@ -0,0 +1,251 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func getVolumeResponse(volumeID string, nodeIDs ...string) *csi.ControllerGetVolumeResponse {
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: volumeID},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{PublishedNodeIds: nodeIDs},
+	}
+}
+
+func getVolumeResponseWithCondition(rsp *csi.ControllerGetVolumeResponse, abnormal bool, message string) *csi.ControllerGetVolumeResponse {
+	rsp.Status.VolumeCondition = &csi.VolumeCondition{Abnormal: abnormal, Message: message}
+	return rsp
+}
+
+func TestGetVolumeLister(t *testing.T) {
+	type getVolumeCall struct {
+		volumeID string
+		output   *csi.ControllerGetVolumeResponse
+		err      error
+	}
+	tests := []struct {
+		name           string
+		volumeIDs      []string
+		calls          []getVolumeCall
+		expectError    bool
+		expectedResult map[string]VolumeStatus
+	}{
+		{
+			name:           "no volumes",
+			expectedResult: map[string]VolumeStatus{},
+		},
+		{
+			name:      "success",
+			volumeIDs: []string{"vol1", "vol2", "vol3"},
+			calls: []getVolumeCall{
+				{"vol1", getVolumeResponse("vol1", "node1"), nil},
+				{"vol2", getVolumeResponse("vol2", "node1", "node2"), nil},
+				{"vol3", getVolumeResponse("vol3"), nil},
+			},
+			expectedResult: map[string]VolumeStatus{
+				"vol1": {PublishedNodeIDs: []string{"node1"}},
+				"vol2": {PublishedNodeIDs: []string{"node1", "node2"}},
+				"vol3": {},
+			},
+		},
+		{
+			name:      "volume condition",
+			volumeIDs: []string{"vol1"},
+			calls: []getVolumeCall{
+				{"vol1", getVolumeResponseWithCondition(getVolumeResponse("vol1", "node1"), true, "disk is degraded"), nil},
+			},
+			expectedResult: map[string]VolumeStatus{
+				"vol1": {
+					PublishedNodeIDs: []string{"node1"},
+					Condition:        &csi.VolumeCondition{Abnormal: true, Message: "disk is degraded"},
+				},
+			},
+		},
+		{
+			name:      "missing volume is skipped",
+			volumeIDs: []string{"vol1", "vol2"},
+			calls: []getVolumeCall{
+				{"vol1", getVolumeResponse("vol1", "node1"), nil},
+				{"vol2", nil, status.Error(codes.NotFound, "volume not found")},
+			},
+			expectedResult: map[string]VolumeStatus{
+				"vol1": {PublishedNodeIDs: []string{"node1"}},
+			},
+		},
+		{
+			name:      "error",
+			volumeIDs: []string{"vol1"},
+			calls: []getVolumeCall{
+				{"vol1", nil, status.Error(codes.Internal, "mock error")},
+			},
+			expectError: true,
+		},
+	}
+
+	tmpdir := tempDir(t)
+	defer os.RemoveAll(tmpdir)
+	mockController, driver, _, controllerServer, csiConn, err := createMockServer(t, tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockController.Finish()
+	defer driver.Stop()
+
+	for _, test := range tests {
+		for _, call := range test.calls {
+			controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), pbMatch(&csi.ControllerGetVolumeRequest{VolumeId: call.volumeID})).Return(call.output, call.err).Times(1)
+		}
+
+		l := NewGetVolumeLister(csiConn, 2)
+		result, err := l.ListVolumes(context.Background(), test.volumeIDs)
+		if test.expectError && err == nil {
+			t.Errorf("test %q: Expected error, got none", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("test %q: got error: %v", test.name, err)
+		}
+		if err == nil && !volumeStatusesEqual(result, test.expectedResult) {
+			t.Errorf("test %q: expected %+v, got %+v", test.name, test.expectedResult, result)
+		}
+	}
+}
+
+func volumeStatusesEqual(a, b map[string]VolumeStatus) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, statusA := range a {
+		statusB, found := b[id]
+		if !found || !slices.Equal(statusA.PublishedNodeIDs, statusB.PublishedNodeIDs) || !proto.Equal(statusA.Condition, statusB.Condition) {
+			return false
+		}
+	}
+	return true
+}
+
+func listVolumesResponse(nextToken string, volumeIDs ...string) *csi.ListVolumesResponse {
+	rsp := &csi.ListVolumesResponse{NextToken: nextToken}
+	for _, volumeID := range volumeIDs {
+		rsp.Entries = append(rsp.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{VolumeId: volumeID},
+			Status: &csi.ListVolumesResponse_VolumeStatus{PublishedNodeIds: []string{"node1"}},
+		})
+	}
+	return rsp
+}
+
+func TestVolumeListerPages(t *testing.T) {
+	type listVolumesCall struct {
+		startingToken string
+		output        *csi.ListVolumesResponse
+		err           error
+	}
+	tests := []struct {
+		name string
+		// stopAfter stops the iteration after the given number of pages.
+		// Zero means all pages are read.
+		stopAfter     int
+		calls         []listVolumesCall
+		expectedPages [][]string
+		expectError   bool
+	}{
+		{
+			name: "single page",
+			calls: []listVolumesCall{
+				{"", listVolumesResponse("", "vol1", "vol2"), nil},
+			},
+			expectedPages: [][]string{{"vol1", "vol2"}},
+		},
+		{
+			name: "multiple pages",
+			calls: []listVolumesCall{
+				{"", listVolumesResponse("token1", "vol1", "vol2"), nil},
+				{"token1", listVolumesResponse("token2", "vol3"), nil},
+				{"token2", listVolumesResponse("", "vol4"), nil},
+			},
+			expectedPages: [][]string{{"vol1", "vol2"}, {"vol3"}, {"vol4"}},
+		},
+		{
+			name:      "stop early",
+			stopAfter: 1,
+			calls: []listVolumesCall{
+				{"", listVolumesResponse("token1", "vol1", "vol2"), nil},
+			},
+			expectedPages: [][]string{{"vol1", "vol2"}},
+		},
+		{
+			name: "error on second page",
+			calls: []listVolumesCall{
+				{"", listVolumesResponse("token1", "vol1"), nil},
+				{"token1", nil, status.Error(codes.Internal, "mock error")},
+			},
+			expectedPages: [][]string{{"vol1"}},
+			expectError:   true,
+		},
+	}
+
+	tmpdir := tempDir(t)
+	defer os.RemoveAll(tmpdir)
+	mockController, driver, _, controllerServer, csiConn, err := createMockServer(t, tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockController.Finish()
+	defer driver.Stop()
+
+	for _, test := range tests {
+		for _, call := range test.calls {
+			controllerServer.EXPECT().ListVolumes(gomock.Any(), pbMatch(&csi.ListVolumesRequest{StartingToken: call.startingToken, MaxEntries: 2})).Return(call.output, call.err).Times(1)
+		}
+
+		l := NewVolumeLister(csiConn, 2)
+		var pages [][]string
+		var pageErr error
+		for page, err := range l.ListVolumePages(context.Background(), nil, time.Minute) {
+			if err != nil {
+				pageErr = err
+				break
+			}
+			pages = append(pages, slices.Sorted(maps.Keys(page)))
+			if len(pages) == test.stopAfter {
+				break
+			}
+		}
+		if test.expectError && pageErr == nil {
+			t.Errorf("test %q: Expected error, got none", test.name)
+		}
+		if !test.expectError && pageErr != nil {
+			t.Errorf("test %q: got error: %v", test.name, pageErr)
+		}
+		if !reflect.DeepEqual(pages, test.expectedPages) {
+			t.Errorf("test %q: expected pages %v, got %v", test.name, test.expectedPages, pages)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config implements the configuration file of the external-attacher.
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
+)
+
+const (
+	// APIVersion is the only supported version of the configuration file.
+	APIVersion = "attacher.csi.storage.k8s.io/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "AttacherConfiguration"
+)
+
+// Configuration is the content of the configuration file. Each field has
+// a command line option of the same meaning.
+type Configuration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// The following fields can be changed while the external-attacher runs.
+
+	Timeout                 metav1.Duration               `json:"timeout"`
+	RetryIntervalStart      metav1.Duration               `json:"retryIntervalStart"`
+	RetryIntervalMax        metav1.Duration               `json:"retryIntervalMax"`
+	RetryPolicy             *controller.RetryPolicyConfig `json:"retryPolicy,omitempty"`
+	ReconcileSync           metav1.Duration               `json:"reconcileSync"`
+	ReconcileBatchSize      int                           `json:"reconcileBatchSize"`
+	ReconcileMaxRequeues    int                           `json:"reconcileMaxRequeues"`
+	MaxAttachAttempts       int                           `json:"maxAttachAttempts"`
+	OrphanDetachGracePeriod metav1.Duration               `json:"orphanDetachGracePeriod"`
+
+	// The following fields are applied only when the external-attacher
+	// starts.
+
+	Resync                        metav1.Duration `json:"resync"`
+	WorkerThreads                 uint            `json:"workerThreads"`
+	MaxEntries                    int             `json:"maxEntries"`
+	GetVolumeWorkers              int             `json:"getVolumeWorkers"`
+	SecretCacheTTL                metav1.Duration `json:"secretCacheTTL"`
+	SecretNamespaces              []string        `json:"secretNamespaces,omitempty"`
+	MaxNodeOperations             int             `json:"maxNodeOperations"`
+	DefaultFSType                 string          `json:"defaultFSType"`
+	StorageClassPublishSecret     bool            `json:"storageClassPublishSecret"`
+	DefaultPublishSecretName      string          `json:"defaultPublishSecretName"`
+	DefaultPublishSecretNamespace string          `json:"defaultPublishSecretNamespace"`
+}
+
+// liveFields are JSON names of fields that are applied without a restart.
+var liveFields = []string{
+	"timeout",
+	"retryIntervalStart",
+	"retryIntervalMax",
+	"retryPolicy",
+	"reconcileSync",
+	"reconcileBatchSize",
+	"reconcileMaxRequeues",
+	"maxAttachAttempts",
+	"orphanDetachGracePeriod",
+}
+
+// Load reads a configuration file. Fields that are not in the file are taken
+// from defaults, usually values of the command line options.
+func Load(path string, defaults Configuration) (Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	config, err := Parse(data, defaults)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse parses content of a configuration file and validates it. Fields that
+// are not in the file are taken from defaults. A retry policy in the file
+// overrides the policy derived from the retry intervals.
+func Parse(data []byte, defaults Configuration) (Configuration, error) {
+	config := defaults
+	config.RetryPolicy = nil
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Configuration{}, err
+	}
+	if config.APIVersion != APIVersion || config.Kind != Kind {
+		return Configuration{}, fmt.Errorf("unsupported apiVersion %q and kind %q, expected %s %s", config.APIVersion, config.Kind, APIVersion, Kind)
+	}
+
+	if config.RetryPolicy != nil {
+		// Parse the policy again, this time over the default policy of
+		// the retry intervals in the file.
+		policy := controller.DefaultRetryPolicyConfig(config.RetryIntervalStart.Duration, config.RetryIntervalMax.Duration)
+		// Unmarshal reuses the backing array of slices.
+		policy.Rules = slices.Clone(policy.Rules)
+		wrapper := struct {
+			RetryPolicy *controller.RetryPolicyConfig `json:"retryPolicy"`
+		}{RetryPolicy: &policy}
+		if err := yaml.Unmarshal(data, &wrapper); err != nil {
+			return Configuration{}, err
+		}
+		config.RetryPolicy = &policy
+	}
+
+	if err := config.Validate(); err != nil {
+		return Configuration{}, err
+	}
+	return config, nil
+}
+
+// Validate checks that the configuration is valid.
+func (c *Configuration) Validate() error {
+	if c.Timeout.Duration <= 0 {
+		return fmt.Errorf("timeout must be greater than zero")
+	}
+	if c.RetryIntervalStart.Duration <= 0 {
+		return fmt.Errorf("retryIntervalStart must be greater than zero")
+	}
+	if c.RetryIntervalMax.Duration < c.RetryIntervalStart.Duration {
+		return fmt.Errorf("retryIntervalMax must not be smaller than retryIntervalStart")
+	}
+	if c.ReconcileSync.Duration <= 0 {
+		return fmt.Errorf("reconcileSync must be greater than zero")
+	}
+	if c.ReconcileBatchSize < 0 {
+		return fmt.Errorf("reconcileBatchSize must not be negative")
+	}
+	if c.ReconcileMaxRequeues < 0 {
+		return fmt.Errorf("reconcileMaxRequeues must not be negative")
+	}
+	if c.MaxAttachAttempts < 0 {
+		return fmt.Errorf("maxAttachAttempts must not be negative")
+	}
+	if c.OrphanDetachGracePeriod.Duration < 0 {
+		return fmt.Errorf("orphanDetachGracePeriod must not be negative")
+	}
+	if c.WorkerThreads == 0 {
+		return fmt.Errorf("workerThreads must be greater than zero")
+	}
+	if len(c.SecretNamespaces) > 0 && c.SecretCacheTTL.Duration <= 0 {
+		return fmt.Errorf("secretNamespaces require secretCacheTTL")
+	}
+	if slices.Contains(c.SecretNamespaces, "") {
+		return fmt.Errorf("secretNamespaces must not contain an empty namespace")
+	}
+	if (c.DefaultPublishSecretName == "") != (c.DefaultPublishSecretNamespace == "") {
+		return fmt.Errorf("defaultPublishSecretName and defaultPublishSecretNamespace must be set together")
+	}
+	if c.RetryPolicy != nil {
+		if _, err := controller.NewRetryPolicy(*c.RetryPolicy); err != nil {
+			return fmt.Errorf("invalid retryPolicy: %w", err)
+		}
+	}
+	return nil
+}
+
+// RestartRequired returns JSON names of fields that differ between old and
+// new configuration and that are applied only when the external-attacher
+// starts.
+func RestartRequired(old, new *Configuration) []string {
+	var fields []string
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	t := oldValue.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if slices.Contains(liveFields, name) {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/controller"
+)
+
+func defaultConfiguration() Configuration {
+	return Configuration{
+		Timeout:            metav1.Duration{Duration: 15 * time.Second},
+		RetryIntervalStart: metav1.Duration{Duration: time.Second},
+		RetryIntervalMax:   metav1.Duration{Duration: 5 * time.Minute},
+		ReconcileSync:      metav1.Duration{Duration: time.Minute},
+		Resync:             metav1.Duration{Duration: 10 * time.Minute},
+		WorkerThreads:      10,
+		GetVolumeWorkers:   10,
+	}
+}
+
+func TestParse(t *testing.T) {
+	typeMeta := metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind}
+
+	tests := []struct {
+		name           string
+		content        string
+		expectedConfig func() Configuration
+		expectError    bool
+	}{
+		{
+			name: "only type",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+`,
+			expectedConfig: func() Configuration {
+				c := defaultConfiguration()
+				c.TypeMeta = typeMeta
+				return c
+			},
+		},
+		{
+			name: "fields override defaults",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+timeout: 1m
+retryIntervalMax: 10m
+workerThreads: 20
+defaultFSType: xfs
+maxAttachAttempts: 5
+`,
+			expectedConfig: func() Configuration {
+				c := defaultConfiguration()
+				c.TypeMeta = typeMeta
+				c.Timeout.Duration = time.Minute
+				c.RetryIntervalMax.Duration = 10 * time.Minute
+				c.WorkerThreads = 20
+				c.DefaultFSType = "xfs"
+				c.MaxAttachAttempts = 5
+				return c
+			},
+		},
+		{
+			name: "retry policy uses intervals from the file",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+retryIntervalStart: 2s
+retryPolicy:
+  default:
+    maxDelay: 1h
+`,
+			expectedConfig: func() Configuration {
+				c := defaultConfiguration()
+				c.TypeMeta = typeMeta
+				c.RetryIntervalStart.Duration = 2 * time.Second
+				policy := controller.DefaultRetryPolicyConfig(2*time.Second, 5*time.Minute)
+				policy.Default.MaxDelay.Duration = time.Hour
+				c.RetryPolicy = &policy
+				return c
+			},
+		},
+		{
+			name: "missing type",
+			content: `
+timeout: 1m
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported version",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1
+kind: AttacherConfiguration
+`,
+			expectError: true,
+		},
+		{
+			name: "unknown field",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+workers: 10
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid value",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+workerThreads: 0
+`,
+			expectError: true,
+		},
+		{
+			name: "secret namespaces",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+secretCacheTTL: 1m
+secretNamespaces: [kube-system, storage]
+`,
+			expectedConfig: func() Configuration {
+				c := defaultConfiguration()
+				c.TypeMeta = typeMeta
+				c.SecretCacheTTL.Duration = time.Minute
+				c.SecretNamespaces = []string{"kube-system", "storage"}
+				return c
+			},
+		},
+		{
+			name: "secret namespaces without secret cache",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+secretNamespaces: [kube-system]
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid retry policy",
+			content: `
+apiVersion: attacher.csi.storage.k8s.io/v1alpha1
+kind: AttacherConfiguration
+retryPolicy:
+  rules:
+  - codes: [Throttled]
+    initialDelay: 1s
+    maxDelay: 1m
+`,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Parse([]byte(test.content), defaultConfiguration())
+			if err != nil && !test.expectError {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && test.expectError {
+				t.Errorf("expected error, got none")
+			}
+			if err == nil && !reflect.DeepEqual(config, test.expectedConfig()) {
+				t.Errorf("expected config %+v, got %+v", test.expectedConfig(), config)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := defaultConfiguration()
+
+	live := old
+	live.Timeout.Duration = time.Hour
+	live.ReconcileSync.Duration = time.Hour
+	live.MaxAttachAttempts = 3
+	live.OrphanDetachGracePeriod.Duration = time.Hour
+	live.ReconcileBatchSize = 100
+	live.ReconcileMaxRequeues = 10
+	policy := controller.DefaultRetryPolicyConfig(time.Second, time.Minute)
+	live.RetryPolicy = &policy
+	if fields := RestartRequired(&old, &live); len(fields) != 0 {
+		t.Errorf("expected no fields that require restart, got %v", fields)
+	}
+
+	restart := live
+	restart.WorkerThreads = 1
+	restart.DefaultFSType = "xfs"
+	expected := []string{"workerThreads", "defaultFSType"}
+	if fields := RestartRequired(&old, &restart); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected fields %v, got %v", expected, fields)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		// Replace the file by a rename, as kubelet does with ConfigMaps.
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write configuration: %s", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatalf("failed to rename configuration: %s", err)
+		}
+	}
+	header := "apiVersion: attacher.csi.storage.k8s.io/v1alpha1\nkind: AttacherConfiguration\n"
+	writeConfig(header + "timeout: 1m\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan Configuration, 10)
+	if err := Watch(ctx, path, defaultConfiguration(), func(c Configuration) { changes <- c }); err != nil {
+		t.Fatalf("failed to watch configuration: %s", err)
+	}
+
+	// Invalid configuration is ignored.
+	writeConfig(header + "timeout: 0s\n")
+	writeConfig(header + "timeout: 2m\n")
+
+	select {
+	case c := <-changes:
+		if c.Timeout.Duration != 2*time.Minute {
+			t.Errorf("expected timeout 2m, got %s", c.Timeout.Duration)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("configuration change was not detected")
+	}
+}
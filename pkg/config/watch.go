@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// Watch watches the configuration file and calls onChange with the new
+// configuration each time content of the file changes. Invalid
+// configurations are logged and ignored. The directory of the file is
+// watched instead of the file itself, so files replaced by a rename, such
+// as ConfigMap volumes, are watched too.
+func Watch(ctx context.Context, path string, defaults Configuration, onChange func(Configuration)) error {
+	logger := klog.FromContext(ctx).WithValues("config", path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error(err, "Failed to watch configuration file")
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				newContent, err := os.ReadFile(path)
+				if err != nil {
+					// The file may be replaced right now, wait for
+					// the next event.
+					logger.V(4).Info("Failed to read configuration file", "err", err)
+					continue
+				}
+				if bytes.Equal(content, newContent) {
+					continue
+				}
+				content = newContent
+				config, err := Parse(content, defaults)
+				if err != nil {
+					logger.Error(err, "Ignoring invalid configuration file")
+					continue
+				}
+				logger.Info("Configuration file changed")
+				onChange(config)
+			}
+		}
+	}()
+	return nil
+}
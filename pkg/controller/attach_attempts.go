@@ -0,0 +1,164 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/klog/v2"
+)
+
+// errAttachStopped is returned by syncAttach when the attacher stopped
+// attaching the VolumeAttachment after the maximum number of attempts. The
+// VolumeAttachment is not re-queued and keeps its last attach error.
+var errAttachStopped = errors.New("attach stopped after the maximum number of attempts")
+
+// attachAttempts counts failed attach attempts of VolumeAttachments. The
+// counts are kept only in memory, they start from zero after a restart.
+type attachAttempts struct {
+	// limit is the maximum number of attempts. Zero means no limit.
+	limit int
+
+	mux      sync.Mutex
+	failures map[string]int
+}
+
+func newAttachAttempts(limit int) *attachAttempts {
+	return &attachAttempts{
+		limit:    limit,
+		failures: map[string]int{},
+	}
+}
+
+// failed records a failed attempt of the VolumeAttachment and returns true
+// when the VolumeAttachment reached the limit. The count is reset then.
+func (a *attachAttempts) failed(vaName string) bool {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.failures[vaName]++
+	if a.limit > 0 && a.failures[vaName] >= a.limit {
+		delete(a.failures, vaName)
+		return true
+	}
+	return false
+}
+
+// getLimit returns the maximum number of attempts.
+func (a *attachAttempts) getLimit() int {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.limit
+}
+
+// setLimit changes the maximum number of attempts. VolumeAttachments that
+// already reached the new limit are stopped after their next failure.
+func (a *attachAttempts) setLimit(limit int) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.limit = limit
+}
+
+// get returns the number of failed attempts of the VolumeAttachment.
+func (a *attachAttempts) get(vaName string) int {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.failures[vaName]
+}
+
+// reset forgets all failed attempts of the VolumeAttachment.
+func (a *attachAttempts) reset(vaName string) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	delete(a.failures, vaName)
+}
+
+// attachSpecHash returns a hash of the VolumeAttachment spec and of the spec
+// of its PersistentVolume. The hash is stored in the stopped annotation to
+// find out that any of them has changed since the attacher stopped attaching
+// the volume.
+func (h *csiHandler) attachSpecHash(va *storage.VolumeAttachment) (string, error) {
+	var pvSpec *v1.PersistentVolumeSpec
+	if va.Spec.Source.PersistentVolumeName != nil {
+		// A missing PV has nil spec, the hash changes when the PV is
+		// created.
+		if pv, err := h.pvLister.Get(*va.Spec.Source.PersistentVolumeName); err == nil {
+			pvSpec = &pv.Spec
+		}
+	}
+	data, err := json.Marshal([]any{va.Spec, pvSpec})
+	if err != nil {
+		return "", err
+	}
+	hash := fnv.New32a()
+	hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32()), nil
+}
+
+// attachStopped returns true when the attacher stopped attaching the
+// VolumeAttachment after the maximum number of attempts and neither the
+// VolumeAttachment nor its PersistentVolume has changed since then.
+func (h *csiHandler) attachStopped(va *storage.VolumeAttachment) (bool, error) {
+	stoppedHash, found := va.Annotations[vaAttachStoppedAnnotation]
+	if !found {
+		return false, nil
+	}
+	if h.attachAttempts.getLimit() <= 0 {
+		// The limit was disabled.
+		return false, nil
+	}
+	if _, found := va.Annotations[vaAttachRetryAnnotation]; found {
+		// Explicit retry requested by the user.
+		return false, nil
+	}
+	hash, err := h.attachSpecHash(va)
+	if err != nil {
+		return false, err
+	}
+	return hash == stoppedHash, nil
+}
+
+// stopAttach marks the VolumeAttachment as stopped after the last failed
+// attach attempt. It returns errAttachStopped wrapping the attach error, or
+// the attach error alone when the VolumeAttachment cannot be marked and the
+// attach must be retried.
+func (h *csiHandler) stopAttach(ctx context.Context, va *storage.VolumeAttachment, attachErr error) error {
+	logger := klog.FromContext(ctx)
+	limit := h.attachAttempts.getLimit()
+	hash, err := h.attachSpecHash(va)
+	if err != nil {
+		return fmt.Errorf("failed to attach: %w", attachErr)
+	}
+	annotations := map[string]string{
+		vaAttachStoppedAnnotation: hash,
+		vaAttachRetryAnnotation:   "",
+	}
+	if _, err := h.saveAnnotations(ctx, va, annotations); err != nil {
+		logger.V(2).Info("Failed to save attach stopped annotation to VolumeAttachment", "err", err)
+		return fmt.Errorf("failed to attach: %w", attachErr)
+	}
+	logger.V(2).Info("Stopped attaching after the maximum number of attempts", "attempts", limit)
+	h.recordEvent(va, v1.EventTypeWarning, reasonAttachStopped, fmt.Sprintf("Stopped attaching volume %q to node %q after %d failed attempts, add annotation %q to retry", getVolumeName(va), va.Spec.NodeName, limit, vaAttachRetryAnnotation))
+	attachStopped.WithLabelValues(h.attacherName).Inc()
+	return fmt.Errorf("%w: %w", errAttachStopped, attachErr)
+}
@@ -42,6 +42,17 @@ import (
 
 const (
 	annMigratedTo = "pv.kubernetes.io/migrated-to"
+
+	// Names of VolumeAttachment informer indexes.
+	vaByPVNameIndex             = "ByPersistentVolumeName"
+	vaByNodeNameIndex           = "ByNodeName"
+	vaByAttacherIndex           = "ByAttacher"
+	vaByInlineVolumeHandleIndex = "ByInlineVolumeHandle"
+	vaByInlineSecretIndex       = "ByInlineControllerPublishSecret"
+
+	// Names of PersistentVolume informer indexes.
+	pvByVolumeHandleIndex = "ByVolumeHandle"
+	pvBySecretIndex       = "ByControllerPublishSecret"
 )
 
 // CSIAttachController is a controller that attaches / detaches CSI volumes using provided Handler interface
@@ -51,15 +62,27 @@ type CSIAttachController struct {
 	handler      Handler
 	vaQueue      workqueue.TypedRateLimitingInterface[string]
 	pvQueue      workqueue.TypedRateLimitingInterface[string]
+	// vaTrackedQueue and pvTrackedQueue are the same queues as vaQueue and
+	// pvQueue, they report their items on the debug endpoint.
+	vaTrackedQueue *trackedQueue
+	pvTrackedQueue *trackedQueue
 
 	vaLister       storagelisters.VolumeAttachmentLister
 	vaListerSynced cache.InformerSynced
+	vaIndexer      cache.Indexer
 	pvLister       corelisters.PersistentVolumeLister
 	pvListerSynced cache.InformerSynced
+	// handlerSynced are informers of the handler that must be synced
+	// before VolumeAttachments are processed.
+	handlerSynced []cache.InformerSynced
 
 	shouldReconcileVolumeAttachment bool
 	reconcileSync                   time.Duration
+	reconcileSyncMux                sync.Mutex
+	reconcileSyncChanged            chan struct{}
 	translator                      AttacherCSITranslator
+	// shard is nil when sharding is disabled.
+	shard Shard
 }
 
 // Handler is responsible for handling VolumeAttachment events from informer.
@@ -78,6 +101,36 @@ type Handler interface {
 	SyncNewOrUpdatedPersistentVolume(ctx context.Context, pv *v1.PersistentVolume)
 
 	ReconcileVA(ctx context.Context) error
+
+	// UpdateSettings changes settings of the handler while it runs.
+	UpdateSettings(settings HandlerSettings)
+
+	// SetShard limits the handler to VolumeAttachments of the shard of
+	// this replica. It is called before the handler starts.
+	SetShard(shard Shard)
+}
+
+// HandlerSettings are settings of a Handler that can be changed while the
+// handler runs.
+type HandlerSettings struct {
+	// Timeout of CSI calls.
+	Timeout time.Duration
+	// MaxRetryDelay is the maximum delay of a retry requested by the CSI
+	// driver. Zero means no limit.
+	MaxRetryDelay time.Duration
+	// MaxAttachAttempts is the maximum number of failed attach attempts of
+	// a VolumeAttachment. Zero means no limit.
+	MaxAttachAttempts int
+	// OrphanDetachGracePeriod is the time after which a volume published
+	// by the CSI driver on a node without a VolumeAttachment is detached.
+	// Zero means such volumes are only reported.
+	OrphanDetachGracePeriod time.Duration
+	// ReconcileBatchSize is the maximum number of VolumeAttachments checked
+	// by a single reconciliation. Zero means no limit.
+	ReconcileBatchSize int
+	// ReconcileMaxRequeues is the maximum number of VolumeAttachments
+	// requeued by a single reconciliation. Zero means no limit.
+	ReconcileMaxRequeues int
 }
 
 // NewCSIAttachController returns a new *CSIAttachController
@@ -92,14 +145,19 @@ func NewCSIAttachController(
 	shouldReconcileVolumeAttachment bool,
 	reconcileSync time.Duration,
 ) *CSIAttachController {
+	vaQueue := newTrackedQueue(vaRateLimiter, "csi-attacher-va")
+	pvQueue := newTrackedQueue(paRateLimiter, "csi-attacher-pv")
 	ctrl := &CSIAttachController{
 		client:                          client,
 		attacherName:                    attacherName,
 		handler:                         handler,
-		vaQueue:                         workqueue.NewTypedRateLimitingQueueWithConfig(vaRateLimiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: "csi-attacher-va"}),
-		pvQueue:                         workqueue.NewTypedRateLimitingQueueWithConfig(paRateLimiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: "csi-attacher-pv"}),
+		vaQueue:                         vaQueue,
+		pvQueue:                         pvQueue,
+		vaTrackedQueue:                  vaQueue,
+		pvTrackedQueue:                  pvQueue,
 		shouldReconcileVolumeAttachment: shouldReconcileVolumeAttachment,
 		reconcileSync:                   reconcileSync,
+		reconcileSyncChanged:            make(chan struct{}, 1),
 		translator:                      csitrans.New(),
 	}
 
@@ -108,14 +166,21 @@ func NewCSIAttachController(
 		UpdateFunc: ctrl.vaUpdatedFunc(logger),
 		DeleteFunc: ctrl.vaDeleted,
 	})
+	if err := addIndexers(volumeAttachmentInformer.Informer(), vaIndexers()); err != nil {
+		logger.Error(err, "Failed to add VolumeAttachment indexers")
+	}
 	ctrl.vaLister = volumeAttachmentInformer.Lister()
 	ctrl.vaListerSynced = volumeAttachmentInformer.Informer().HasSynced
+	ctrl.vaIndexer = volumeAttachmentInformer.Informer().GetIndexer()
 
 	pvInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    ctrl.pvAdded,
 		UpdateFunc: ctrl.pvUpdated,
 		//DeleteFunc: ctrl.pvDeleted, TODO: do we need this?
 	})
+	if err := addIndexers(pvInformer.Informer(), pvIndexers(logger, ctrl.translator)); err != nil {
+		logger.Error(err, "Failed to add PersistentVolume indexers")
+	}
 	ctrl.pvLister = pvInformer.Lister()
 	ctrl.pvListerSynced = pvInformer.Informer().HasSynced
 	ctrl.handler.Init(ctrl.vaQueue, ctrl.pvQueue)
@@ -123,6 +188,133 @@ func NewCSIAttachController(
 	return ctrl
 }
 
+// vaIndexers returns indexes of VolumeAttachments by PersistentVolume name,
+// node name, attacher and volume handle and ControllerPublish secret of
+// inline volumes.
+func vaIndexers() cache.Indexers {
+	return cache.Indexers{
+		vaByPVNameIndex:             vaByPVNameIndexFunc,
+		vaByNodeNameIndex:           vaByNodeNameIndexFunc,
+		vaByAttacherIndex:           vaByAttacherIndexFunc,
+		vaByInlineVolumeHandleIndex: vaByInlineVolumeHandleIndexFunc,
+		vaByInlineSecretIndex:       vaByInlineSecretIndexFunc,
+	}
+}
+
+// pvIndexers returns indexes of PersistentVolumes by CSI volume handle and
+// ControllerPublish secret. Migratable in-tree PVs are indexed by the handle
+// of the translated volume.
+func pvIndexers(logger klog.Logger, translator AttacherCSITranslator) cache.Indexers {
+	return cache.Indexers{
+		pvByVolumeHandleIndex: pvByVolumeHandleIndexFunc(logger, translator),
+		pvBySecretIndex:       pvBySecretIndexFunc,
+	}
+}
+
+// addIndexers adds given indexes to the informer. Indexes that already exist
+// (e.g. when the informer is shared) are left untouched.
+func addIndexers(informer cache.SharedIndexInformer, indexers cache.Indexers) error {
+	existing := informer.GetIndexer().GetIndexers()
+	missing := cache.Indexers{}
+	for name, indexFunc := range indexers {
+		if _, found := existing[name]; !found {
+			missing[name] = indexFunc
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return informer.AddIndexers(missing)
+}
+
+func vaByPVNameIndexFunc(obj any) ([]string, error) {
+	va, ok := obj.(*storage.VolumeAttachment)
+	if !ok || va.Spec.Source.PersistentVolumeName == nil {
+		return nil, nil
+	}
+	return []string{*va.Spec.Source.PersistentVolumeName}, nil
+}
+
+func vaByNodeNameIndexFunc(obj any) ([]string, error) {
+	va, ok := obj.(*storage.VolumeAttachment)
+	if !ok {
+		return nil, nil
+	}
+	return []string{va.Spec.NodeName}, nil
+}
+
+func vaByAttacherIndexFunc(obj any) ([]string, error) {
+	va, ok := obj.(*storage.VolumeAttachment)
+	if !ok {
+		return nil, nil
+	}
+	return []string{va.Spec.Attacher}, nil
+}
+
+func vaByInlineVolumeHandleIndexFunc(obj any) ([]string, error) {
+	va, ok := obj.(*storage.VolumeAttachment)
+	if !ok || va.Spec.Source.InlineVolumeSpec == nil || va.Spec.Source.InlineVolumeSpec.CSI == nil {
+		return nil, nil
+	}
+	return []string{va.Spec.Source.InlineVolumeSpec.CSI.VolumeHandle}, nil
+}
+
+func vaByInlineSecretIndexFunc(obj any) ([]string, error) {
+	va, ok := obj.(*storage.VolumeAttachment)
+	if !ok || va.Spec.Source.InlineVolumeSpec == nil || va.Spec.Source.InlineVolumeSpec.CSI == nil {
+		return nil, nil
+	}
+	return secretIndexValues(va.Spec.Source.InlineVolumeSpec.CSI.ControllerPublishSecretRef), nil
+}
+
+func pvBySecretIndexFunc(obj any) ([]string, error) {
+	pv, ok := obj.(*v1.PersistentVolume)
+	if !ok || pv.Spec.CSI == nil {
+		return nil, nil
+	}
+	return secretIndexValues(pv.Spec.CSI.ControllerPublishSecretRef), nil
+}
+
+func secretIndexValues(ref *v1.SecretReference) []string {
+	if ref == nil {
+		return nil
+	}
+	return []string{secretKey(ref.Namespace, ref.Name)}
+}
+
+func secretKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func pvByVolumeHandleIndexFunc(logger klog.Logger, translator AttacherCSITranslator) cache.IndexFunc {
+	return func(obj any) ([]string, error) {
+		pv, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			return nil, nil
+		}
+		if translator.IsPVMigratable(pv) {
+			translated, err := translator.TranslateInTreePVToCSI(logger, pv)
+			if err != nil {
+				// Index functions must not fail, the PV is just not indexed.
+				logger.V(4).Info("Failed to translate PV for indexing", "PersistentVolume", klog.KObj(pv), "err", err)
+				return nil, nil
+			}
+			pv = translated
+		}
+		if pv.Spec.CSI == nil {
+			return nil, nil
+		}
+		return []string{pv.Spec.CSI.VolumeHandle}, nil
+	}
+}
+
+// AddCacheSync adds informers that Run waits for before it starts processing
+// VolumeAttachments, such as informers whose listers the handler uses. It must
+// be called before Run.
+func (ctrl *CSIAttachController) AddCacheSync(synced ...cache.InformerSynced) {
+	ctrl.handlerSynced = append(ctrl.handlerSynced, synced...)
+}
+
 // Run starts CSI attacher and listens on channel events
 func (ctrl *CSIAttachController) Run(ctx context.Context, workers int, wg *sync.WaitGroup) {
 	defer ctrl.vaQueue.ShutDown()
@@ -132,7 +324,8 @@ func (ctrl *CSIAttachController) Run(ctx context.Context, workers int, wg *sync.
 	logger.Info("Starting CSI attacher")
 	defer logger.Info("Shutting CSI attacher")
 
-	if !cache.WaitForCacheSync(ctx.Done(), ctrl.vaListerSynced, ctrl.pvListerSynced) {
+	synced := append([]cache.InformerSynced{ctrl.vaListerSynced, ctrl.pvListerSynced}, ctrl.handlerSynced...)
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
 		logger.Error(nil, "Cannot sync caches")
 		return
 	}
@@ -154,12 +347,7 @@ func (ctrl *CSIAttachController) Run(ctx context.Context, workers int, wg *sync.
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				wait.UntilWithContext(ctx, func(ctx context.Context) {
-					err := ctrl.handler.ReconcileVA(ctx)
-					if err != nil {
-						logger.Error(err, "Failed to reconcile VolumeAttachment")
-					}
-				}, ctrl.reconcileSync)
+				ctrl.reconcileVAs(ctx)
 			}()
 		}
 	} else {
@@ -169,18 +357,67 @@ func (ctrl *CSIAttachController) Run(ctx context.Context, workers int, wg *sync.
 		}
 
 		if ctrl.shouldReconcileVolumeAttachment {
-			go wait.UntilWithContext(ctx, func(ctx context.Context) {
-				err := ctrl.handler.ReconcileVA(ctx)
-				if err != nil {
-					logger.Error(err, "Failed to reconcile VolumeAttachment")
-				}
-			}, ctrl.reconcileSync)
+			go ctrl.reconcileVAs(ctx)
 		}
 	}
 
 	<-ctx.Done()
 }
 
+// reconcileVAs reconciles VolumeAttachments with the actual state reported by
+// the CSI driver every reconcileSync, until ctx is done.
+func (ctrl *CSIAttachController) reconcileVAs(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	for ctx.Err() == nil {
+		if err := ctrl.handler.ReconcileVA(ctx); err != nil {
+			logger.Error(err, "Failed to reconcile VolumeAttachment")
+		}
+		if !ctrl.waitForReconcile(ctx) {
+			return
+		}
+	}
+}
+
+// waitForReconcile waits for the next reconciliation. When reconcileSync
+// changes, it starts waiting again with the new interval. It returns false
+// when ctx is done.
+func (ctrl *CSIAttachController) waitForReconcile(ctx context.Context) bool {
+	for {
+		timer := time.NewTimer(ctrl.getReconcileSync())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+			return true
+		case <-ctrl.reconcileSyncChanged:
+			timer.Stop()
+		}
+	}
+}
+
+// SetReconcileSync changes the interval of VolumeAttachment reconciliation.
+func (ctrl *CSIAttachController) SetReconcileSync(reconcileSync time.Duration) {
+	ctrl.reconcileSyncMux.Lock()
+	defer ctrl.reconcileSyncMux.Unlock()
+	if ctrl.reconcileSync == reconcileSync {
+		return
+	}
+	ctrl.reconcileSync = reconcileSync
+	select {
+	case ctrl.reconcileSyncChanged <- struct{}{}:
+	default:
+		// The previous change was not consumed yet, the new interval is
+		// read when it is.
+	}
+}
+
+func (ctrl *CSIAttachController) getReconcileSync() time.Duration {
+	ctrl.reconcileSyncMux.Lock()
+	defer ctrl.reconcileSyncMux.Unlock()
+	return ctrl.reconcileSync
+}
+
 // vaAdded reacts to a VolumeAttachment creation
 func (ctrl *CSIAttachController) vaAdded(obj any) {
 	va := obj.(*storage.VolumeAttachment)
@@ -223,13 +460,38 @@ func (ctrl *CSIAttachController) pvAdded(obj any) {
 
 // pvUpdated reacts to a PV update
 func (ctrl *CSIAttachController) pvUpdated(old, new any) {
+	oldPV := old.(*v1.PersistentVolume)
 	pv := new.(*v1.PersistentVolume)
+	if !equality.Semantic.DeepEqual(oldPV.Spec, pv.Spec) {
+		ctrl.enqueueStoppedVAs(pv)
+	}
 	if !ctrl.processFinalizers(pv) {
 		return
 	}
 	ctrl.pvQueue.Add(pv.Name)
 }
 
+// enqueueStoppedVAs enqueues VolumeAttachments of the PV that the handler
+// stopped attaching after the maximum number of attempts, so they are
+// attached again with the new PV.
+func (ctrl *CSIAttachController) enqueueStoppedVAs(pv *v1.PersistentVolume) {
+	logger := klog.Background().WithValues("PersistentVolume", klog.KObj(pv))
+	vas, err := listVAsByIndex(ctrl.vaIndexer, vaByPVNameIndex, pv.Name)
+	if err != nil {
+		logger.Error(err, "Failed to list VolumeAttachments by PersistentVolume")
+		return
+	}
+	for _, va := range vas {
+		if va.Spec.Attacher != ctrl.attacherName {
+			continue
+		}
+		if _, found := va.Annotations[vaAttachStoppedAnnotation]; found {
+			logger.V(4).Info("PersistentVolume changed, re-queuing stopped VolumeAttachment", "VolumeAttachment", klog.KObj(va))
+			ctrl.vaQueue.Add(va.Name)
+		}
+	}
+}
+
 // syncVA deals with one key off the queue.  It returns false when it's time to quit.
 func (ctrl *CSIAttachController) syncVA(ctx context.Context) {
 	vaName, quit := ctrl.vaQueue.Get()
@@ -237,6 +499,8 @@ func (ctrl *CSIAttachController) syncVA(ctx context.Context) {
 		return
 	}
 	defer ctrl.vaQueue.Done(vaName)
+	ctx, span := startSpan(ctx, "syncVA", attrVolumeAttachment.String(vaName))
+	defer span.End()
 
 	logger := klog.LoggerWithValues(klog.FromContext(ctx), "VolumeAttachment", vaName)
 	ctx = klog.NewContext(ctx, logger)
@@ -258,6 +522,16 @@ func (ctrl *CSIAttachController) syncVA(ctx context.Context) {
 		logger.V(4).Info("Skipping VolumeAttachment for attacher", "attacher", va.Spec.Attacher)
 		return
 	}
+	if ctrl.shard != nil {
+		if !ctrl.shard.Acquire(va.Spec.NodeName) {
+			// It is processed by another replica. It is queued again
+			// when the shard changes.
+			logger.V(4).Info("Skipping VolumeAttachment of another shard", "node", va.Spec.NodeName)
+			ctrl.vaQueue.Forget(vaName)
+			return
+		}
+		defer ctrl.shard.Release(va.Spec.NodeName)
+	}
 	ctrl.handler.SyncNewOrUpdatedVolumeAttachment(ctx, va)
 }
 
@@ -289,6 +563,8 @@ func (ctrl *CSIAttachController) syncPV(ctx context.Context) {
 		return
 	}
 	defer ctrl.pvQueue.Done(pvName)
+	ctx, span := startSpan(ctx, "syncPV", attrPersistentVolume.String(pvName))
+	defer span.End()
 
 	logger := klog.LoggerWithValues(klog.FromContext(ctx), "PersistentVolume", pvName)
 	ctx = klog.NewContext(ctx, logger)
@@ -306,32 +582,47 @@ func (ctrl *CSIAttachController) syncPV(ctx context.Context) {
 		ctrl.pvQueue.AddRateLimited(pvName)
 		return
 	}
+	if ctrl.shard != nil {
+		if !ctrl.shard.Acquire(pvName) {
+			logger.V(4).Info("Skipping PersistentVolume of another shard")
+			ctrl.pvQueue.Forget(pvName)
+			return
+		}
+		defer ctrl.shard.Release(pvName)
+	}
 	ctrl.handler.SyncNewOrUpdatedPersistentVolume(ctx, pv)
 }
 
 // shouldEnqueueVAChange checks if a changed VolumeAttachment should be enqueued.
-// It filters out changes in Status.Attach/DetachError - these were posted by the controller
-// just few moments ago. If they were enqueued, Attach()/Detach() would be called again,
+// It filters out changes in Status.Attach/DetachError and in annotations
+// owned by the controller - these were posted by the controller just few
+// moments ago. If they were enqueued, Attach()/Detach() would be called again,
 // breaking exponential backoff.
 func shouldEnqueueVAChange(old, new *storage.VolumeAttachment) bool {
 	if old.ResourceVersion == new.ResourceVersion {
 		// This is most probably periodic sync, enqueue it
 		return true
 	}
-	if new.Status.AttachError == nil && new.Status.DetachError == nil && old.Status.AttachError == nil && old.Status.DetachError == nil {
-		// The difference between old and new must be elsewhere than Status.Attach/DetachError
-		return true
-	}
 
 	sanitized := new.DeepCopy()
 	sanitized.ResourceVersion = old.ResourceVersion
 	sanitized.Status.AttachError = old.Status.AttachError
 	sanitized.Status.DetachError = old.Status.DetachError
 	sanitized.ManagedFields = old.ManagedFields
+	for _, annotation := range controllerAnnotations {
+		if value, found := old.Annotations[annotation]; found {
+			if sanitized.Annotations == nil {
+				sanitized.Annotations = map[string]string{}
+			}
+			sanitized.Annotations[annotation] = value
+		} else {
+			delete(sanitized.Annotations, annotation)
+		}
+	}
 
 	if equality.Semantic.DeepEqual(old, sanitized) {
-		// The objects are the same except Status.Attach/DetachError.
-		// Don't enqueue them.
+		// The objects are the same except Status.Attach/DetachError and
+		// annotations of the controller. Don't enqueue them.
 		return false
 	}
 	return true
@@ -17,12 +17,20 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"reflect"
+	"sort"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	csitrans "k8s.io/csi-translation-lib"
+	"k8s.io/klog/v2"
 )
 
 func TestShouldEnqueueVAChange(t *testing.T) {
@@ -73,6 +81,21 @@ func TestShouldEnqueueVAChange(t *testing.T) {
 		Time:    metav1.Time{},
 	}
 
+	va2ChangedErrorReason := va1.DeepCopy()
+	va2ChangedErrorReason.ResourceVersion = "2"
+	va2ChangedErrorReason.Annotations = map[string]string{
+		vaAttachErrorReasonAnnotation: string(ErrorReasonFinal),
+		vaDetachedAnnotation:          "true",
+	}
+
+	va3RemovedErrorReason := va2ChangedErrorReason.DeepCopy()
+	va3RemovedErrorReason.ResourceVersion = "3"
+	va3RemovedErrorReason.Annotations = map[string]string{}
+
+	va3AddedAttachRetry := va2ChangedErrorReason.DeepCopy()
+	va3AddedAttachRetry.ResourceVersion = "3"
+	va3AddedAttachRetry.Annotations[vaAttachRetryAnnotation] = "true"
+
 	va2AppendManagedFields := va1.DeepCopy()
 	va2AppendManagedFields.ResourceVersion = "2"
 	va2AppendManagedFields.ManagedFields = append(va2AppendManagedFields.ManagedFields,
@@ -133,6 +156,24 @@ func TestShouldEnqueueVAChange(t *testing.T) {
 			newVA:          va2ChangedDetachError,
 			expectedResult: false,
 		},
+		{
+			name:           "added controller annotations",
+			oldVA:          va1,
+			newVA:          va2ChangedErrorReason,
+			expectedResult: false,
+		},
+		{
+			name:           "removed controller annotations",
+			oldVA:          va2ChangedErrorReason,
+			newVA:          va3RemovedErrorReason,
+			expectedResult: false,
+		},
+		{
+			name:           "added attach retry annotation",
+			oldVA:          va2ChangedErrorReason,
+			newVA:          va3AddedAttachRetry,
+			expectedResult: true,
+		},
 		{
 			name:           "appended managedFields",
 			oldVA:          va1,
@@ -243,3 +284,228 @@ func TestProcessFinalizers(t *testing.T) {
 		}
 	}
 }
+
+func TestVAIndexers(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(nil, &storage.VolumeAttachment{}, 0, cache.Indexers{})
+	if err := addIndexers(informer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	// Adding the indexers for the second time must be a no-op.
+	if err := addIndexers(informer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers for the second time: %v", err)
+	}
+
+	indexer := informer.GetIndexer()
+	for _, obj := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, "pv1", "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv1", "node2", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv2", "node1", false, "", nil),
+		createVolumeAttachment("other", "pv3", "node1", false, "", nil),
+		vaWithInlineSpec(createVolumeAttachment(testAttacherName, "inline", "node2", false, "", nil)),
+	} {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+
+	testcases := []struct {
+		index         string
+		value         string
+		expectedNames []string
+	}{
+		{vaByPVNameIndex, "pv1", []string{"pv1-node1", "pv1-node2"}},
+		{vaByPVNameIndex, "inline", []string{}},
+		{vaByNodeNameIndex, "node1", []string{"pv1-node1", "pv2-node1", "pv3-node1"}},
+		{vaByAttacherIndex, testAttacherName, []string{"inline-node2", "pv1-node1", "pv1-node2", "pv2-node1"}},
+		{vaByAttacherIndex, "unknown", []string{}},
+		{vaByInlineVolumeHandleIndex, testVolumeHandle, []string{"inline-node2"}},
+	}
+	for _, tc := range testcases {
+		vas, err := listVAsByIndex(indexer, tc.index, tc.value)
+		if err != nil {
+			t.Errorf("Failed to list %s=%s: %v", tc.index, tc.value, err)
+			continue
+		}
+		names := []string{}
+		for _, va := range vas {
+			names = append(names, va.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.expectedNames) {
+			t.Errorf("Index %s=%s: expected %v, got %v", tc.index, tc.value, tc.expectedNames, names)
+		}
+	}
+}
+
+func TestPVIndexers(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(nil, &v1.PersistentVolume{}, 0, cache.Indexers{})
+	if err := addIndexers(informer, pvIndexers(klog.Background(), csitrans.New())); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+
+	indexer := informer.GetIndexer()
+	for _, obj := range []*v1.PersistentVolume{
+		pv(),
+		pvWithName(pv(), "pv2"),
+		pvWithName(gcePDPV(), "gce"),
+	} {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatalf("Failed to add PersistentVolume: %v", err)
+		}
+	}
+
+	testcases := []struct {
+		value         string
+		expectedNames []string
+	}{
+		{testVolumeHandle, []string{"pv1", "pv2"}},
+		{"projects/UNSPECIFIED/zones/testZone/disks/testpd", []string{"gce"}},
+		{"unknown", []string{}},
+	}
+	for _, tc := range testcases {
+		objs, err := indexer.ByIndex(pvByVolumeHandleIndex, tc.value)
+		if err != nil {
+			t.Errorf("Failed to list %s: %v", tc.value, err)
+			continue
+		}
+		names := []string{}
+		for _, obj := range objs {
+			names = append(names, obj.(*v1.PersistentVolume).Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.expectedNames) {
+			t.Errorf("Index %s: expected %v, got %v", tc.value, tc.expectedNames, names)
+		}
+	}
+}
+
+func TestPVUpdatedEnqueuesStoppedVAs(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(nil, &storage.VolumeAttachment{}, 0, cache.Indexers{})
+	if err := addIndexers(informer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	stopped := map[string]string{vaAttachStoppedAnnotation: "12345678"}
+	for _, obj := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, "pv1", "node1", false, "", stopped),
+		createVolumeAttachment(testAttacherName, "pv1", "node2", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv2", "node1", false, "", stopped),
+		createVolumeAttachment("other", "pv1", "node3", false, "", stopped),
+	} {
+		if err := informer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+
+	oldPV := pvWithName(pvWithFinalizer(), "pv1")
+	newPV := oldPV.DeepCopy()
+	newPV.Spec.MountOptions = []string{"ro"}
+	metadataPV := oldPV.DeepCopy()
+	metadataPV.Labels = map[string]string{"foo": "bar"}
+
+	testcases := []struct {
+		name          string
+		newPV         *v1.PersistentVolume
+		expectedNames []string
+	}{
+		{"spec changed", newPV, []string{"pv1-node1"}},
+		{"metadata changed", metadataPV, []string{}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := &CSIAttachController{
+				attacherName: testAttacherName,
+				vaQueue:      workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+				pvQueue:      workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+				vaIndexer:    informer.GetIndexer(),
+				translator:   csitrans.New(),
+			}
+			defer ctrl.vaQueue.ShutDown()
+			defer ctrl.pvQueue.ShutDown()
+
+			ctrl.pvUpdated(oldPV, tc.newPV)
+
+			names := []string{}
+			for ctrl.vaQueue.Len() > 0 {
+				name, _ := ctrl.vaQueue.Get()
+				names = append(names, name)
+				ctrl.vaQueue.Done(name)
+			}
+			if !reflect.DeepEqual(names, tc.expectedNames) {
+				t.Errorf("Expected enqueued VolumeAttachments %v, got %v", tc.expectedNames, names)
+			}
+		})
+	}
+}
+
+// reconcileHandler is a Handler that reports calls of ReconcileVA.
+type reconcileHandler struct {
+	Handler
+	reconciled chan struct{}
+}
+
+func (h *reconcileHandler) ReconcileVA(ctx context.Context) error {
+	h.reconciled <- struct{}{}
+	return nil
+}
+
+func TestSetReconcileSync(t *testing.T) {
+	handler := &reconcileHandler{reconciled: make(chan struct{}, 10)}
+	ctrl := &CSIAttachController{
+		handler:              handler,
+		reconcileSync:        time.Hour,
+		reconcileSyncChanged: make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ctrl.reconcileVAs(ctx)
+
+	waitForReconcile := func(timeout time.Duration) bool {
+		select {
+		case <-handler.reconciled:
+			return true
+		case <-time.After(timeout):
+			return false
+		}
+	}
+	if !waitForReconcile(10 * time.Second) {
+		t.Fatalf("Expected reconciliation after start")
+	}
+	if waitForReconcile(100 * time.Millisecond) {
+		t.Fatalf("Unexpected reconciliation before reconcileSync")
+	}
+	ctrl.SetReconcileSync(10 * time.Millisecond)
+	if !waitForReconcile(10 * time.Second) {
+		t.Fatalf("Expected reconciliation with the new reconcileSync")
+	}
+}
+
+func TestRunWaitsForHandlerCaches(t *testing.T) {
+	handler := &reconcileHandler{reconciled: make(chan struct{}, 10)}
+	synced := atomic.Bool{}
+	ctrl := &CSIAttachController{
+		handler:                         handler,
+		vaQueue:                         workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		pvQueue:                         workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		vaListerSynced:                  func() bool { return true },
+		pvListerSynced:                  func() bool { return true },
+		shouldReconcileVolumeAttachment: true,
+		reconcileSync:                   time.Hour,
+		reconcileSyncChanged:            make(chan struct{}, 1),
+	}
+	ctrl.AddCacheSync(synced.Load)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ctrl.Run(ctx, 1, nil)
+
+	select {
+	case <-handler.reconciled:
+		t.Fatalf("Unexpected reconciliation before the handler caches are synced")
+	case <-time.After(200 * time.Millisecond):
+	}
+	synced.Store(true)
+	select {
+	case <-handler.reconciled:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected reconciliation after the handler caches are synced")
+	}
+}
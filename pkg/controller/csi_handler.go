@@ -20,24 +20,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-csi/csi-lib-utils/connection"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/features"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/status"
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
@@ -50,29 +57,64 @@ type AttacherCSITranslator interface {
 
 // Lister implements list operations against a remote CSI driver.
 type VolumeLister interface {
-	// ListVolumes calls ListVolumes on the driver and returns a map with keys
-	// of VolumeID and values of the list of Node IDs that volume is published
-	// on
-	ListVolumes(ctx context.Context) (map[string][]string, error)
+	// ListVolumePages asks the driver about volumes and returns them page
+	// by page. Each page is a map with keys of VolumeID and values of the
+	// volume status, i.e. the list of Node IDs that volume is published on
+	// and its condition. volumeIDs are the volumes the caller is interested
+	// in, the pages may contain other volumes too. Each page is fetched
+	// with its own pageTimeout.
+	ListVolumePages(ctx context.Context, volumeIDs []string, pageTimeout time.Duration) attacher.VolumePages
 }
 
-var _ VolumeLister = &attacher.CSIVolumeLister{}
+// allVolumesLister is a VolumeLister that returns all volumes of the driver,
+// regardless of the requested volume IDs.
+type allVolumesLister interface {
+	ListsAllVolumes() bool
+}
+
+var (
+	_ VolumeLister     = &attacher.CSIVolumeLister{}
+	_ VolumeLister     = &attacher.CSIGetVolumeLister{}
+	_ allVolumesLister = &attacher.CSIVolumeLister{}
+)
 
 // csiHandler is a handler that calls CSI to attach/detach volume.
 // It adds finalizer to VolumeAttachment instance to make sure they're detached
 // before deletion.
 type csiHandler struct {
-	client                        kubernetes.Interface
-	attacherName                  string
-	attacher                      attacher.Attacher
-	CSIVolumeLister               VolumeLister
-	pvLister                      corelisters.PersistentVolumeLister
-	csiNodeLister                 storagelisters.CSINodeLister
-	vaLister                      storagelisters.VolumeAttachmentLister
-	vaQueue, pvQueue              workqueue.TypedRateLimitingInterface[string]
-	forceSync                     map[string]bool
-	forceSyncMux                  sync.Mutex
-	timeout                       time.Duration
+	client           kubernetes.Interface
+	eventRecorder    record.EventRecorder
+	attacherName     string
+	attacher         attacher.Attacher
+	CSIVolumeLister  VolumeLister
+	pvLister         corelisters.PersistentVolumeLister
+	pvIndexer        cache.Indexer
+	csiNodeLister    storagelisters.CSINodeLister
+	vaIndexer        cache.Indexer
+	vaQueue, pvQueue workqueue.TypedRateLimitingInterface[string]
+	forceSync        map[string]bool
+	forceSyncMux     sync.Mutex
+	// publishing are names of VolumeAttachments of single node volumes
+	// between checkMultiAttach and the end of their ControllerPublish.
+	publishing    sets.Set[string]
+	publishingMux sync.Mutex
+	nodeLimiter   *nodeLimiter
+	secretCache   *secretCache
+	scLister      storagelisters.StorageClassLister
+	// fallbackSecrets are fallback secrets of PVs, indexed by the secret.
+	// It is nil when VolumeAttachments are not re-queued on changes of
+	// fallback secrets.
+	fallbackSecrets               cache.Indexer
+	fallbackSecretsMux            sync.Mutex
+	defaultSecretRef              *v1.SecretReference
+	retryPolicy                   *RetryPolicy
+	attachAttempts                *attachAttempts
+	lastErrors                    *lastErrors
+	orphans                       *orphans
+	reconcilePass                 *reconcilePass
+	shard                         Shard
+	settings                      HandlerSettings
+	settingsMux                   sync.RWMutex
 	supportsPublishReadOnly       bool
 	supportsSingleNodeMultiWriter bool
 	translator                    AttacherCSITranslator
@@ -81,37 +123,119 @@ type csiHandler struct {
 
 var _ Handler = &csiHandler{}
 
+// CSIHandlerOptions are optional features of a CSI handler. The zero value
+// disables all of them.
+type CSIHandlerOptions struct {
+	// MaxNodeOperations is the maximum number of concurrent
+	// ControllerPublish and ControllerUnpublish calls per node. Zero means
+	// no limit.
+	MaxNodeOperations int
+	// SecretInformers watch ControllerPublish secrets. VolumeAttachments
+	// that use a secret are re-queued when the secret changes.
+	SecretInformers []coreinformers.SecretInformer
+	// PersistentVolumeInformer is the informer of pvIndexer. It is required
+	// with SecretInformers, to index fallback secrets of PVs.
+	PersistentVolumeInformer coreinformers.PersistentVolumeInformer
+	// SecretCacheTTL is the time for which ControllerPublish secrets are
+	// cached. Zero disables the cache.
+	SecretCacheTTL time.Duration
+	// StorageClassInformer enables ControllerPublish secrets from
+	// StorageClass parameters.
+	StorageClassInformer storageinformers.StorageClassInformer
+	// DefaultSecretRef is the ControllerPublish secret of PVs without any.
+	DefaultSecretRef *v1.SecretReference
+	// RetryPolicy sets retry intervals per gRPC code.
+	RetryPolicy *RetryPolicy
+	// MaxRetryDelay, MaxAttachAttempts, OrphanDetachGracePeriod,
+	// ReconcileBatchSize and ReconcileMaxRequeues are the initial
+	// HandlerSettings.
+	MaxRetryDelay           time.Duration
+	MaxAttachAttempts       int
+	OrphanDetachGracePeriod time.Duration
+	ReconcileBatchSize      int
+	ReconcileMaxRequeues    int
+}
+
 // NewCSIHandler creates a new CSIHandler.
 func NewCSIHandler(
 	client kubernetes.Interface,
+	eventRecorder record.EventRecorder,
 	attacherName string,
 	attacher attacher.Attacher,
 	CSIVolumeLister VolumeLister,
-	pvLister corelisters.PersistentVolumeLister,
+	pvIndexer cache.Indexer,
 	csiNodeLister storagelisters.CSINodeLister,
-	vaLister storagelisters.VolumeAttachmentLister,
+	vaIndexer cache.Indexer,
 	timeout *time.Duration,
 	supportsPublishReadOnly bool,
 	supportsSingleNodeMultiWriter bool,
 	translator AttacherCSITranslator,
-	defaultFSType string) Handler {
+	defaultFSType string,
+	opts CSIHandlerOptions) Handler {
 
-	return &csiHandler{
+	h := &csiHandler{
 		client:                        client,
+		eventRecorder:                 eventRecorder,
 		attacherName:                  attacherName,
 		attacher:                      attacher,
 		CSIVolumeLister:               CSIVolumeLister,
-		pvLister:                      pvLister,
+		pvLister:                      corelisters.NewPersistentVolumeLister(pvIndexer),
+		pvIndexer:                     pvIndexer,
 		csiNodeLister:                 csiNodeLister,
-		vaLister:                      vaLister,
-		timeout:                       *timeout,
+		vaIndexer:                     vaIndexer,
+		nodeLimiter:                   newNodeLimiter(opts.MaxNodeOperations),
+		secretCache:                   newSecretCache(client, opts.SecretCacheTTL),
+		defaultSecretRef:              opts.DefaultSecretRef,
+		retryPolicy:                   opts.RetryPolicy,
+		attachAttempts:                newAttachAttempts(opts.MaxAttachAttempts),
+		lastErrors:                    newLastErrors(),
+		orphans:                       newOrphans(),
+		reconcilePass:                 newReconcilePass(),
 		supportsPublishReadOnly:       supportsPublishReadOnly,
 		supportsSingleNodeMultiWriter: supportsSingleNodeMultiWriter,
 		translator:                    translator,
 		forceSync:                     map[string]bool{},
 		forceSyncMux:                  sync.Mutex{},
+		publishing:                    sets.New[string](),
 		defaultFSType:                 defaultFSType,
+		settings: HandlerSettings{
+			Timeout:                 *timeout,
+			MaxRetryDelay:           opts.MaxRetryDelay,
+			MaxAttachAttempts:       opts.MaxAttachAttempts,
+			OrphanDetachGracePeriod: opts.OrphanDetachGracePeriod,
+			ReconcileBatchSize:      opts.ReconcileBatchSize,
+			ReconcileMaxRequeues:    opts.ReconcileMaxRequeues,
+		},
+	}
+	if opts.StorageClassInformer != nil {
+		h.scLister = opts.StorageClassInformer.Lister()
 	}
+	if len(opts.SecretInformers) > 0 && (h.scLister != nil || h.defaultSecretRef != nil) {
+		h.watchFallbackSecrets(klog.Background(), opts.PersistentVolumeInformer, opts.StorageClassInformer)
+	}
+	for _, secretInformer := range opts.SecretInformers {
+		secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc:    h.secretAdded,
+			UpdateFunc: h.secretUpdated,
+			DeleteFunc: h.secretDeleted,
+		})
+	}
+	return h
+}
+
+// UpdateSettings changes settings of the handler. Operations that are in
+// progress keep the previous settings.
+func (h *csiHandler) UpdateSettings(settings HandlerSettings) {
+	h.settingsMux.Lock()
+	defer h.settingsMux.Unlock()
+	h.settings = settings
+	h.attachAttempts.setLimit(settings.MaxAttachAttempts)
+}
+
+func (h *csiHandler) getSettings() HandlerSettings {
+	h.settingsMux.RLock()
+	defer h.settingsMux.RUnlock()
+	return h.settings
 }
 
 func (h *csiHandler) Init(vaQueue workqueue.TypedRateLimitingInterface[string], pvQueue workqueue.TypedRateLimitingInterface[string]) {
@@ -123,78 +247,101 @@ func (h *csiHandler) Init(vaQueue workqueue.TypedRateLimitingInterface[string],
 // status with the corresponding VolumeAttachment object. If the attachment
 // status of the volume is different from the state on the VolumeAttachment the
 // VolumeAttachment object is patched to the correct state.
+//
+// Each call checks a window of at most ReconcileBatchSize VolumeAttachments
+// and requeues at most ReconcileMaxRequeues of them. The next call continues
+// where the previous one stopped, until all VolumeAttachments of the driver
+// are checked.
 func (h *csiHandler) ReconcileVA(ctx context.Context) error {
 	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Reconciling VolumeAttachments with driver backend state")
+	settings := h.getSettings()
 
-	ctx, cancel := context.WithTimeout(ctx, h.timeout)
-	defer cancel()
-
-	// Loop over all volume attachment objects
-	vas, err := h.vaLister.List(labels.Everything())
+	// Loop over all volume attachment objects of this driver
+	vas, err := listVAsByIndex(h.vaIndexer, vaByAttacherIndex, h.attacherName)
 	if err != nil {
-		return errors.New("failed to list all VolumeAttachment objects")
+		return fmt.Errorf("failed to list VolumeAttachment objects: %v", err)
 	}
-
-	published, err := h.CSIVolumeLister.ListVolumes(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to ListVolumes: %v", err)
+	pass := h.reconcilePass
+	pass.start()
+	// Only VolumeAttachments of the shard are checked. Orphaned attachments
+	// on nodes of other shards are handled by other replicas.
+	owned := vas
+	if h.shard != nil {
+		owned = slices.DeleteFunc(slices.Clone(vas), func(va *storage.VolumeAttachment) bool {
+			return !h.ownsNode(va.Spec.NodeName)
+		})
 	}
-
-	for _, va := range vas {
-		if va.Spec.Attacher != h.attacherName {
-			// skip VolumeAttachments of other CSI drivers
-			continue
-		}
-
-		nodeID, err := h.getNodeID(logger, h.attacherName, va.Spec.NodeName, va)
-		if err != nil {
-			logger.Error(err, "Failed to find node ID err")
-			continue
+	window, last := pass.window(owned, settings.ReconcileBatchSize)
+
+	// ownedVolumes are volumes of all VolumeAttachments of the shard. They
+	// are resolved at most once per pass, other reconciliations resolve
+	// only VolumeAttachments of the window.
+	var ownedVolumes []vaVolume
+	var published *publishedVolumes
+	var windowVolumes map[string]vaVolume
+	if lister, ok := h.CSIVolumeLister.(allVolumesLister); ok && lister.ListsAllVolumes() {
+		// The driver returns all volumes for each window, list them
+		// only once per pass.
+		if pass.published == nil {
+			ownedVolumes = h.resolveVAVolumes(ctx, logger, owned)
+			if published, err = h.matchPublishedVolumes(ctx, ownedVolumes, nil); err != nil {
+				return fmt.Errorf("failed to ListVolumes: %v", err)
+			}
+			pass.listed(ownedVolumes, published)
 		}
-		pvSpec, err := h.getProcessedPVSpec(ctx, va)
-		if err != nil {
-			logger.Error(err, "Failed to get PV Spec")
-			continue
+		published = pass.published
+		windowVolumes = pass.listedVolumes
+	} else {
+		// Volumes published on nodes are matched only with
+		// VolumeAttachments of the window here. Orphaned attachments
+		// found in the window are matched with all VolumeAttachments
+		// when the pass completes.
+		volumes := h.resolveVAVolumes(ctx, logger, window)
+		windowVolumes = make(map[string]vaVolume, len(volumes))
+		windowHandles := sets.New[string]()
+		for _, v := range volumes {
+			windowVolumes[v.va.Name] = v
+			windowHandles.Insert(v.volumeHandle)
 		}
-
-		source, err := getCSISource(pvSpec)
-		if err != nil {
-			logger.Error(err, "Failed to get CSI Source")
-			continue
+		if published, err = h.matchPublishedVolumes(ctx, volumes, sets.List(windowHandles)); err != nil {
+			return fmt.Errorf("failed to ListVolumes: %v", err)
 		}
+		pass.abnormal = pass.abnormal.Union(published.abnormal)
+		pass.orphans.Insert(published.orphans...)
+	}
 
-		volumeHandle, _, err := GetVolumeHandle(source)
-		if err != nil {
-			logger.Error(err, "Failed to get volume handle")
+	requeues := 0
+	for _, va := range window {
+		v, found := windowVolumes[va.Name]
+		if !found {
+			// The error was logged when resolving the volume, or the
+			// VolumeAttachment was created after the volumes were
+			// listed and it is checked in the next pass.
+			pass.cursor = va.Name
 			continue
 		}
 		attachedStatus := va.Status.Attached
 
-		// If volume driver has corresponding in-tree plugin, generate a correct volumehandle
-		isMig, err := h.isMigratable(va)
-		if err != nil {
-			logger.Error(err, "Failed to check if migratable for volume handle", "volumeHandle", volumeHandle, "sourceDriver", source.Driver)
-			continue
-		}
-		if isMig {
-			volumeHandle, err = h.translator.RepairVolumeHandle(source.Driver, volumeHandle, nodeID)
-			if err != nil {
-				logger.Error(err, "Failed to repair volume handle for driver", "volumeHandle", volumeHandle, "sourceDriver", source.Driver)
-				continue
-			}
-		}
-
 		// Check whether the volume is published to this node
-		found := slices.Contains(published[volumeHandle], nodeID)
+		found = published.vaNames.Has(va.Name)
 
 		// If ListVolumes Attached Status is different, add to shared workQueue.
-		if attachedStatus != found {
+		// A VolumeAttachment changed since the volumes were listed is
+		// checked in the next pass.
+		if attachedStatus != found && !pass.changedSinceListing(va) {
+			reconcileDrift.WithLabelValues(h.attacherName).Inc()
+			if settings.ReconcileMaxRequeues > 0 && requeues >= settings.ReconcileMaxRequeues {
+				// Check the rest of the window next time.
+				logger.V(2).Info("Reached the maximum number of requeued VolumeAttachments, continuing in the next reconciliation", "VolumeAttachment", va.Name, "maxRequeues", settings.ReconcileMaxRequeues)
+				last = false
+				break
+			}
 			logger.Error(
 				nil,
 				"VolumeAttachment attached status and actual state do not match. Adding back to VolumeAttachment queue for forced reprocessing",
 				"VolumeAttachment", va.Name,
-				"volumeHandle", volumeHandle,
+				"volumeHandle", v.volumeHandle,
 				"attachedStatus", attachedStatus,
 				"found", found,
 			)
@@ -204,8 +351,196 @@ func (h *csiHandler) ReconcileVA(ctx context.Context) error {
 			// queue
 			h.setForceSync(va.Name)
 			h.vaQueue.Add(va.Name)
+			forceSyncRequeues.WithLabelValues(h.attacherName).Inc()
+			requeues++
 		}
+
+		if condition := published.conditions[va.Name]; condition != nil {
+			if err := h.syncVolumeConditionWithTimeout(ctx, va, condition); err != nil {
+				logger.Error(err, "Failed to save volume condition", "VolumeAttachment", va.Name)
+			}
+		}
+		pass.cursor = va.Name
+	}
+
+	if !last {
+		logger.V(4).Info("Reconciled a window of VolumeAttachments", "lastVolumeAttachment", pass.cursor, "requeues", requeues)
+		return nil
 	}
+
+	// All VolumeAttachments were checked.
+	abnormalVolumes.WithLabelValues(h.attacherName).Set(float64(pass.abnormal.Len()))
+	if pass.orphans.Len() > 0 && ownedVolumes == nil {
+		ownedVolumes = h.resolveVAVolumes(ctx, logger, owned)
+	}
+	h.syncOrphans(ctx, pass.orphans.UnsortedList(), ownedVolumes, pass.complete)
+	duration := pass.finish()
+	reconcileFullPassDuration.WithLabelValues(h.attacherName).Set(duration.Seconds())
+	reconcileFullPassTimestamp.WithLabelValues(h.attacherName).SetToCurrentTime()
+	logger.V(4).Info("Reconciled all VolumeAttachments", "count", len(vas), "duration", duration)
+	return nil
+}
+
+// vaVolume is a VolumeAttachment with its volume handle and node ID, as
+// used by the CSI driver.
+type vaVolume struct {
+	va           *storage.VolumeAttachment
+	volumeHandle string
+	nodeID       string
+}
+
+// resolveVAVolumes finds volume handles and node IDs of the
+// VolumeAttachments. VolumeAttachments whose volume cannot be found are
+// skipped and the reconcile pass is marked as incomplete.
+func (h *csiHandler) resolveVAVolumes(ctx context.Context, logger klog.Logger, vas []*storage.VolumeAttachment) []vaVolume {
+	vaVolumes := make([]vaVolume, 0, len(vas))
+	for _, va := range vas {
+		v, err := h.resolveVAVolume(ctx, logger, va)
+		if err != nil {
+			logger.Error(err, "Failed to find volume of VolumeAttachment", "VolumeAttachment", va.Name)
+			h.reconcilePass.complete = false
+			continue
+		}
+		vaVolumes = append(vaVolumes, v)
+	}
+	return vaVolumes
+}
+
+// resolveVAVolume finds the volume handle and node ID of the VolumeAttachment,
+// including translation of migrated volumes.
+func (h *csiHandler) resolveVAVolume(ctx context.Context, logger klog.Logger, va *storage.VolumeAttachment) (vaVolume, error) {
+	nodeID, err := h.getNodeID(logger, h.attacherName, va.Spec.NodeName, va)
+	if err != nil {
+		return vaVolume{}, fmt.Errorf("failed to find node ID: %w", err)
+	}
+	pvSpec, err := h.getProcessedPVSpec(ctx, va)
+	if err != nil {
+		return vaVolume{}, fmt.Errorf("failed to get PV spec: %w", err)
+	}
+	source, err := getCSISource(pvSpec)
+	if err != nil {
+		return vaVolume{}, fmt.Errorf("failed to get CSI source: %w", err)
+	}
+	volumeHandle, _, err := GetVolumeHandle(source)
+	if err != nil {
+		return vaVolume{}, fmt.Errorf("failed to get volume handle: %w", err)
+	}
+
+	// If volume driver has corresponding in-tree plugin, generate a correct volumehandle
+	isMig, err := h.isMigratable(va)
+	if err != nil {
+		return vaVolume{}, fmt.Errorf("failed to check if volume handle %s of driver %s is migratable: %w", volumeHandle, source.Driver, err)
+	}
+	if isMig {
+		volumeHandle, err = h.translator.RepairVolumeHandle(source.Driver, volumeHandle, nodeID)
+		if err != nil {
+			return vaVolume{}, fmt.Errorf("failed to repair volume handle %s of driver %s: %w", volumeHandle, source.Driver, err)
+		}
+	}
+	return vaVolume{va: va, volumeHandle: volumeHandle, nodeID: nodeID}, nil
+}
+
+// publishedVolumes is the state of VolumeAttachments as reported by the CSI
+// driver.
+type publishedVolumes struct {
+	// vaNames are names of VolumeAttachments whose volume is published on
+	// their node.
+	vaNames sets.Set[string]
+	// conditions are volume conditions reported by the driver, by
+	// VolumeAttachment name.
+	conditions map[string]*csi.VolumeCondition
+	// orphans are volumes published on nodes without a VolumeAttachment.
+	orphans []orphanedAttachment
+	// abnormal are volume handles of volumes with an abnormal condition.
+	abnormal sets.Set[string]
+}
+
+// matchPublishedVolumes asks the CSI driver about nodes the volumes with
+// volumeHandles are published on and matches them with vaVolumes. The driver
+// returns volumes page by page, each page is matched with the
+// VolumeAttachments and dropped, so only VolumeAttachments of the driver are
+// kept in memory and not all volumes of the storage backend. Each page has its
+// own timeout. volumeHandles are nil when the lister returns all volumes.
+func (h *csiHandler) matchPublishedVolumes(ctx context.Context, vaVolumes []vaVolume, volumeHandles []string) (*publishedVolumes, error) {
+	index := make(map[string][]vaVolume, len(vaVolumes))
+	for _, v := range vaVolumes {
+		index[v.volumeHandle] = append(index[v.volumeHandle], v)
+	}
+	published := &publishedVolumes{
+		vaNames:    sets.New[string](),
+		conditions: map[string]*csi.VolumeCondition{},
+		abnormal:   sets.New[string](),
+	}
+	pages := h.CSIVolumeLister.ListVolumePages(ctx, volumeHandles, h.getSettings().Timeout)
+	for page, err := range pages {
+		if err != nil {
+			return nil, err
+		}
+		for volumeHandle, volumeStatus := range page {
+			if volumeStatus.Condition != nil && volumeStatus.Condition.Abnormal {
+				published.abnormal.Insert(volumeHandle)
+			}
+			attached := index[volumeHandle]
+			for _, v := range attached {
+				if volumeStatus.Condition != nil {
+					published.conditions[v.va.Name] = volumeStatus.Condition
+				}
+				if slices.Contains(volumeStatus.PublishedNodeIDs, v.nodeID) {
+					published.vaNames.Insert(v.va.Name)
+				}
+			}
+			for _, nodeID := range volumeStatus.PublishedNodeIDs {
+				if !slices.ContainsFunc(attached, func(v vaVolume) bool { return v.nodeID == nodeID }) {
+					published.orphans = append(published.orphans, orphanedAttachment{volumeHandle: volumeHandle, nodeID: nodeID})
+				}
+			}
+		}
+	}
+	return published, nil
+}
+
+// syncVolumeConditionWithTimeout calls syncVolumeCondition with the timeout of
+// the handler.
+func (h *csiHandler) syncVolumeConditionWithTimeout(ctx context.Context, va *storage.VolumeAttachment, condition *csi.VolumeCondition) error {
+	ctx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+	defer cancel()
+	return h.syncVolumeCondition(ctx, va, condition)
+}
+
+// syncVolumeCondition stores the message of an abnormal volume condition in an
+// annotation of the VolumeAttachment and removes the annotation when the
+// volume becomes healthy again. Changes of the condition are reported as
+// events.
+func (h *csiHandler) syncVolumeCondition(ctx context.Context, va *storage.VolumeAttachment, condition *csi.VolumeCondition) error {
+	current, hasAnnotation := va.Annotations[vaVolumeConditionAnnotation]
+	clone := va.DeepCopy()
+	if condition.Abnormal {
+		message := condition.Message
+		if message == "" {
+			message = "volume condition is abnormal"
+		}
+		if hasAnnotation && current == message {
+			return nil
+		}
+		if clone.Annotations == nil {
+			clone.Annotations = map[string]string{}
+		}
+		clone.Annotations[vaVolumeConditionAnnotation] = message
+		if _, err := h.patchVA(ctx, va, clone); err != nil {
+			return err
+		}
+		h.recordEvent(va, v1.EventTypeWarning, reasonVolumeConditionAbnormal, fmt.Sprintf("Volume %q is abnormal: %s", getVolumeName(va), message))
+		return nil
+	}
+
+	if !hasAnnotation {
+		return nil
+	}
+	delete(clone.Annotations, vaVolumeConditionAnnotation)
+	if _, err := h.patchVA(ctx, va, clone); err != nil {
+		return err
+	}
+	h.recordEvent(va, v1.EventTypeNormal, reasonVolumeConditionNormal, fmt.Sprintf("Volume %q is healthy again", getVolumeName(va)))
 	return nil
 }
 
@@ -218,6 +553,26 @@ func (h *csiHandler) setForceSync(vaName string) {
 	h.forceSync[vaName] = true
 }
 
+// forceSyncNames returns names of VolumeAttachments with a pending force
+// sync, sorted by name.
+func (h *csiHandler) forceSyncNames() []string {
+	h.forceSyncMux.Lock()
+	defer h.forceSyncMux.Unlock()
+	return slices.Sorted(maps.Keys(h.forceSync))
+}
+
+// debugState returns internal state of the VolumeAttachment.
+func (h *csiHandler) debugState(vaName string) HandlerDebugState {
+	h.forceSyncMux.Lock()
+	forceSync := h.forceSync[vaName]
+	h.forceSyncMux.Unlock()
+	return HandlerDebugState{
+		ForceSync:      forceSync,
+		LastError:      h.lastErrors.get(vaName),
+		AttachAttempts: h.attachAttempts.get(vaName),
+	}
+}
+
 // consumeForceSync is used to check whether forceSync was set for the VA
 // referenced by vaName. It will then remove the forceSync intention so that the
 // VA will only be forceSync-ed once per request
@@ -241,9 +596,36 @@ func (h *csiHandler) SyncNewOrUpdatedVolumeAttachment(ctx context.Context, va *s
 	} else {
 		err = h.syncDetach(ctx, va)
 	}
+	if err != errAttachStopped {
+		// A stopped VolumeAttachment keeps its last attach error.
+		h.lastErrors.set(va.Name, err)
+	}
+	if errors.Is(err, errAttachStopped) {
+		// Not a success, but there is nothing to retry until the
+		// VolumeAttachment or its PV changes.
+		logger.V(4).Info("Attach stopped, not re-queuing")
+		h.vaQueue.Forget(va.Name)
+		return
+	}
+	if errors.Is(err, errNodeBusy) {
+		// Not a failure, the VA is re-queued when the node has a free slot.
+		// Keep the exponential backoff as it is.
+		logger.V(4).Info("Node is busy, waiting for a free slot", "node", va.Spec.NodeName)
+		return
+	}
 	if err != nil {
-		// Re-queue with exponential backoff
 		logger.V(2).Info("Error processing", "err", err)
+		if delay, found := retryDelay(err); found {
+			// Re-queue after the delay requested by the driver
+			if maxDelay := h.getSettings().MaxRetryDelay; maxDelay > 0 {
+				delay = min(delay, maxDelay)
+			}
+			logger.V(4).Info("Retrying after delay requested by the driver", "delay", delay)
+			h.vaQueue.AddAfter(va.Name, delay)
+			return
+		}
+		// Re-queue with backoff of the error
+		h.retryPolicy.SetError(va.Name, err)
 		h.vaQueue.AddRateLimited(va.Name)
 		return
 	}
@@ -254,31 +636,77 @@ func (h *csiHandler) SyncNewOrUpdatedVolumeAttachment(ctx context.Context, va *s
 
 func (h *csiHandler) syncAttach(ctx context.Context, va *storage.VolumeAttachment) error {
 	logger := klog.FromContext(ctx)
-	if !h.consumeForceSync(va.Name) && va.Status.Attached {
+	forceSync := h.consumeForceSync(va.Name)
+	if !forceSync && va.Status.Attached {
 		// Volume is attached and no force sync, there is nothing to be done.
 		logger.V(4).Info("VolumeAttachment is already attached")
 		return nil
 	}
+	if _, found := va.Annotations[vaAttachStoppedAnnotation]; found {
+		stopped, err := h.attachStopped(va)
+		if err != nil {
+			return err
+		}
+		if stopped {
+			logger.V(4).Info("Attaching stopped after the maximum number of attempts, waiting for a change of the VolumeAttachment or PersistentVolume")
+			return errAttachStopped
+		}
+		logger.V(2).Info("Resuming attaching stopped after the maximum number of attempts")
+		removeAnnotations := map[string]string{
+			vaAttachStoppedAnnotation: "",
+			vaAttachRetryAnnotation:   "",
+		}
+		if va, err = h.saveAnnotations(ctx, va, removeAnnotations); err != nil {
+			return fmt.Errorf("failed to remove attach stopped annotations: %w", err)
+		}
+		h.attachAttempts.reset(va.Name)
+	}
+	if !h.acquireNode(va, forceSync) {
+		return errNodeBusy
+	}
+	defer h.releaseNode(va)
 
 	// Attach and report any error
 	logger.V(2).Info("Attaching")
-	va, metadata, err := h.csiAttach(ctx, va)
+	h.recordEvent(va, v1.EventTypeNormal, reasonAttaching, fmt.Sprintf("Attaching volume %q to node %q", getVolumeName(va), va.Spec.NodeName))
+	va, metadata, detached, err := h.csiAttach(ctx, va)
 	if err != nil {
-		_, saveErr := h.saveAttachError(ctx, va, err)
+		var saveErr error
+		va, saveErr = h.saveAttachError(ctx, va, err, detached)
 		if saveErr != nil {
 			// Just log it, propagate the attach error.
 			logger.V(2).Info("Failed to save attach error to VolumeAttachment", "err", saveErr.Error())
 		}
+		h.recordEvent(va, v1.EventTypeWarning, reasonAttachFailed, fmt.Sprintf("Failed to attach volume %q to node %q: %s", getVolumeName(va), va.Spec.NodeName, err))
+		attachRetries.WithLabelValues(h.attacherName).Inc()
+		if saveErr == nil && h.attachAttempts.failed(va.Name) {
+			return h.stopAttach(ctx, va, err)
+		}
 		// Add context to the error for logging
-		err := fmt.Errorf("failed to attach: %s", err)
+		err := fmt.Errorf("failed to attach: %w", err)
 		return err
 	}
 	logger.V(2).Info("Attached")
+	h.attachAttempts.reset(va.Name)
 
 	// Mark as attached
-	if _, err := markAsAttached(ctx, h.client, va, metadata); err != nil {
+	wasAttached := va.Status.Attached
+	va, err = markAsAttached(ctx, h.client, va, metadata)
+	if err != nil {
 		return fmt.Errorf("failed to mark as attached: %s", err)
 	}
+	if !wasAttached {
+		observeAttached(h.attacherName, va)
+	}
+	removeAnnotations := map[string]string{
+		vaAttachErrorReasonAnnotation: "",
+		vaDetachedAnnotation:          "",
+	}
+	if _, err := h.saveAnnotations(ctx, va, removeAnnotations); err != nil {
+		// Just log it, the volume is attached.
+		logger.V(2).Info("Failed to remove attach error annotations from VolumeAttachment", "err", err)
+	}
+	h.recordEvent(va, v1.EventTypeNormal, reasonAttached, fmt.Sprintf("Volume %q attached to node %q", getVolumeName(va), va.Spec.NodeName))
 	logger.V(4).Info("Fully attached")
 	return nil
 }
@@ -286,10 +714,27 @@ func (h *csiHandler) syncAttach(ctx context.Context, va *storage.VolumeAttachmen
 func (h *csiHandler) syncDetach(ctx context.Context, va *storage.VolumeAttachment) error {
 	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Starting detach operation")
-	if !h.consumeForceSync(va.Name) && !h.hasVAFinalizer(va) {
+	h.attachAttempts.reset(va.Name)
+	forceSync := h.consumeForceSync(va.Name)
+	if !forceSync && !h.hasVAFinalizer(va) {
 		logger.V(4).Info("VolumeAttachment is already detached")
 		return nil
 	}
+	if h.neverAttached(va) {
+		// All ControllerPublish calls failed with a final error, the volume
+		// was never attached and ControllerUnpublish is not needed.
+		logger.V(2).Info("Volume was never attached, skipping ControllerUnpublish")
+		if _, err := markAsDetached(ctx, h.client, va); err != nil {
+			return fmt.Errorf("could not mark as detached: %s", err)
+		}
+		observeDetached(h.attacherName, va)
+		h.recordEvent(va, v1.EventTypeNormal, reasonDetached, fmt.Sprintf("Volume %q detached from node %q", getVolumeName(va), va.Spec.NodeName))
+		return nil
+	}
+	if !h.acquireNode(va, forceSync) {
+		return errNodeBusy
+	}
+	defer h.releaseNode(va)
 
 	// Detach and report any error
 	logger.V(2).Info("Detaching")
@@ -301,14 +746,51 @@ func (h *csiHandler) syncDetach(ctx context.Context, va *storage.VolumeAttachmen
 			// Just log it, propagate the detach error.
 			logger.V(2).Info("Failed to save detach error to VolumeAttachment", "err", saveErr.Error())
 		}
+		h.recordEvent(va, v1.EventTypeWarning, reasonDetachFailed, fmt.Sprintf("Failed to detach volume %q from node %q: %s", getVolumeName(va), va.Spec.NodeName, err))
 		// Add context to the error for logging
-		err := fmt.Errorf("failed to detach: %s", err)
+		err := fmt.Errorf("failed to detach: %w", err)
 		return err
 	}
+	h.recordEvent(va, v1.EventTypeNormal, reasonDetached, fmt.Sprintf("Volume %q detached from node %q", getVolumeName(va), va.Spec.NodeName))
 	logger.V(4).Info("Fully detached")
 	return nil
 }
 
+// neverAttached returns true when the VolumeAttachment is marked as detached
+// after final attach errors. The annotation can be written by anyone who can
+// update VolumeAttachments, so it is trusted only together with the status,
+// which the attacher writes through the status subresource.
+func (h *csiHandler) neverAttached(va *storage.VolumeAttachment) bool {
+	return va.Annotations[vaDetachedAnnotation] == "true" && !va.Status.Attached && va.Status.AttachError != nil
+}
+
+// acquireNode takes a slot for an attach / detach operation on the node of the
+// VolumeAttachment. When the node is busy, it keeps the force sync request of
+// the VolumeAttachment for the time it gets a slot.
+func (h *csiHandler) acquireNode(va *storage.VolumeAttachment, forceSync bool) bool {
+	if h.nodeLimiter.tryAcquire(va.Spec.NodeName, va.Name) {
+		return true
+	}
+	if forceSync {
+		h.setForceSync(va.Name)
+	}
+	return false
+}
+
+// releaseNode frees the slot taken by acquireNode and re-queues
+// VolumeAttachments that wait for the node.
+func (h *csiHandler) releaseNode(va *storage.VolumeAttachment) {
+	for _, vaName := range h.nodeLimiter.release(va.Spec.NodeName) {
+		h.vaQueue.Add(vaName)
+	}
+}
+
+// recordEvent records an event on the VolumeAttachment, its PersistentVolume
+// and the PersistentVolumeClaim bound to it.
+func (h *csiHandler) recordEvent(va *storage.VolumeAttachment, eventtype, reason, message string) {
+	recordVolumeEvent(h.eventRecorder, h.pvLister, va, eventtype, reason, message)
+}
+
 func (h *csiHandler) prepareVAFinalizer(logger klog.Logger, va *storage.VolumeAttachment) (newVA *storage.VolumeAttachment, modified bool) {
 	finalizerName := GetFinalizerName(h.attacherName)
 	if slices.Contains(va.Finalizers, finalizerName) {
@@ -339,6 +821,17 @@ func (h *csiHandler) prepareVANodeID(logger klog.Logger, va *storage.VolumeAttac
 	return clone, true
 }
 
+// prepareVADetached removes the detached annotation before ControllerPublish.
+func (h *csiHandler) prepareVADetached(logger klog.Logger, va *storage.VolumeAttachment) (newVA *storage.VolumeAttachment, modified bool) {
+	if _, ok := va.Annotations[vaDetachedAnnotation]; !ok {
+		return va, false
+	}
+	clone := va.DeepCopy()
+	delete(clone.Annotations, vaDetachedAnnotation)
+	logger.V(4).Info("Detached annotation removed")
+	return clone, true
+}
+
 func (h *csiHandler) addPVFinalizer(ctx context.Context, pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
 	logger := klog.LoggerWithValues(klog.FromContext(ctx), "PersistentVolume", pv.Name)
 	finalizerName := GetFinalizerName(h.attacherName)
@@ -353,10 +846,13 @@ func (h *csiHandler) addPVFinalizer(ctx context.Context, pv *v1.PersistentVolume
 		return pv, fmt.Errorf("failed to create add-finalizer patch: %w", err)
 	}
 
-	newPV, err := h.client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	patchCtx, span := startSpan(ctx, "PatchPersistentVolume", attrPersistentVolume.String(pv.Name))
+	newPV, err := h.client.CoreV1().PersistentVolumes().Patch(patchCtx, pv.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	endSpan(span, err)
 	if err != nil {
 		return pv, err
 	}
+	pvFinalizersAdded.WithLabelValues(h.attacherName).Inc()
 
 	logger.V(4).Info("PersistentVolume finalizer added")
 	return newPV, nil
@@ -396,6 +892,14 @@ func getCSISource(pvSpec *v1.PersistentVolumeSpec) (*v1.CSIPersistentVolumeSourc
 	return nil, errors.New("pv spec contained non-csi source that was not migrated")
 }
 
+// getPV returns the PersistentVolume from the informer cache.
+func (h *csiHandler) getPV(ctx context.Context, name string) (*v1.PersistentVolume, error) {
+	_, span := startSpan(ctx, "GetPersistentVolume", attrPersistentVolume.String(name))
+	pv, err := h.pvLister.Get(name)
+	endSpan(span, err)
+	return pv, err
+}
+
 func (h *csiHandler) getProcessedPVSpec(ctx context.Context, va *storage.VolumeAttachment) (*v1.PersistentVolumeSpec, error) {
 	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Starting processing PVSpec operation")
@@ -404,7 +908,7 @@ func (h *csiHandler) getProcessedPVSpec(ctx context.Context, va *storage.VolumeA
 		if va.Spec.Source.InlineVolumeSpec != nil {
 			return nil, errors.New("both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")
 		}
-		pv, err := h.pvLister.Get(*va.Spec.Source.PersistentVolumeName)
+		pv, err := h.getPV(ctx, *va.Spec.Source.PersistentVolumeName)
 		if err != nil {
 			return nil, err
 		}
@@ -426,7 +930,10 @@ func (h *csiHandler) getProcessedPVSpec(ctx context.Context, va *storage.VolumeA
 	}
 }
 
-func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment) (*storage.VolumeAttachment, map[string]string, error) {
+// csiAttach attaches the volume. On error, it returns "detached" true when
+// this and all previous ControllerPublish calls of the VolumeAttachment failed
+// with a final error and the volume is for sure not attached to the node.
+func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment) (*storage.VolumeAttachment, map[string]string, bool, error) {
 	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Starting attach operation")
 	// Check as much as possible before adding VA finalizer - it would block
@@ -434,28 +941,30 @@ func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment
 
 	var csiSource *v1.CSIPersistentVolumeSource
 	var pvSpec *v1.PersistentVolumeSpec
+	var pv *v1.PersistentVolume
 	var migratable bool
 	if va.Spec.Source.PersistentVolumeName != nil {
 		if va.Spec.Source.InlineVolumeSpec != nil {
-			return va, nil, errors.New("both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")
+			return va, nil, false, errors.New("both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")
 		}
-		pv, err := h.pvLister.Get(*va.Spec.Source.PersistentVolumeName)
+		var err error
+		pv, err = h.getPV(ctx, *va.Spec.Source.PersistentVolumeName)
 		if err != nil {
-			return va, nil, err
+			return va, nil, false, err
 		}
 		// Refuse to attach volumes that are marked for deletion.
 		if pv.DeletionTimestamp != nil {
-			return va, nil, fmt.Errorf("PersistentVolume %q is marked for deletion", pv.Name)
+			return va, nil, false, fmt.Errorf("PersistentVolume %q is marked for deletion", pv.Name)
 		}
 		pv, err = h.addPVFinalizer(ctx, pv)
 		if err != nil {
-			return va, nil, fmt.Errorf("could not add PersistentVolume finalizer: %s", err)
+			return va, nil, false, fmt.Errorf("could not add PersistentVolume finalizer: %s", err)
 		}
 
 		if h.translator.IsPVMigratable(pv) {
 			pv, err = h.translator.TranslateInTreePVToCSI(logger, pv)
 			if err != nil {
-				return va, nil, fmt.Errorf("failed to translate in tree pv to CSI: %v", err)
+				return va, nil, false, fmt.Errorf("failed to translate in tree pv to CSI: %v", err)
 			}
 			migratable = true
 		}
@@ -464,7 +973,7 @@ func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment
 		// migrated
 		csiSource, err = getCSISource(&pv.Spec)
 		if err != nil {
-			return va, nil, err
+			return va, nil, false, err
 		}
 
 		pvSpec = &pv.Spec
@@ -472,22 +981,22 @@ func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment
 		if va.Spec.Source.InlineVolumeSpec.CSI != nil {
 			csiSource = va.Spec.Source.InlineVolumeSpec.CSI
 		} else {
-			return va, nil, errors.New("inline volume spec contains nil CSI source")
+			return va, nil, false, errors.New("inline volume spec contains nil CSI source")
 		}
 
 		pvSpec = va.Spec.Source.InlineVolumeSpec
 	} else {
-		return va, nil, errors.New("neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source")
+		return va, nil, false, errors.New("neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source")
 	}
 
 	attributes, err := GetVolumeAttributes(csiSource)
 	if err != nil {
-		return va, nil, err
+		return va, nil, false, err
 	}
 
 	volumeHandle, readOnly, err := GetVolumeHandle(csiSource)
 	if err != nil {
-		return va, nil, err
+		return va, nil, false, err
 	}
 	if !h.supportsPublishReadOnly {
 		// "CO MUST set this field to false if SP does not have the
@@ -497,151 +1006,317 @@ func (h *csiHandler) csiAttach(ctx context.Context, va *storage.VolumeAttachment
 
 	volumeCapabilities, err := GetVolumeCapabilities(logger, pvSpec, h.supportsSingleNodeMultiWriter, h.defaultFSType)
 	if err != nil {
-		return va, nil, err
+		return va, nil, false, err
 	}
 
-	secrets, err := h.getCredentialsFromPV(ctx, csiSource)
+	published, err := h.startPublish(va, volumeHandle, volumeCapabilities)
 	if err != nil {
-		return va, nil, err
+		return va, nil, false, err
+	}
+	defer published()
+
+	secrets, err := h.getCredentialsFromPV(ctx, pv, csiSource)
+	if err != nil {
+		return va, nil, false, err
 	}
 
 	nodeID, err := h.getNodeID(logger, h.attacherName, va.Spec.NodeName, nil)
 	if err != nil {
-		return va, nil, err
+		return va, nil, false, err
 	}
 
 	originalVA := va
 	va, finalizerAdded := h.prepareVAFinalizer(logger, va)
 	va, nodeIDAdded := h.prepareVANodeID(logger, va, nodeID)
-
-	if finalizerAdded || nodeIDAdded {
+	// The finalizer is added before the first ControllerPublish, so a
+	// VolumeAttachment without it was never published. Otherwise only the
+	// detached annotation tells that all previous calls failed with a final
+	// error. It is removed before the call, so it does not survive a call that
+	// may attach the volume, even when saving the result fails.
+	neverPublished := finalizerAdded || va.Annotations[vaDetachedAnnotation] == "true"
+	va, detachedRemoved := h.prepareVADetached(logger, va)
+
+	if finalizerAdded || nodeIDAdded || detachedRemoved {
 		if va, err = h.patchVA(ctx, originalVA, va); err != nil {
-			return originalVA, nil, fmt.Errorf("could not save VolumeAttachment: %s", err)
+			return originalVA, nil, false, fmt.Errorf("could not save VolumeAttachment: %s", err)
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, h.timeout)
-	ctx = markAsMigrated(ctx, migratable)
+	ctx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+	ctx = withAuditInfo(markAsMigrated(ctx, migratable), va)
 	defer cancel()
-	// We're not interested in `detached` return value, the controller will
-	// issue Detach to be sure the volume is really detached.
-	publishInfo, _, err := h.attacher.Attach(ctx, volumeHandle, readOnly, nodeID, volumeCapabilities, attributes, secrets)
+	ctx, span := startSpan(ctx, "Attach", attrVolumeHandle.String(volumeHandle), attrNodeID.String(nodeID))
+	publishInfo, detached, err := h.attacher.Attach(ctx, volumeHandle, readOnly, nodeID, volumeCapabilities, attributes, secrets)
+	endSpan(span, err)
 	if err != nil {
-		return va, nil, err
+		return va, nil, detached && neverPublished, err
 	}
 
-	return va, publishInfo, nil
+	return va, publishInfo, false, nil
+}
+
+// checkMultiAttach returns an error when the volume has a single node access
+// mode and it is attached or being attached to another node. The volume is
+// looked up by its handle, so VolumeAttachments of different PVs that point
+// to the same volume (e.g. statically provisioned ones) are found too. The
+// caller must hold publishingMux.
+func (h *csiHandler) checkMultiAttach(va *storage.VolumeAttachment, volumeHandle string, volumeCapabilities *csi.VolumeCapability) error {
+	mode := volumeCapabilities.GetAccessMode().GetMode()
+	switch mode {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+	default:
+		return nil
+	}
+
+	vas, err := listVAsByIndex(h.vaIndexer, vaByInlineVolumeHandleIndex, volumeHandle)
+	if err != nil {
+		return err
+	}
+	pvs, err := h.pvIndexer.ByIndex(pvByVolumeHandleIndex, volumeHandle)
+	if err != nil {
+		return err
+	}
+	for _, obj := range pvs {
+		pv, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			continue
+		}
+		pvVAs, err := listVAsByIndex(h.vaIndexer, vaByPVNameIndex, pv.Name)
+		if err != nil {
+			return err
+		}
+		vas = append(vas, pvVAs...)
+	}
+
+	for _, other := range vas {
+		if other.Name == va.Name || other.Spec.Attacher != h.attacherName || other.Spec.NodeName == va.Spec.NodeName {
+			continue
+		}
+		if other.Status.Attached || h.publishing.Has(other.Name) || h.mayBeAttached(other, va) {
+			return fmt.Errorf("volume %q cannot be attached to node %q with access mode %s: it is attached to node %q by VolumeAttachment %s",
+				volumeHandle, va.Spec.NodeName, mode, other.Spec.NodeName, other.Name)
+		}
+	}
+	return nil
+}
+
+// startPublish checks that the volume can be attached by the VolumeAttachment
+// and marks its ControllerPublish as in progress until the returned function
+// is called, so concurrent attaches of the same single node volume are
+// checked against it.
+func (h *csiHandler) startPublish(va *storage.VolumeAttachment, volumeHandle string, volumeCapabilities *csi.VolumeCapability) (func(), error) {
+	h.publishingMux.Lock()
+	defer h.publishingMux.Unlock()
+	if err := h.checkMultiAttach(va, volumeHandle, volumeCapabilities); err != nil {
+		return nil, err
+	}
+	h.publishing.Insert(va.Name)
+	return func() {
+		h.publishingMux.Lock()
+		defer h.publishingMux.Unlock()
+		h.publishing.Delete(va.Name)
+	}, nil
+}
+
+// mayBeAttached returns true when the volume of other VolumeAttachment may be
+// attached to its node although it is not marked as attached. The finalizer
+// is present from the first ControllerPublish until a successful
+// ControllerUnpublish. When both VolumeAttachments have it and neither is
+// attached, only the older one may proceed, so they do not block each other
+// forever.
+func (h *csiHandler) mayBeAttached(other, va *storage.VolumeAttachment) bool {
+	if !h.hasVAFinalizer(other) {
+		return false
+	}
+	if other.DeletionTimestamp != nil {
+		// It is being detached.
+		return true
+	}
+	if c := other.CreationTimestamp.Compare(va.CreationTimestamp.Time); c != 0 {
+		return c < 0
+	}
+	return other.Name < va.Name
 }
 
 func (h *csiHandler) csiDetach(ctx context.Context, va *storage.VolumeAttachment) (*storage.VolumeAttachment, error) {
 	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Starting detach operation")
 
+	req, err := h.getDetachRequest(ctx, va)
+	if err != nil {
+		return va, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+	ctx = withAuditInfo(markAsMigrated(ctx, req.migratable), va)
+	defer cancel()
+	detachCtx, span := startSpan(ctx, "Detach", attrVolumeHandle.String(req.volumeHandle), attrNodeID.String(req.nodeID))
+	err = h.attacher.Detach(detachCtx, req.volumeHandle, req.nodeID, req.secrets)
+	endSpan(span, err)
+	if err != nil {
+		// The volume may not be fully detached. Save the error and try again
+		// after backoff.
+		return va, err
+	}
+	logger.V(2).Info("Detached")
+
+	if va, err := markAsDetached(ctx, h.client, va); err != nil {
+		return va, fmt.Errorf("could not mark as detached: %s", err)
+	}
+	observeDetached(h.attacherName, va)
+
+	return va, nil
+}
+
+// detachRequest are arguments of ControllerUnpublish of a VolumeAttachment.
+type detachRequest struct {
+	volumeHandle string
+	nodeID       string
+	secrets      map[string]string
+	migratable   bool
+}
+
+// getDetachRequest finds the volume handle, node ID and secrets of
+// the VolumeAttachment, including translation of migrated volumes.
+func (h *csiHandler) getDetachRequest(ctx context.Context, va *storage.VolumeAttachment) (detachRequest, error) {
+	logger := klog.FromContext(ctx)
+
 	var csiSource *v1.CSIPersistentVolumeSource
+	var pv *v1.PersistentVolume
 	var migratable bool
 	if va.Spec.Source.PersistentVolumeName != nil {
 		if va.Spec.Source.InlineVolumeSpec != nil {
-			return va, errors.New("both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")
+			return detachRequest{}, errors.New("both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")
 		}
-		pv, err := h.pvLister.Get(*va.Spec.Source.PersistentVolumeName)
+		var err error
+		pv, err = h.getPV(ctx, *va.Spec.Source.PersistentVolumeName)
 		if err != nil {
-			return va, err
+			return detachRequest{}, err
 		}
 		if h.translator.IsPVMigratable(pv) {
 			pv, err = h.translator.TranslateInTreePVToCSI(logger, pv)
 			if err != nil {
-				return va, fmt.Errorf("failed to translate in tree pv to CSI: %v", err)
+				return detachRequest{}, fmt.Errorf("failed to translate in tree pv to CSI: %v", err)
 			}
 			migratable = true
 		}
 		csiSource, err = getCSISource(&pv.Spec)
 		if err != nil {
-			return va, err
+			return detachRequest{}, err
 		}
 	} else if va.Spec.Source.InlineVolumeSpec != nil {
 		if va.Spec.Source.InlineVolumeSpec.CSI != nil {
 			csiSource = va.Spec.Source.InlineVolumeSpec.CSI
 		} else {
-			return va, errors.New("inline volume spec contains nil CSI source")
+			return detachRequest{}, errors.New("inline volume spec contains nil CSI source")
 		}
 	} else {
-		return va, errors.New("neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source")
+		return detachRequest{}, errors.New("neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source")
 	}
 
 	volumeHandle, _, err := GetVolumeHandle(csiSource)
 	if err != nil {
-		return va, err
+		return detachRequest{}, err
 	}
-	secrets, err := h.getCredentialsFromPV(ctx, csiSource)
+	secrets, err := h.getCredentialsFromPV(ctx, pv, csiSource)
 	if err != nil {
-		return va, err
+		return detachRequest{}, err
 	}
 
 	nodeID, err := h.getNodeID(logger, h.attacherName, va.Spec.NodeName, va)
 	if err != nil {
-		return va, err
+		return detachRequest{}, err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, h.timeout)
-	ctx = markAsMigrated(ctx, migratable)
-	defer cancel()
-	err = h.attacher.Detach(ctx, volumeHandle, nodeID, secrets)
-	if err != nil {
-		// The volume may not be fully detached. Save the error and try again
-		// after backoff.
-		return va, err
-	}
-	logger.V(2).Info("Detached")
+	return detachRequest{volumeHandle: volumeHandle, nodeID: nodeID, secrets: secrets, migratable: migratable}, nil
+}
 
-	if va, err := markAsDetached(ctx, h.client, va); err != nil {
-		return va, fmt.Errorf("could not mark as detached: %s", err)
+// saveAttachError saves the attach error and its reason to the VolumeAttachment.
+// detached is the value returned by csiAttach, it is true only when all
+// ControllerPublish calls of the VolumeAttachment failed with a final error.
+func (h *csiHandler) saveAttachError(ctx context.Context, va *storage.VolumeAttachment, err error, detached bool) (*storage.VolumeAttachment, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info("Saving attach error")
+	annotations := map[string]string{
+		vaAttachErrorReasonAnnotation: string(classifyError(err)),
+		vaDetachedAnnotation:          "",
+	}
+	if detached {
+		annotations[vaDetachedAnnotation] = "true"
 	}
 
-	return va, nil
+	// The status subresource ignores annotations, so they need their own
+	// patch. It is sent only when the annotations change.
+	clone := va.DeepCopy()
+	clone.Status.AttachError = newVolumeError(err)
+	newVa, patchErr := h.patchVA(ctx, va, clone, "status")
+	if patchErr != nil {
+		return va, patchErr
+	}
+	if newVa, patchErr = h.saveAnnotations(ctx, newVa, annotations); patchErr != nil {
+		return newVa, patchErr
+	}
+	logger.V(4).Info("Saved attach error")
+	return newVa, nil
 }
 
-func (h *csiHandler) saveAttachError(ctx context.Context, va *storage.VolumeAttachment, err error) (*storage.VolumeAttachment, error) {
+func (h *csiHandler) saveDetachError(ctx context.Context, va *storage.VolumeAttachment, err error) (*storage.VolumeAttachment, error) {
 	logger := klog.FromContext(ctx)
-	logger.V(4).Info("Saving attach error")
+	logger.V(4).Info("Saving detach error")
 	clone := va.DeepCopy()
+	clone.Status.DetachError = newVolumeError(err)
 
+	newVa, patchErr := h.patchVA(ctx, va, clone, "status")
+	if patchErr != nil {
+		return va, patchErr
+	}
+	annotations := map[string]string{
+		vaDetachErrorReasonAnnotation: string(classifyError(err)),
+	}
+	if newVa, patchErr = h.saveAnnotations(ctx, newVa, annotations); patchErr != nil {
+		return newVa, patchErr
+	}
+	logger.V(4).Info("Saved detach error")
+	return newVa, nil
+}
+
+// newVolumeError returns VolumeError with the error message and, when
+// MutableCSINodeAllocatableCount is enabled, its gRPC code.
+func newVolumeError(err error) *storage.VolumeError {
 	volumeError := &storage.VolumeError{
 		Message: err.Error(),
 		Time:    metav1.Now(),
 	}
-
 	if utilfeature.DefaultFeatureGate.Enabled(features.MutableCSINodeAllocatableCount) {
 		if st, ok := status.FromError(err); ok {
 			errorCode := int32(st.Code())
 			volumeError.ErrorCode = &errorCode
 		}
 	}
-
-	clone.Status.AttachError = volumeError
-
-	var newVa *storage.VolumeAttachment
-	if newVa, err = h.patchVA(ctx, va, clone, "status"); err != nil {
-		return va, err
-	}
-	logger.V(4).Info("Saved attach error")
-	return newVa, nil
+	return volumeError
 }
 
-func (h *csiHandler) saveDetachError(ctx context.Context, va *storage.VolumeAttachment, err error) (*storage.VolumeAttachment, error) {
-	logger := klog.FromContext(ctx)
-	logger.V(4).Info("Saving detach error")
+// saveAnnotations sets the given annotations of the VolumeAttachment.
+// Annotations with an empty value are removed. The VolumeAttachment is
+// patched only when an annotation changes.
+func (h *csiHandler) saveAnnotations(ctx context.Context, va *storage.VolumeAttachment, annotations map[string]string) (*storage.VolumeAttachment, error) {
 	clone := va.DeepCopy()
-	clone.Status.DetachError = &storage.VolumeError{
-		Message: err.Error(),
-		Time:    metav1.Now(),
+	for annotation, value := range annotations {
+		if value == "" {
+			delete(clone.Annotations, annotation)
+			continue
+		}
+		if clone.Annotations == nil {
+			clone.Annotations = map[string]string{}
+		}
+		clone.Annotations[annotation] = value
 	}
-
-	var newVa *storage.VolumeAttachment
-	if newVa, err = h.patchVA(ctx, va, clone, "status"); err != nil {
-		return va, err
+	if maps.Equal(va.Annotations, clone.Annotations) {
+		return va, nil
 	}
-	logger.V(4).Info("Saved detach error")
-	return newVa, nil
+	return h.patchVA(ctx, va, clone)
 }
 
 func (h *csiHandler) SyncNewOrUpdatedPersistentVolume(ctx context.Context, pv *v1.PersistentVolume) {
@@ -687,20 +1362,18 @@ func (h *csiHandler) SyncNewOrUpdatedPersistentVolume(ctx context.Context, pv *v
 	}
 
 	// Check that there is no VA that requires the PV
-	vas, err := h.vaLister.List(labels.Everything())
+	vas, err := listVAsByIndex(h.vaIndexer, vaByPVNameIndex, pv.Name)
 	if err != nil {
 		// Failed listing VAs? Try again with exp. backoff
 		logger.Error(err, "Failed to list VolumeAttachments for PersistentVolume")
 		h.pvQueue.AddRateLimited(pv.Name)
 		return
 	}
-	for _, va := range vas {
-		if va.Spec.Source.PersistentVolumeName != nil && *va.Spec.Source.PersistentVolumeName == pv.Name {
-			// This PV is needed by this VA, don't remove finalizer
-			logger.V(4).Info("CSIHandler: processing PersistentVolume: VolumeAttachment was found", "VolumeAttachment", va.Name)
-			h.pvQueue.Forget(pv.Name)
-			return
-		}
+	if len(vas) > 0 {
+		// This PV is needed by this VA, don't remove finalizer
+		logger.V(4).Info("CSIHandler: processing PersistentVolume: VolumeAttachment was found", "VolumeAttachment", vas[0].Name)
+		h.pvQueue.Forget(pv.Name)
+		return
 	}
 	// No VA found -> remove finalizer
 	logger.V(4).Info("CSIHandler: processing PersistentVolume: no VolumeAttachment found, removing finalizer")
@@ -711,37 +1384,143 @@ func (h *csiHandler) SyncNewOrUpdatedPersistentVolume(ctx context.Context, pv *v
 		return
 	}
 
-	if _, err = h.client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+	patchCtx, span := startSpan(ctx, "PatchPersistentVolume", attrPersistentVolume.String(pv.Name))
+	_, err = h.client.CoreV1().PersistentVolumes().Patch(patchCtx, pv.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	endSpan(span, err)
+	if err != nil {
 		logger.Error(err, "Failed to remove finalizer from PersistentVolume")
 		h.pvQueue.AddRateLimited(pv.Name)
 		return
 	}
 
+	pvFinalizersRemoved.WithLabelValues(h.attacherName).Inc()
 	logger.V(2).Info("Removed finalizer from PersistentVolume")
 	h.pvQueue.Forget(pv.Name)
 }
 
-func (h *csiHandler) getCredentialsFromPV(ctx context.Context, csiSource *v1.CSIPersistentVolumeSource) (map[string]string, error) {
+// getCredentialsFromPV returns content of ControllerPublish secret of the
+// volume. pv is nil for inline volumes. PVs without ControllerPublishSecretRef
+// may get a fallback secret from their StorageClass or the driver-wide default.
+func (h *csiHandler) getCredentialsFromPV(ctx context.Context, pv *v1.PersistentVolume, csiSource *v1.CSIPersistentVolumeSource) (map[string]string, error) {
 	if csiSource == nil {
 		return nil, fmt.Errorf("CSI volume source was nil")
 	}
 	secretRef := csiSource.ControllerPublishSecretRef
+	if secretRef == nil && pv != nil {
+		var err error
+		secretRef, err = h.getFallbackSecretRef(pv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ControllerPublish secret: %s", err)
+		}
+	}
 	if secretRef == nil {
 		return nil, nil
 	}
 
-	secret, err := h.client.CoreV1().Secrets(secretRef.Namespace).Get(ctx, secretRef.Name, metav1.GetOptions{})
+	ctx, span := startSpan(ctx, "GetSecret", attrSecret.String(secretRef.Namespace+"/"+secretRef.Name))
+	data, err := h.secretCache.get(ctx, secretRef.Namespace, secretRef.Name)
+	endSpan(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load secret \"%s/%s\": %s", secretRef.Namespace, secretRef.Name, err)
 	}
 	credentials := map[string]string{}
-	for key, value := range secret.Data {
+	for key, value := range data {
 		credentials[key] = string(value)
 	}
 
 	return credentials, nil
 }
 
+// secretAdded re-queues VolumeAttachments that use the secret. They may have
+// failed because the secret did not exist. Secrets of the initial list
+// existed before, their VolumeAttachments are processed anyway.
+func (h *csiHandler) secretAdded(obj any, isInInitialList bool) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	h.secretCache.invalidate(secret.Namespace, secret.Name)
+	if isInInitialList {
+		return
+	}
+	h.enqueueVAsBySecret(secret.Namespace, secret.Name)
+}
+
+// secretUpdated invalidates the cached secret and re-queues VolumeAttachments
+// that use it.
+func (h *csiHandler) secretUpdated(old, new any) {
+	oldSecret, ok := old.(*v1.Secret)
+	if !ok {
+		return
+	}
+	newSecret, ok := new.(*v1.Secret)
+	if !ok {
+		return
+	}
+	if oldSecret.ResourceVersion == newSecret.ResourceVersion {
+		// Periodic resync, the secret has not changed.
+		return
+	}
+	h.secretCache.invalidate(newSecret.Namespace, newSecret.Name)
+	h.enqueueVAsBySecret(newSecret.Namespace, newSecret.Name)
+}
+
+// secretDeleted invalidates the cached secret. There is no need to re-queue
+// anything, VolumeAttachments that use the secret would fail now.
+func (h *csiHandler) secretDeleted(obj any) {
+	if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok && unknown.Obj != nil {
+		obj = unknown.Obj
+	}
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	h.secretCache.invalidate(secret.Namespace, secret.Name)
+}
+
+// enqueueVAsBySecret adds VolumeAttachments of this driver whose volumes use
+// the secret as ControllerPublishSecretRef or as the fallback secret to
+// vaQueue.
+func (h *csiHandler) enqueueVAsBySecret(namespace, name string) {
+	key := secretKey(namespace, name)
+	logger := klog.Background().WithValues("secret", key)
+	vas, err := listVAsByIndex(h.vaIndexer, vaByInlineSecretIndex, key)
+	if err != nil {
+		logger.Error(err, "Failed to list VolumeAttachments by secret")
+		return
+	}
+	pvs, err := h.pvIndexer.ByIndex(pvBySecretIndex, key)
+	if err != nil {
+		logger.Error(err, "Failed to list PersistentVolumes by secret")
+		return
+	}
+	for _, obj := range pvs {
+		pv, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			continue
+		}
+		pvVAs, err := listVAsByIndex(h.vaIndexer, vaByPVNameIndex, pv.Name)
+		if err != nil {
+			logger.Error(err, "Failed to list VolumeAttachments by PersistentVolume", "PersistentVolume", klog.KObj(pv))
+			return
+		}
+		vas = append(vas, pvVAs...)
+	}
+	fallbackVAs, err := h.listVAsByFallbackSecret(key)
+	if err != nil {
+		logger.Error(err, "Failed to list VolumeAttachments by fallback secret")
+		return
+	}
+	vas = append(vas, fallbackVAs...)
+	for _, va := range vas {
+		if va.Spec.Attacher != h.attacherName {
+			continue
+		}
+		logger.V(4).Info("Secret changed, re-queuing VolumeAttachment", "VolumeAttachment", klog.KObj(va))
+		h.vaQueue.Add(va.Name)
+	}
+}
+
 // getNodeID finds node ID from CSINode API object. If caller wants, it can find
 // node ID stored in VolumeAttachment annotation.
 func (h *csiHandler) getNodeID(logger klog.Logger, driver string, nodeName string, va *storage.VolumeAttachment) (string, error) {
@@ -781,7 +1560,13 @@ func (h *csiHandler) patchVA(ctx context.Context, va, clone *storage.VolumeAttac
 		return va, err
 	}
 
+	attrs := []attribute.KeyValue{attrVolumeAttachment.String(va.Name)}
+	if len(subresources) > 0 {
+		attrs = append(attrs, attrSubresource.String(subresources[0]))
+	}
+	ctx, span := startSpan(ctx, "PatchVolumeAttachment", attrs...)
 	newVa, err := h.client.StorageV1().VolumeAttachments().Patch(ctx, va.Name, types.MergePatchType, patch, metav1.PatchOptions{}, subresources...)
+	endSpan(span, err)
 	if err != nil {
 		return va, err
 	}
@@ -791,3 +1576,13 @@ func (h *csiHandler) patchVA(ctx context.Context, va, clone *storage.VolumeAttac
 func markAsMigrated(parent context.Context, hasMigrated bool) context.Context {
 	return context.WithValue(parent, connection.AdditionalInfoKey, connection.AdditionalInfo{Migrated: strconv.FormatBool(hasMigrated)})
 }
+
+// withAuditInfo adds names of the VolumeAttachment, its node and PV to the
+// context, for the audit log of ControllerPublish / ControllerUnpublish.
+func withAuditInfo(parent context.Context, va *storage.VolumeAttachment) context.Context {
+	info := attacher.AuditInfo{Node: va.Spec.NodeName, VolumeAttachment: va.Name}
+	if va.Spec.Source.PersistentVolumeName != nil {
+		info.PersistentVolume = *va.Spec.Source.PersistentVolumeName
+	}
+	return attacher.WithAuditInfo(parent, info)
+}
@@ -20,10 +20,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/kubernetes-csi/csi-lib-utils/connection"
 	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
@@ -32,17 +39,24 @@ import (
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	featuregatetesting "k8s.io/component-base/featuregate/testing"
 	csitranslator "k8s.io/csi-translation-lib"
 	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
 	_ "k8s.io/klog/v2/ktesting/init"
 )
 
@@ -61,37 +75,41 @@ var (
 
 var timeout = 10 * time.Millisecond
 
-func csiHandlerFactory(client kubernetes.Interface, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
+func csiHandlerFactory(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
 	return NewCSIHandler(
 		client,
+		recorder,
 		testAttacherName,
 		csi,
 		lister,
-		informerFactory.Core().V1().PersistentVolumes().Lister(),
+		informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer(),
 		informerFactory.Storage().V1().CSINodes().Lister(),
-		informerFactory.Storage().V1().VolumeAttachments().Lister(),
+		informerFactory.Storage().V1().VolumeAttachments().Informer().GetIndexer(),
 		&timeout,
 		true,  /* supports PUBLISH_READONLY */
 		false, /* does not support SINGLE_NODE_MULTI_WRITER access mode */
 		csitranslator.New(),
 		defaultFSType,
+		CSIHandlerOptions{},
 	)
 }
 
-func csiHandlerFactoryNoReadOnly(client kubernetes.Interface, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
+func csiHandlerFactoryNoReadOnly(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
 	return NewCSIHandler(
 		client,
+		recorder,
 		testAttacherName,
 		csi,
 		lister,
-		informerFactory.Core().V1().PersistentVolumes().Lister(),
+		informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer(),
 		informerFactory.Storage().V1().CSINodes().Lister(),
-		informerFactory.Storage().V1().VolumeAttachments().Lister(),
+		informerFactory.Storage().V1().VolumeAttachments().Informer().GetIndexer(),
 		&timeout,
 		false, /* does not support PUBLISH_READONLY */
 		false, /* does not support SINGLE_NODE_MULTI_WRITER access mode */
 		csitranslator.New(),
 		defaultFSType,
+		CSIHandlerOptions{},
 	)
 }
 
@@ -193,6 +211,25 @@ func vaInlineSpecWithSecret(va *storage.VolumeAttachment, secretName string) *st
 	return va
 }
 
+func pvWithClaimRef(pv *v1.PersistentVolume) *v1.PersistentVolume {
+	pv.Spec.ClaimRef = &v1.ObjectReference{
+		Kind:      "PersistentVolumeClaim",
+		Namespace: "default",
+		Name:      "pvc1",
+	}
+	return pv
+}
+
+func pvWithName(pv *v1.PersistentVolume, name string) *v1.PersistentVolume {
+	pv.Name = name
+	return pv
+}
+
+func pvWithAccessModes(pv *v1.PersistentVolume, modes ...v1.PersistentVolumeAccessMode) *v1.PersistentVolume {
+	pv.Spec.AccessModes = modes
+	return pv
+}
+
 func pvReadOnly(pv *v1.PersistentVolume) *v1.PersistentVolume {
 	pv.Spec.PersistentVolumeSource.CSI.ReadOnly = true
 	return pv
@@ -294,6 +331,29 @@ func vaWithAttachErrorAndCode(va *storage.VolumeAttachment, message string, code
 	return va
 }
 
+func vaWithErrorReason(va *storage.VolumeAttachment, annotation string, reason ErrorReason) *storage.VolumeAttachment {
+	// Copy the annotations, the shared ann map must not be modified.
+	annotations := maps.Clone(va.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotation] = string(reason)
+	va.Annotations = annotations
+	return va
+}
+
+// errorReasonAction returns a patch that saves the error reason annotation,
+// or removes it when the reason is empty.
+func errorReasonAction(annotation string, reason ErrorReason) core.Action {
+	withoutReason := va(false, fin, ann)
+	withReason := vaWithErrorReason(va(false, fin, ann), annotation, reason)
+	p := patch(withoutReason, withReason)
+	if reason == "" {
+		p = patch(withReason, withoutReason)
+	}
+	return core.NewPatchAction(storage.SchemeGroupVersion.WithResource("volumeattachments"), metav1.NamespaceNone, testPVName+"-"+testNodeName, types.MergePatchType, p)
+}
+
 func TestCSIHandler(t *testing.T) {
 	vaGroupResourceVersion := schema.GroupVersionResource{
 		Group:    storage.GroupName,
@@ -543,6 +603,7 @@ func TestCSIHandler(t *testing.T) {
 						vaWithAttachError(va(false, "", nil),
 							"failed to load secret \"default/unknownSecret\": secrets \"unknownSecret\" not found")),
 					"status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 			expectedCSICalls: []csiCall{},
 		},
@@ -599,6 +660,7 @@ func TestCSIHandler(t *testing.T) {
 						vaWithAttachError(va(false, "", nil),
 							"could not add PersistentVolume finalizer: persistentvolume \"pv1\" is forbidden: Mock"+
 								" error")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 				// Second PV Finalizer - succeeds
 				core.NewPatchAction(pvGroupResourceVersion, metav1.NamespaceNone, testPVName,
 					types.JSONPatchType, pvAddFinalizerJSON(pv())),
@@ -615,7 +677,10 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(
 						vaWithAttachError(va(false, fin, ann),
 							"could not add PersistentVolume finalizer: persistentvolume \"pv1\" is forbidden: Mock error"),
-						va(true, fin, ann)), "status")},
+						va(true, fin, ann)), "status"),
+				// The error reason is removed
+				errorReasonAction(vaAttachErrorReasonAnnotation, ""),
+			},
 			expectedCSICalls: []csiCall{
 				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
 			},
@@ -636,6 +701,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(va(false /*attached*/, fin /*finalizer*/, ann /* annotations */),
 						vaWithAttachError(va(false, fin, ann), "PersistentVolume \"pv1\" is marked for deletion")),
 					"status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 			expectedCSICalls: []csiCall{},
 		},
@@ -670,6 +736,7 @@ func TestCSIHandler(t *testing.T) {
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
 						"persistentvolume \"pv1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonNotFound),
 			},
 		},
 		{
@@ -704,6 +771,118 @@ func TestCSIHandler(t *testing.T) {
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
 						"persistentvolume \"pv1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonNotFound),
+			},
+		},
+		{
+			name: "RWO volume attached to another node via a static PV -> error",
+			initialObjects: []runtime.Object{
+				pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce),
+				pvWithName(pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce), "pv2"),
+				createVolumeAttachment(testAttacherName, "pv2", "node2", true, fin, nil),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
+						"volume \"handle1\" cannot be attached to node \"node1\" with access mode SINGLE_NODE_WRITER: it is attached to node \"node2\" by VolumeAttachment pv2-node2")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
+			},
+		},
+		{
+			name: "RWO volume being detached from another node -> error",
+			initialObjects: []runtime.Object{
+				pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce),
+				deleted(createVolumeAttachment(testAttacherName, testPVName, "node2", false, fin, nil)),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
+						"volume \"handle1\" cannot be attached to node \"node1\" with access mode SINGLE_NODE_WRITER: it is attached to node \"node2\" by VolumeAttachment pv1-node2")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
+			},
+		},
+		{
+			name: "RWO volume being attached to another node by a newer VolumeAttachment -> successful attachment",
+			initialObjects: []runtime.Object{
+				pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce),
+				createdAt(createVolumeAttachment(testAttacherName, testPVName, "node2", false, fin, nil), time.Unix(2000, 0)),
+				csiNode(),
+			},
+			addedVA: createdAt(va(false, fin, ann), time.Unix(1000, 0)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(createdAt(va(false, fin, ann), time.Unix(1000, 0)),
+						createdAt(va(true /*attached*/, fin, ann), time.Unix(1000, 0))), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name: "RWO volume being attached to another node by an older VolumeAttachment -> error",
+			initialObjects: []runtime.Object{
+				pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce),
+				createdAt(createVolumeAttachment(testAttacherName, testPVName, "node2", false, fin, nil), time.Unix(1000, 0)),
+				csiNode(),
+			},
+			addedVA: createdAt(va(false, fin, ann), time.Unix(2000, 0)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(createdAt(va(false, fin, ann), time.Unix(2000, 0)), vaWithAttachError(createdAt(va(false, fin, ann), time.Unix(2000, 0)),
+						"volume \"handle1\" cannot be attached to node \"node1\" with access mode SINGLE_NODE_WRITER: it is attached to node \"node2\" by VolumeAttachment pv1-node2")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
+			},
+		},
+		{
+			name: "RWO volume detached from another node -> successful attachment",
+			initialObjects: []runtime.Object{
+				pvWithAccessModes(pvWithFinalizer(), v1.ReadWriteOnce),
+				createVolumeAttachment(testAttacherName, testPVName, "node2", false, "", nil),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						va(true /*attached*/, fin, ann)), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name: "RWX volume attached to another node -> successful attachment",
+			initialObjects: []runtime.Object{
+				pvWithFinalizer(),
+				createVolumeAttachment(testAttacherName, testPVName, "node2", true, fin, nil),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						va(true /*attached*/, fin, ann)), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name: "inline RWO volume attached to another node -> error",
+			initialObjects: []runtime.Object{
+				vaWithInlineSpec(createVolumeAttachment(testAttacherName, "inline", "node2", true, fin, nil)),
+				csiNode(),
+			},
+			addedVA: vaWithInlineSpec(va(false, fin, ann)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(vaWithInlineSpec(va(false, fin, ann)), vaWithAttachError(vaWithInlineSpec(va(false, fin, ann)),
+						"volume \"handle1\" cannot be attached to node \"node1\" with access mode SINGLE_NODE_WRITER: it is attached to node \"node2\" by VolumeAttachment inline-node2")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 		},
 		{
@@ -715,6 +894,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(vaWithNoPVReferenceNorInlineVolumeSpec(va(false, fin, ann)),
 						vaWithAttachError(vaWithNoPVReferenceNorInlineVolumeSpec(va(false, fin, ann)),
 							"neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 		},
 		{
@@ -726,6 +906,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(vaWithNoPVReferenceNorInlineVolumeSpec(va(false, fin, ann)),
 						vaWithAttachError(vaWithNoPVReferenceNorInlineVolumeSpec(va(false, fin, ann)),
 							"both InlineCSIVolumeSource and PersistentVolumeName specified in VA source")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 		},
 		{
@@ -736,6 +917,7 @@ func TestCSIHandler(t *testing.T) {
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
 						"csinode.storage.k8s.io \"node1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonNotFound),
 			},
 		},
 		{
@@ -843,6 +1025,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(va(false /*attached*/, fin /*finalizer*/, ann /* annotations */),
 						vaWithAttachError(va(false, fin, ann), "mock error")),
 					"status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 				// Our implementation of fake PATCH did not store the first VA with annotation + finalizer,
 				// the controller tries to save it again.
 				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
@@ -853,6 +1036,7 @@ func TestCSIHandler(t *testing.T) {
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(vaWithAttachError(va(false, fin, ann), "mock error"),
 						va(true /*attached*/, fin, ann)), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ""),
 			},
 			expectedCSICalls: []csiCall{
 				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, fmt.Errorf("mock error"), notDetached, noMetadata, 0},
@@ -874,6 +1058,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(va(false /*attached*/, fin /*finalizer*/, ann /* annotations */),
 						vaWithAttachError(va(false, fin, ann), "context deadline exceeded")),
 					"status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(va(false /*attached*/, "" /*finalizer*/, nil /* annotations */),
 						va(false /*attached*/, fin, ann))),
@@ -881,6 +1066,7 @@ func TestCSIHandler(t *testing.T) {
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(vaWithAttachError(va(false, fin, ann), "context deadline exceeded"),
 						va(true /*attached*/, fin, ann)), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ""),
 			},
 			expectedCSICalls: []csiCall{
 				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 500 * time.Millisecond},
@@ -895,6 +1081,7 @@ func TestCSIHandler(t *testing.T) {
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(va(false /*attached*/, fin, ann),
 						vaWithAttachError(va(false, fin, ann), "csinode.storage.k8s.io \"node1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonNotFound),
 			},
 		},
 		{
@@ -906,6 +1093,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(va(false /*attached*/, fin, ann),
 						vaWithAttachError(va(false, fin, ann), "CSINode node1 does not contain driver csi/test")),
 					"status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 		},
 		{
@@ -1064,6 +1252,7 @@ func TestCSIHandler(t *testing.T) {
 						deleted(vaWithDetachError(va(true, fin, ann),
 							"failed to load secret \"default/unknownSecret\": secrets \"unknownSecret\" not found"+
 								""))), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 			expectedCSICalls: []csiCall{},
 		},
@@ -1076,6 +1265,7 @@ func TestCSIHandler(t *testing.T) {
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(true, "", ann)),
 						deleted(vaWithDetachError(va(true, "", ann), "mock error"))), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
 				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(true, fin, ann)),
 						deleted(va(true, "", ann)))),
@@ -1097,6 +1287,7 @@ func TestCSIHandler(t *testing.T) {
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(true, "", ann)),
 						deleted(vaWithDetachError(va(true, "", ann), "context deadline exceeded"))), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
 				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(true, fin, ann)),
 						deleted(va(true /*attached*/, "", ann)))),
@@ -1126,6 +1317,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(deleted(va(true, "", ann)),
 						deleted(vaWithDetachError(va(true, "", ann), "persistentvolume \"pv1\" not found"))),
 					"status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonNotFound),
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone,
 					testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(false, "", ann)),
@@ -1172,6 +1364,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(deleted(va(true, fin, ann)),
 						deleted(vaWithDetachError(va(true, fin, ann), "persistentvolume \"pv1\" not found"))),
 					"status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonNotFound),
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(deleted(va(true, fin, ann)),
 						deleted(vaWithDetachError(va(true, fin, ann), "persistentvolume \"pv1\" not found"))),
@@ -1188,6 +1381,7 @@ func TestCSIHandler(t *testing.T) {
 						deleted(vaWithDetachError(vaWithNoPVReferenceNorInlineVolumeSpec(va(true, fin, ann)),
 							"neither InlineCSIVolumeSource nor PersistentVolumeName specified in VA source"))),
 					"status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
 			},
 		},
 		{
@@ -1200,7 +1394,8 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(deleted(vaAddInlineSpec(va(true, fin, ann))),
 						deleted(vaWithDetachError(vaAddInlineSpec(va(true, fin, ann)),
 							"both InlineCSIVolumeSource and PersistentVolumeName specified in VA source"))),
-					"status")},
+					"status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient)},
 		},
 		{
 			name:           "detach unknown node -> error",
@@ -1212,6 +1407,7 @@ func TestCSIHandler(t *testing.T) {
 					types.MergePatchType, patch(deleted(va(true, fin, nil)),
 						deleted(vaWithDetachError(va(true, fin, nil),
 							"csinode.storage.k8s.io \"node1\" not found"))), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonNotFound),
 			},
 		},
 		{
@@ -1268,6 +1464,7 @@ func TestCSIHandler(t *testing.T) {
 						vaWithDetachError(deleted(va(true, fin, ann)),
 							"could not mark as detached: volumeattachments.storage.k8s."+
 								"io \"pv1-node1\" is forbidden: mock error")), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
 				// Second save of attached=false succeeds and the finalizer is subsequently deleted.
 				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
 					types.MergePatchType, patch(
@@ -1443,6 +1640,7 @@ func TestVolumeAttachmentWithErrorCode(t *testing.T) {
 				testPVName+"-"+testNodeName,
 				types.MergePatchType, patch(va(false, fin, ann),
 					vaWithAttachErrorAndCode(va(false, fin, ann), "rpc error: code = ResourceExhausted desc = mock rpc error", codes.ResourceExhausted)), "status"),
+			errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonResourceExhausted),
 
 			// On retry, the controller reads the original VA again and tries to re-apply the finalizer/annotation.
 			core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
@@ -1459,6 +1657,8 @@ func TestVolumeAttachmentWithErrorCode(t *testing.T) {
 					va(true /*attached*/, fin, ann),
 				),
 				"status"),
+			// The error reason is removed as well.
+			errorReasonAction(vaAttachErrorReasonAnnotation, ""),
 		},
 		expectedCSICalls: []csiCall{
 			{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, status.Error(codes.ResourceExhausted, "mock rpc error"), notDetached, noMetadata, 0},
@@ -1469,6 +1669,282 @@ func TestVolumeAttachmentWithErrorCode(t *testing.T) {
 	runTests(t, csiHandlerFactory, []testCase{test})
 }
 
+func vaWithDetachedAnnotation(va *storage.VolumeAttachment) *storage.VolumeAttachment {
+	annotations := maps.Clone(va.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[vaDetachedAnnotation] = "true"
+	va.Annotations = annotations
+	return va
+}
+
+func TestCSIHandlerFinalAttachError(t *testing.T) {
+	vaGroupResourceVersion := schema.GroupVersionResource{
+		Group:    storage.GroupName,
+		Version:  "v1",
+		Resource: "volumeattachments",
+	}
+
+	var noMetadata map[string]string
+	var noAttrs map[string]string
+	var noSecrets map[string]string
+	var notDetached = false
+	var detached = true
+	var success error
+	var readWrite = false
+
+	finalErr := status.Error(codes.InvalidArgument, "mock error")
+	finalMessage := "rpc error: code = InvalidArgument desc = mock error"
+	transientErr := status.Error(codes.Unavailable, "mock error")
+	transientMessage := "rpc error: code = Unavailable desc = mock error"
+	removeDetached := core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+		types.MergePatchType, patch(vaWithDetachedAnnotation(va(false, fin, ann)), va(false, fin, ann)))
+	addDetached := core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+		types.MergePatchType, patch(va(false, fin, ann), vaWithDetachedAnnotation(va(false, fin, ann))))
+
+	tests := []testCase{
+		{
+			name:           "first attach fails with final error -> VA marked as detached",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:        va(false, "", nil),
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, "", nil), va(false, fin, ann))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithAttachErrorAndCode(va(false, fin, ann), finalMessage, codes.InvalidArgument)), "status"),
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithDetachedAnnotation(vaWithErrorReason(va(false, fin, ann), vaAttachErrorReasonAnnotation, ErrorReasonFinal)))),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, finalErr, detached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "attach fails with final error after another error -> VA not marked as detached",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:        vaWithAttachError(va(false, fin, ann), "mock error"),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithAttachErrorAndCode(va(false, fin, ann), finalMessage, codes.InvalidArgument)), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonFinal),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, finalErr, detached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "attach fails with final error after a publish that may have succeeded -> VA not marked as detached",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			// ControllerPublish succeeded, but the VA was not marked as attached.
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithAttachErrorAndCode(va(false, fin, ann), finalMessage, codes.InvalidArgument)), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonFinal),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, finalErr, detached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "attach fails with final error again -> VA stays marked as detached",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA: vaWithDetachedAnnotation(vaWithErrorReason(
+				vaWithAttachError(va(false, fin, ann), "mock error"), vaAttachErrorReasonAnnotation, ErrorReasonFinal)),
+			expectedActions: []core.Action{
+				// The annotation is removed before ControllerPublish and added
+				// back after its final error.
+				removeDetached,
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithAttachErrorAndCode(va(false, fin, ann), finalMessage, codes.InvalidArgument)), "status"),
+				addDetached,
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, finalErr, detached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "attach fails with transient error after final error -> VA not marked as detached",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA: vaWithDetachedAnnotation(vaWithErrorReason(
+				vaWithAttachError(va(false, fin, ann), "mock error"), vaAttachErrorReasonAnnotation, ErrorReasonFinal)),
+			expectedActions: []core.Action{
+				removeDetached,
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann),
+						vaWithAttachErrorAndCode(va(false, fin, ann), transientMessage, codes.Unavailable)), "status"),
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(
+						vaWithErrorReason(va(false, fin, ann), vaAttachErrorReasonAnnotation, ErrorReasonFinal),
+						vaWithErrorReason(va(false, fin, ann), vaAttachErrorReasonAnnotation, ErrorReasonTransient))),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, transientErr, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "attach succeeds after final error -> annotations removed",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA: vaWithDetachedAnnotation(vaWithErrorReason(
+				vaWithAttachError(va(false, fin, ann), "mock error"), vaAttachErrorReasonAnnotation, ErrorReasonFinal)),
+			expectedActions: []core.Action{
+				removeDetached,
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(vaWithAttachError(va(false, fin, ann), "mock error"), va(true, fin, ann)), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ""),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name:           "VA marked as detached deleted -> finalizer removed without ControllerUnpublish",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:        deleted(vaWithDetachedAnnotation(vaWithAttachError(va(false, fin, ann), "mock error"))),
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(vaWithDetachedAnnotation(va(false, fin, ann))),
+						deleted(vaWithDetachedAnnotation(va(false, "", ann))))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(false, "", ann)), deleted(va(false, "", ann))), "status"),
+			},
+			expectedCSICalls: []csiCall{},
+			expectedEvents: []string{
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+			},
+		},
+		{
+			name:           "VA marked as detached without attach error deleted -> ControllerUnpublish called",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			// The annotation was not written by the attacher.
+			addedVA: deleted(vaWithDetachedAnnotation(va(false, fin, ann))),
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(vaWithDetachedAnnotation(va(false, fin, ann))),
+						deleted(vaWithDetachedAnnotation(va(false, "", ann))))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(false, "", ann)), deleted(va(false, "", ann))), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"detach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+			expectedEvents: []string{
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+			},
+		},
+	}
+
+	runTests(t, csiHandlerFactory, tests)
+}
+
+func TestCSIHandlerEvents(t *testing.T) {
+	vaGroupResourceVersion := schema.GroupVersionResource{
+		Group:    storage.GroupName,
+		Version:  "v1",
+		Resource: "volumeattachments",
+	}
+
+	var noMetadata map[string]string
+	var noAttrs map[string]string
+	var noSecrets map[string]string
+	var notDetached = false
+	var success error
+	var readWrite = false
+
+	tests := []testCase{
+		{
+			name:           "successful attachment -> events on VA, PV and PVC",
+			initialObjects: []runtime.Object{pvWithClaimRef(pvWithFinalizer()), csiNode()},
+			addedVA:        va(false, "", nil),
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, "", nil), va(false, fin, ann))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), va(true, fin, ann)), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+			expectedEvents: []string{
+				`Normal Attaching Attaching volume "pv1" to node "node1"`,
+				`Normal Attaching Attaching volume "pv1" to node "node1"`,
+				`Normal Attaching Attaching volume "pv1" to node "node1"`,
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+			},
+		},
+		{
+			name:           "failed attachment of inline volume -> events on VA only",
+			initialObjects: []runtime.Object{},
+			addedVA:        vaWithInlineSpec(va(false, "", nil)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(vaWithInlineSpec(va(false, "", nil)),
+						vaWithAttachError(vaWithInlineSpec(va(false, "", nil)), "csinode.storage.k8s.io \"node1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonNotFound),
+			},
+			expectedEvents: []string{
+				`Normal Attaching Attaching volume "handle1" to node "node1"`,
+				`Warning AttachFailed Failed to attach volume "handle1" to node "node1": csinode.storage.k8s.io "node1" not found`,
+			},
+		},
+		{
+			name:           "successful detach -> events on VA and PV",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:        deleted(va(true, fin, ann)),
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(true, fin, ann)), deleted(va(true, "", ann)))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(true, "", ann)), deleted(va(false, "", ann))), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"detach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+			expectedEvents: []string{
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+			},
+		},
+		{
+			name:           "failed detach -> warning events on VA and PV",
+			initialObjects: []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:        deleted(va(true, fin, ann)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(true, "", ann)),
+						deleted(vaWithDetachError(va(true, "", ann), "mock error"))), "status"),
+				errorReasonAction(vaDetachErrorReasonAnnotation, ErrorReasonTransient),
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(va(true, fin, ann)), deleted(va(true, "", ann)))),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(deleted(vaWithDetachError(va(true, "", ann), "mock error")),
+						deleted(va(false, "", ann))), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"detach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, fmt.Errorf("mock error"), notDetached, noMetadata, 0},
+				{"detach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+			expectedEvents: []string{
+				`Warning DetachFailed Failed to detach volume "pv1" from node "node1": mock error`,
+				`Warning DetachFailed Failed to detach volume "pv1" from node "node1": mock error`,
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+				`Normal Detached Volume "pv1" detached from node "node1"`,
+			},
+		},
+	}
+	runTests(t, csiHandlerFactory, tests)
+}
+
 func TestCSIHandlerReconcileVA(t *testing.T) {
 	nID := map[string]string{
 		vaNodeIDAnnotation: testNodeID,
@@ -1527,6 +2003,65 @@ func TestCSIHandlerReconcileVA(t *testing.T) {
 				{"detach", testVolumeHandle, testNodeID, nil, nil, false, nil, true, nil, 0},
 			},
 		},
+		{
+			name: "abnormal volume condition -> annotation and event",
+			initialObjects: []runtime.Object{
+				va(true /*attached*/, "" /*finalizer*/, nID /*annotations*/),
+				pvWithFinalizer(),
+			},
+			listerResponse: map[string][]string{
+				testVolumeHandle: {testNodeID},
+			},
+			listerConditions: map[string]*csi.VolumeCondition{
+				testVolumeHandle: {Abnormal: true, Message: "disk is degraded"},
+			},
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(true, "", nID),
+						va(true, "", map[string]string{vaNodeIDAnnotation: testNodeID, vaVolumeConditionAnnotation: "disk is degraded"}))),
+			},
+			expectedEvents: []string{
+				`Warning VolumeConditionAbnormal Volume "pv1" is abnormal: disk is degraded`,
+				`Warning VolumeConditionAbnormal Volume "pv1" is abnormal: disk is degraded`,
+			},
+		},
+		{
+			name: "unchanged abnormal volume condition -> no action",
+			initialObjects: []runtime.Object{
+				va(true /*attached*/, "" /*finalizer*/, map[string]string{vaNodeIDAnnotation: testNodeID, vaVolumeConditionAnnotation: "disk is degraded"}),
+				pvWithFinalizer(),
+			},
+			listerResponse: map[string][]string{
+				testVolumeHandle: {testNodeID},
+			},
+			listerConditions: map[string]*csi.VolumeCondition{
+				testVolumeHandle: {Abnormal: true, Message: "disk is degraded"},
+			},
+			expectedActions: []core.Action{},
+			expectedEvents:  []string{},
+		},
+		{
+			name: "volume condition back to normal -> annotation removed",
+			initialObjects: []runtime.Object{
+				va(true /*attached*/, "" /*finalizer*/, map[string]string{vaNodeIDAnnotation: testNodeID, vaVolumeConditionAnnotation: "disk is degraded"}),
+				pvWithFinalizer(),
+			},
+			listerResponse: map[string][]string{
+				testVolumeHandle: {testNodeID},
+			},
+			listerConditions: map[string]*csi.VolumeCondition{
+				testVolumeHandle: {Abnormal: false},
+			},
+			expectedActions: []core.Action{
+				core.NewPatchAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(true, "", map[string]string{vaNodeIDAnnotation: testNodeID, vaVolumeConditionAnnotation: "disk is degraded"}),
+						va(true, "", nID))),
+			},
+			expectedEvents: []string{
+				`Normal VolumeConditionNormal Volume "pv1" is healthy again`,
+				`Normal VolumeConditionNormal Volume "pv1" is healthy again`,
+			},
+		},
 		{
 			name:           "no volume attachments but existing lister response results in no action",
 			initialObjects: []runtime.Object{},
@@ -1611,3 +2146,656 @@ func TestMarkAsMigrated(t *testing.T) {
 		}
 	})
 }
+
+func TestCSIHandlerBusyNode(t *testing.T) {
+	// Handler with all slots of the node taken by another VolumeAttachment.
+	busyNodeFactory := func(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
+		h := csiHandlerFactory(client, recorder, informerFactory, csi, lister).(*csiHandler)
+		h.nodeLimiter = newNodeLimiter(1)
+		h.nodeLimiter.tryAcquire(testNodeName, "other")
+		return h
+	}
+
+	tests := []testCase{
+		{
+			name:            "VolumeAttachment added on a busy node -> no attachment",
+			initialObjects:  []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:         va(false, fin, ann),
+			expectedActions: []core.Action{},
+			expectedEvents:  []string{},
+		},
+		{
+			name:            "VolumeAttachment deleted on a busy node -> no detachment",
+			initialObjects:  []runtime.Object{pvWithFinalizer(), csiNode()},
+			addedVA:         deleted(va(true, fin, ann)),
+			expectedActions: []core.Action{},
+			expectedEvents:  []string{},
+		},
+	}
+	runTests(t, busyNodeFactory, tests)
+}
+
+func TestCSIHandlerSecretChanged(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	if err := addIndexers(pvInformer, pvIndexers(klog.Background(), csitranslator.New())); err != nil {
+		t.Fatalf("Failed to add PV indexers: %v", err)
+	}
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add VA indexers: %v", err)
+	}
+	for _, pv := range []*v1.PersistentVolume{
+		pvWithSecret(pv(), "secret"),
+		pvWithName(pvWithSecret(pv(), "other"), "pv2"),
+		pvWithName(pv(), "pv3"),
+	} {
+		if err := pvInformer.GetIndexer().Add(pv); err != nil {
+			t.Fatalf("Failed to add PV: %v", err)
+		}
+	}
+	for _, va := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, testPVName, "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv2", "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv3", "node1", false, "", nil),
+		createVolumeAttachment("other-driver", testPVName, "node2", false, "", nil),
+		vaInlineSpecWithSecret(vaWithInlineSpec(createVolumeAttachment(testAttacherName, "inline", "node1", false, "", nil)), "secret"),
+	} {
+		if err := vaInformer.GetIndexer().Add(va); err != nil {
+			t.Fatalf("Failed to add VA: %v", err)
+		}
+	}
+
+	h := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, nil).(*csiHandler)
+	vaQueue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer vaQueue.ShutDown()
+	h.Init(vaQueue, nil)
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default", ResourceVersion: "1"},
+	}
+	h.secretAdded(secret, false)
+	expectQueued := func(expected ...string) {
+		t.Helper()
+		queued := []string{}
+		for vaQueue.Len() > 0 {
+			name, _ := vaQueue.Get()
+			queued = append(queued, name)
+			vaQueue.Done(name)
+		}
+		slices.Sort(queued)
+		if !slices.Equal(queued, expected) {
+			t.Errorf("Expected queued VolumeAttachments %v, got %v", expected, queued)
+		}
+	}
+	expectQueued("inline-node1", "pv1-node1")
+
+	// Resync without any change.
+	h.secretUpdated(secret, secret)
+	expectQueued()
+
+	updated := secret.DeepCopy()
+	updated.ResourceVersion = "2"
+	h.secretUpdated(secret, updated)
+	expectQueued("inline-node1", "pv1-node1")
+
+	h.secretDeleted(updated)
+	expectQueued()
+
+	// PVs without ControllerPublishSecretRef use the default secret.
+	pv3Secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv3", Namespace: "default", ResourceVersion: "1"},
+	}
+	h.secretAdded(pv3Secret, false)
+	expectQueued()
+	h.defaultSecretRef = &v1.SecretReference{Name: "${pv.name}", Namespace: "default"}
+	h.fallbackSecrets = newFallbackSecrets()
+	h.indexFallbackSecret(pvWithName(pv(), "pv3"))
+	h.secretAdded(pv3Secret, false)
+	expectQueued("pv3-node1")
+
+	// Secrets of the initial list do not re-queue anything.
+	h.secretAdded(pv3Secret, true)
+	expectQueued()
+}
+
+func TestCSIHandlerFallbackSecretIndex(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	scInformer := informerFactory.Storage().V1().StorageClasses().Informer()
+	if err := addIndexers(pvInformer, cache.Indexers{pvByStorageClassIndex: pvByStorageClassIndexFunc}); err != nil {
+		t.Fatalf("Failed to add PV indexers: %v", err)
+	}
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add VA indexers: %v", err)
+	}
+	sc := storageClassWithSecret("sc", "sc-secret", "default")
+	if err := scInformer.GetIndexer().Add(sc); err != nil {
+		t.Fatalf("Failed to add StorageClass: %v", err)
+	}
+	pvs := []*v1.PersistentVolume{
+		pvWithStorageClass(pv(), "sc"),
+		pvWithName(pvWithStorageClass(pv(), "sc"), "pv2"),
+		pvWithName(pvWithSecret(pvWithStorageClass(pv(), "sc"), "secret"), "pv3"),
+	}
+	for _, pv := range pvs {
+		if err := pvInformer.GetIndexer().Add(pv); err != nil {
+			t.Fatalf("Failed to add PV: %v", err)
+		}
+	}
+	for _, va := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, testPVName, "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv2", "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv3", "node1", false, "", nil),
+	} {
+		if err := vaInformer.GetIndexer().Add(va); err != nil {
+			t.Fatalf("Failed to add VA: %v", err)
+		}
+	}
+
+	h := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, nil).(*csiHandler)
+	h.scLister = informerFactory.Storage().V1().StorageClasses().Lister()
+	h.defaultSecretRef = &v1.SecretReference{Name: "${pv.name}", Namespace: "default"}
+	h.fallbackSecrets = newFallbackSecrets()
+	for _, pv := range pvs {
+		h.indexFallbackSecret(pv)
+	}
+	expectVAs := func(secret string, expected ...string) {
+		t.Helper()
+		vas, err := h.listVAsByFallbackSecret(secret)
+		if err != nil {
+			t.Fatalf("Failed to list VolumeAttachments: %v", err)
+		}
+		names := []string{}
+		for _, va := range vas {
+			names = append(names, va.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, expected) {
+			t.Errorf("Expected VolumeAttachments of secret %s %v, got %v", secret, expected, names)
+		}
+	}
+	expectVAs("default/sc-secret", "pv1-node1", "pv2-node1")
+	expectVAs("default/pv1")
+
+	// PVs of a deleted StorageClass fall back to the default secret.
+	if err := scInformer.GetIndexer().Delete(sc); err != nil {
+		t.Fatalf("Failed to delete StorageClass: %v", err)
+	}
+	h.reindexFallbackSecrets("sc")
+	expectVAs("default/sc-secret")
+	expectVAs("default/pv1", "pv1-node1")
+	expectVAs("default/pv3")
+
+	h.unindexFallbackSecret("pv2")
+	expectVAs("default/pv2")
+}
+
+func storageClassWithSecret(name, secretName, secretNamespace string) *storage.StorageClass {
+	sc := &storage.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Provisioner: testAttacherName,
+		Parameters:  map[string]string{},
+	}
+	if secretName != "" {
+		sc.Parameters[publishSecretNameKey] = secretName
+	}
+	if secretNamespace != "" {
+		sc.Parameters[publishSecretNamespaceKey] = secretNamespace
+	}
+	return sc
+}
+
+func pvWithStorageClass(pv *v1.PersistentVolume, scName string) *v1.PersistentVolume {
+	pv.Spec.StorageClassName = scName
+	return pv
+}
+
+func TestCSIHandlerFallbackSecret(t *testing.T) {
+	vaGroupResourceVersion := schema.GroupVersionResource{
+		Group:    storage.GroupName,
+		Version:  "v1",
+		Resource: "volumeattachments",
+	}
+	secretGroupResourceVersion := schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "secrets",
+	}
+
+	var noMetadata map[string]string
+	var noAttrs map[string]string
+	var noSecrets map[string]string
+	var notDetached = false
+	var success error
+	var readWrite = false
+
+	fallbackSecretFactory := func(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
+		h := csiHandlerFactory(client, recorder, informerFactory, csi, lister).(*csiHandler)
+		h.scLister = informerFactory.Storage().V1().StorageClasses().Lister()
+		h.defaultSecretRef = &v1.SecretReference{Name: "${pv.name}", Namespace: "${pvc.namespace}"}
+		return h
+	}
+
+	tests := []testCase{
+		{
+			name: "PV without secret -> secret from StorageClass",
+			initialObjects: []runtime.Object{
+				pvWithStorageClass(pvWithFinalizer(), "sc"),
+				storageClassWithSecret("sc", "secret", "default"),
+				secret(),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewGetAction(secretGroupResourceVersion, "default", "secret"),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), va(true, fin, ann)), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, map[string]string{"foo": "bar"}, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name: "PV with secret -> StorageClass secret is ignored",
+			initialObjects: []runtime.Object{
+				pvWithStorageClass(pvWithSecret(pvWithFinalizer(), "emptySecret"), "sc"),
+				storageClassWithSecret("sc", "secret", "default"),
+				emptySecret(),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewGetAction(secretGroupResourceVersion, "default", "emptySecret"),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), va(true, fin, ann)), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, map[string]string{}, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+		{
+			name: "StorageClass without secret -> default secret",
+			initialObjects: []runtime.Object{
+				pvWithClaimRef(pvWithStorageClass(pvWithFinalizer(), "sc")),
+				storageClassWithSecret("sc", "", ""),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewGetAction(secretGroupResourceVersion, "default", "pv1"),
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
+						"failed to load secret \"default/pv1\": secrets \"pv1\" not found")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
+			},
+		},
+		{
+			name: "StorageClass with incomplete secret -> error",
+			initialObjects: []runtime.Object{
+				pvWithStorageClass(pvWithFinalizer(), "sc"),
+				storageClassWithSecret("sc", "secret", ""),
+				csiNode(),
+			},
+			addedVA: va(false, fin, ann),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(va(false, fin, ann), vaWithAttachError(va(false, fin, ann),
+						"failed to get ControllerPublish secret: StorageClass \"sc\" must specify both csi.storage.k8s.io/controller-publish-secret-name and csi.storage.k8s.io/controller-publish-secret-namespace parameters")), "status"),
+				errorReasonAction(vaAttachErrorReasonAnnotation, ErrorReasonTransient),
+			},
+		},
+		{
+			name: "inline volume without secret -> no fallback",
+			initialObjects: []runtime.Object{
+				csiNode(),
+			},
+			addedVA: vaWithInlineSpec(va(false, fin, ann)),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(vaWithInlineSpec(va(false, fin, ann)), vaWithInlineSpec(va(true, fin, ann))), "status"),
+			},
+			expectedCSICalls: []csiCall{
+				{"attach", testVolumeHandle, testNodeID, noAttrs, noSecrets, readWrite, success, notDetached, noMetadata, 0},
+			},
+		},
+	}
+	runTests(t, fallbackSecretFactory, tests)
+}
+
+// recordingQueue records how VolumeAttachments are re-queued.
+type recordingQueue struct {
+	workqueue.TypedRateLimitingInterface[string]
+	addedAfter  map[string]time.Duration
+	rateLimited []string
+}
+
+func (q *recordingQueue) AddAfter(item string, duration time.Duration) {
+	q.addedAfter[item] = duration
+}
+
+func (q *recordingQueue) AddRateLimited(item string) {
+	q.rateLimited = append(q.rateLimited, item)
+}
+
+func TestCSIHandlerRetryInfo(t *testing.T) {
+	errWithRetryInfo := func(delay time.Duration) error {
+		st, err := status.New(codes.Unavailable, "mock error").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(delay),
+		})
+		if err != nil {
+			t.Fatalf("failed to add error details: %s", err)
+		}
+		return st.Err()
+	}
+
+	tests := []struct {
+		name                string
+		err                 error
+		expectedDelay       time.Duration
+		expectedRateLimited bool
+	}{
+		{
+			name:          "RetryInfo -> delay from the driver",
+			err:           errWithRetryInfo(30 * time.Second),
+			expectedDelay: 30 * time.Second,
+		},
+		{
+			name:          "RetryInfo with long delay -> max. retry delay",
+			err:           errWithRetryInfo(time.Hour),
+			expectedDelay: 5 * time.Minute,
+		},
+		{
+			name:                "RetryInfo with zero delay -> exponential backoff",
+			err:                 errWithRetryInfo(0),
+			expectedRateLimited: true,
+		},
+		{
+			name:                "no RetryInfo -> exponential backoff",
+			err:                 status.Error(codes.Unavailable, "mock error"),
+			expectedRateLimited: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vaObj := deleted(va(true, fin, ann))
+			client := fake.NewSimpleClientset(vaObj)
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			if err := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer().Add(pvWithFinalizer()); err != nil {
+				t.Fatalf("Failed to add PV: %v", err)
+			}
+			csiConnection := &fakeCSIConnection{
+				t:      t,
+				lister: &fakeLister{t: t},
+				calls: []csiCall{
+					{"detach", testVolumeHandle, testNodeID, nil, nil, false, test.err, false, nil, 0},
+				},
+			}
+			h := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, csiConnection, nil)
+			h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute})
+			queue := &recordingQueue{addedAfter: map[string]time.Duration{}}
+			h.Init(queue, nil)
+
+			h.SyncNewOrUpdatedVolumeAttachment(context.Background(), vaObj)
+
+			if test.expectedRateLimited {
+				if !slices.Equal(queue.rateLimited, []string{vaObj.Name}) || len(queue.addedAfter) > 0 {
+					t.Errorf("Expected VolumeAttachment re-queued with backoff, got rate limited %v, added after %v", queue.rateLimited, queue.addedAfter)
+				}
+				return
+			}
+			delay, found := queue.addedAfter[vaObj.Name]
+			if !found || len(queue.rateLimited) > 0 {
+				t.Fatalf("Expected VolumeAttachment re-queued after delay, got rate limited %v, added after %v", queue.rateLimited, queue.addedAfter)
+			}
+			if delay != test.expectedDelay {
+				t.Errorf("Expected delay %s, got %s", test.expectedDelay, delay)
+			}
+		})
+	}
+}
+
+func TestCSIHandlerMaxAttachAttempts(t *testing.T) {
+	attachErr := status.Error(codes.Unavailable, "mock error")
+	failedAttach := csiCall{"attach", testVolumeHandle, testNodeID, nil, nil, false, attachErr, false, nil, 0}
+	successfulAttach := csiCall{"attach", testVolumeHandle, testNodeID, nil, nil, false, nil, false, nil, 0}
+
+	tests := []struct {
+		name string
+		// resume changes the stopped VolumeAttachment or its PV. Nil means
+		// no change.
+		resume func(t *testing.T, client kubernetes.Interface, pvIndexer cache.Indexer, va *storage.VolumeAttachment) *storage.VolumeAttachment
+	}{
+		{
+			name: "no change -> attach stays stopped",
+		},
+		{
+			name: "retry annotation -> attach resumed",
+			resume: func(t *testing.T, client kubernetes.Interface, pvIndexer cache.Indexer, va *storage.VolumeAttachment) *storage.VolumeAttachment {
+				clone := va.DeepCopy()
+				clone.Annotations[vaAttachRetryAnnotation] = "true"
+				newVA, err := client.StorageV1().VolumeAttachments().Update(context.Background(), clone, metav1.UpdateOptions{})
+				if err != nil {
+					t.Fatalf("Failed to update VolumeAttachment: %v", err)
+				}
+				return newVA
+			},
+		},
+		{
+			name: "PV change -> attach resumed",
+			resume: func(t *testing.T, client kubernetes.Interface, pvIndexer cache.Indexer, va *storage.VolumeAttachment) *storage.VolumeAttachment {
+				pv := pvWithFinalizer()
+				pv.Spec.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("2Gi")}
+				if err := pvIndexer.Update(pv); err != nil {
+					t.Fatalf("Failed to update PV: %v", err)
+				}
+				return va
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vaObj := va(false, fin, ann)
+			client := fake.NewSimpleClientset(vaObj)
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			pvIndexer := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer()
+			if err := pvIndexer.Add(pvWithFinalizer()); err != nil {
+				t.Fatalf("Failed to add PV: %v", err)
+			}
+			if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+				t.Fatalf("Failed to add CSINode: %v", err)
+			}
+			calls := []csiCall{failedAttach, failedAttach}
+			if test.resume != nil {
+				calls = append(calls, successfulAttach)
+			}
+			csiConnection := &fakeCSIConnection{t: t, lister: &fakeLister{t: t}, calls: calls}
+			recorder := record.NewFakeRecorder(100)
+			h := csiHandlerFactory(client, recorder, informerFactory, csiConnection, nil).(*csiHandler)
+			h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, MaxAttachAttempts: 2})
+			queue := &recordingQueue{
+				TypedRateLimitingInterface: workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+				addedAfter:                 map[string]time.Duration{},
+			}
+			defer queue.ShutDown()
+			h.Init(queue, nil)
+
+			sync := func() *storage.VolumeAttachment {
+				current, err := client.StorageV1().VolumeAttachments().Get(context.Background(), vaObj.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Failed to get VolumeAttachment: %v", err)
+				}
+				h.SyncNewOrUpdatedVolumeAttachment(context.Background(), current)
+				current, err = client.StorageV1().VolumeAttachments().Get(context.Background(), vaObj.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Failed to get VolumeAttachment: %v", err)
+				}
+				return current
+			}
+
+			// The first attempt is retried.
+			current := sync()
+			if _, found := current.Annotations[vaAttachStoppedAnnotation]; found {
+				t.Errorf("Expected VolumeAttachment not stopped after the first attempt")
+			}
+			if len(queue.rateLimited) != 1 {
+				t.Errorf("Expected VolumeAttachment re-queued after the first attempt, got %v", queue.rateLimited)
+			}
+
+			// The second attempt reaches the limit.
+			current = sync()
+			if _, found := current.Annotations[vaAttachStoppedAnnotation]; !found {
+				t.Errorf("Expected VolumeAttachment stopped after the second attempt, got annotations %v", current.Annotations)
+			}
+			if len(queue.rateLimited) != 1 {
+				t.Errorf("Expected VolumeAttachment not re-queued after the second attempt, got %v", queue.rateLimited)
+			}
+			stoppedEvent := false
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, reasonAttachStopped) {
+					stoppedEvent = true
+				}
+			}
+			if !stoppedEvent {
+				t.Errorf("Expected %s event", reasonAttachStopped)
+			}
+			expectStoppedDebugState := func() {
+				t.Helper()
+				state := h.debugState(vaObj.Name)
+				if state.LastError == nil || !strings.Contains(state.LastError.Message, "mock error") {
+					t.Errorf("Expected the attach error as the last error of a stopped VolumeAttachment, got %+v", state.LastError)
+				}
+			}
+			expectStoppedDebugState()
+
+			// Stopped VolumeAttachment is not attached until it or its PV
+			// changes.
+			current = sync()
+			if test.resume == nil {
+				if _, found := current.Annotations[vaAttachStoppedAnnotation]; !found {
+					t.Errorf("Expected VolumeAttachment to stay stopped, got annotations %v", current.Annotations)
+				}
+				if len(queue.rateLimited) != 1 {
+					t.Errorf("Expected stopped VolumeAttachment not re-queued, got %v", queue.rateLimited)
+				}
+				expectStoppedDebugState()
+				return
+			}
+			test.resume(t, client, pvIndexer, current)
+			current = sync()
+			if !current.Status.Attached {
+				t.Errorf("Expected VolumeAttachment attached after resume")
+			}
+			for _, annotation := range []string{vaAttachStoppedAnnotation, vaAttachRetryAnnotation} {
+				if _, found := current.Annotations[annotation]; found {
+					t.Errorf("Expected annotation %s removed after resume, got annotations %v", annotation, current.Annotations)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchPublishedVolumes(t *testing.T) {
+	va1 := createVolumeAttachment(testAttacherName, "pv1", "node1", true, fin, nil)
+	va2 := createVolumeAttachment(testAttacherName, "pv2", "node1", true, fin, nil)
+	vaVolumes := []vaVolume{
+		{va: va1, volumeHandle: "vol1", nodeID: "node1"},
+		{va: va2, volumeHandle: "vol2", nodeID: "node1"},
+	}
+	abnormal := &csi.VolumeCondition{Abnormal: true, Message: "mock"}
+
+	for _, pageSize := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			lister := &fakeLister{
+				t: t,
+				publishedNodes: map[string][]string{
+					"vol1": {"node1", "node2"},
+					"vol2": {},
+					"vol3": {"node3"},
+				},
+				conditions: map[string]*csi.VolumeCondition{"vol2": abnormal},
+				pageSize:   pageSize,
+			}
+			h := &csiHandler{CSIVolumeLister: lister}
+			published, err := h.matchPublishedVolumes(ctx, vaVolumes, []string{"vol1", "vol2"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := sets.New(va1.Name); !published.vaNames.Equal(expected) {
+				t.Errorf("expected published VolumeAttachments %v, got %v", sets.List(expected), sets.List(published.vaNames))
+			}
+			if expected := map[string]*csi.VolumeCondition{va2.Name: abnormal}; !reflect.DeepEqual(published.conditions, expected) {
+				t.Errorf("expected conditions %+v, got %+v", expected, published.conditions)
+			}
+			if expected := sets.New("vol2"); !published.abnormal.Equal(expected) {
+				t.Errorf("expected abnormal volumes %v, got %v", sets.List(expected), sets.List(published.abnormal))
+			}
+			expectedOrphans := []orphanedAttachment{
+				{volumeHandle: "vol1", nodeID: "node2"},
+				{volumeHandle: "vol3", nodeID: "node3"},
+			}
+			sortOrphans(published.orphans)
+			if !reflect.DeepEqual(published.orphans, expectedOrphans) {
+				t.Errorf("expected orphans %+v, got %+v", expectedOrphans, published.orphans)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		_, ctx := ktesting.NewTestContext(t)
+		lister := &fakeLister{t: t, publishedNodes: map[string][]string{"vol1": {"node1"}}, err: errors.New("mock error")}
+		h := &csiHandler{CSIVolumeLister: lister}
+		if _, err := h.matchPublishedVolumes(ctx, vaVolumes, []string{"vol1", "vol2"}); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	})
+}
+
+func TestStartPublish(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	logger, _ := ktesting.NewTestContext(t)
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	if err := pvInformer.GetIndexer().Add(pv()); err != nil {
+		t.Fatalf("Failed to add PV: %v", err)
+	}
+	// Neither VolumeAttachment has the finalizer yet.
+	va1 := createVolumeAttachment(testAttacherName, testPVName, "node1", false, "", nil)
+	va2 := createVolumeAttachment(testAttacherName, testPVName, "node2", false, "", nil)
+	for _, obj := range []*storage.VolumeAttachment{va1, va2} {
+		if err := vaInformer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, nil).(*csiHandler)
+	caps := &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+
+	published, err := h.startPublish(va2, testVolumeHandle, caps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := h.startPublish(va1, testVolumeHandle, caps); err == nil {
+		t.Errorf("Expected error while the volume is being published to another node")
+	}
+	published()
+	published, err = h.startPublish(va1, testVolumeHandle, caps)
+	if err != nil {
+		t.Fatalf("Unexpected error after the other ControllerPublish ended: %v", err)
+	}
+	published()
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// debugPath is the prefix of HTTP paths with internal state of the controller.
+const debugPath = "/debug/attacher/"
+
+// DriverCapabilities are capabilities of the CSI driver that the
+// external-attacher uses, as reported on the debug endpoint.
+type DriverCapabilities struct {
+	DriverName                 string `json:"driverName"`
+	ControllerService          bool   `json:"controllerService"`
+	PublishUnpublishVolume     bool   `json:"publishUnpublishVolume"`
+	PublishReadOnly            bool   `json:"publishReadOnly"`
+	ListVolumesPublishedNodes  bool   `json:"listVolumesPublishedNodes"`
+	GetVolume                  bool   `json:"getVolume"`
+	SingleNodeMultiWriter      bool   `json:"singleNodeMultiWriter"`
+	ReconcileVolumeAttachments bool   `json:"reconcileVolumeAttachments"`
+}
+
+// queueItemState is the state of an item in a trackedQueue.
+type queueItemState string
+
+const (
+	queueItemQueued     queueItemState = "Queued"
+	queueItemWaiting    queueItemState = "Waiting"
+	queueItemProcessing queueItemState = "Processing"
+)
+
+// QueueItem is an item of a work queue, as reported on the debug endpoint.
+type QueueItem struct {
+	Name  string         `json:"name"`
+	State queueItemState `json:"state"`
+	// NextRetry is the time when a waiting item is added to the queue.
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+	// Requeues is the number of failures of the item since its last
+	// success.
+	Requeues int `json:"requeues"`
+}
+
+// trackedQueue is a rate limiting work queue that remembers its items, so
+// they can be reported on the debug endpoint.
+type trackedQueue struct {
+	workqueue.TypedRateLimitingInterface[string]
+	rateLimiter workqueue.TypedRateLimiter[string]
+	clock       func() time.Time
+
+	mux   sync.Mutex
+	items map[string]*trackedItem
+}
+
+type trackedItem struct {
+	queued     bool
+	processing bool
+	nextRetry  time.Time
+}
+
+var _ workqueue.TypedRateLimitingInterface[string] = &trackedQueue{}
+
+func newTrackedQueue(rateLimiter workqueue.TypedRateLimiter[string], name string) *trackedQueue {
+	return &trackedQueue{
+		TypedRateLimitingInterface: workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: name}),
+		rateLimiter:                rateLimiter,
+		clock:                      time.Now,
+		items:                      map[string]*trackedItem{},
+	}
+}
+
+func (q *trackedQueue) item(name string) *trackedItem {
+	item, found := q.items[name]
+	if !found {
+		item = &trackedItem{}
+		q.items[name] = item
+	}
+	return item
+}
+
+func (q *trackedQueue) Add(name string) {
+	q.mux.Lock()
+	item := q.item(name)
+	item.queued = true
+	item.nextRetry = time.Time{}
+	q.mux.Unlock()
+	q.TypedRateLimitingInterface.Add(name)
+}
+
+func (q *trackedQueue) AddAfter(name string, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(name)
+		return
+	}
+	q.mux.Lock()
+	item := q.item(name)
+	nextRetry := q.clock().Add(duration)
+	if !item.queued && (item.nextRetry.IsZero() || nextRetry.Before(item.nextRetry)) {
+		// The queue adds the item at the earliest time.
+		item.nextRetry = nextRetry
+	}
+	q.mux.Unlock()
+	q.TypedRateLimitingInterface.AddAfter(name, duration)
+}
+
+func (q *trackedQueue) AddRateLimited(name string) {
+	// The same as the workqueue does, so the delay is known.
+	q.AddAfter(name, q.rateLimiter.When(name))
+}
+
+func (q *trackedQueue) Get() (string, bool) {
+	name, shutdown := q.TypedRateLimitingInterface.Get()
+	if shutdown {
+		return name, shutdown
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	item := q.item(name)
+	item.queued = false
+	item.processing = true
+	item.nextRetry = time.Time{}
+	return name, shutdown
+}
+
+func (q *trackedQueue) Done(name string) {
+	q.mux.Lock()
+	if item, found := q.items[name]; found {
+		item.processing = false
+		if !item.queued && item.nextRetry.IsZero() {
+			delete(q.items, name)
+		}
+	}
+	q.mux.Unlock()
+	q.TypedRateLimitingInterface.Done(name)
+}
+
+// snapshot returns all items of the queue, sorted by name.
+func (q *trackedQueue) snapshot() []QueueItem {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	now := q.clock()
+	items := make([]QueueItem, 0, len(q.items))
+	for name, item := range q.items {
+		items = append(items, q.queueItem(name, item, now))
+	}
+	slices.SortFunc(items, func(a, b QueueItem) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return items
+}
+
+// get returns the item with the given name, if it is in the queue.
+func (q *trackedQueue) get(name string) *QueueItem {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	item, found := q.items[name]
+	if !found {
+		return nil
+	}
+	queueItem := q.queueItem(name, item, q.clock())
+	return &queueItem
+}
+
+func (q *trackedQueue) queueItem(name string, item *trackedItem, now time.Time) QueueItem {
+	queueItem := QueueItem{
+		Name:     name,
+		State:    queueItemQueued,
+		Requeues: q.NumRequeues(name),
+	}
+	switch {
+	case item.processing:
+		queueItem.State = queueItemProcessing
+	case !item.queued && now.Before(item.nextRetry):
+		queueItem.State = queueItemWaiting
+		nextRetry := item.nextRetry
+		queueItem.NextRetry = &nextRetry
+	}
+	return queueItem
+}
+
+// lastErrors remembers the last error of processing of each VolumeAttachment,
+// including errors that are not saved to the VolumeAttachment status.
+type lastErrors struct {
+	mux    sync.Mutex
+	errors map[string]LastError
+}
+
+// LastError is the last error of a VolumeAttachment, as reported on the debug
+// endpoint.
+type LastError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func newLastErrors() *lastErrors {
+	return &lastErrors{errors: map[string]LastError{}}
+}
+
+// set records the error of the VolumeAttachment. Nil error removes it.
+func (e *lastErrors) set(vaName string, err error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if err == nil {
+		delete(e.errors, vaName)
+		return
+	}
+	e.errors[vaName] = LastError{Message: err.Error(), Time: time.Now()}
+}
+
+func (e *lastErrors) get(vaName string) *LastError {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if lastError, found := e.errors[vaName]; found {
+		return &lastError
+	}
+	return nil
+}
+
+// HandlerDebugState is internal state of a Handler about one
+// VolumeAttachment.
+type HandlerDebugState struct {
+	ForceSync      bool       `json:"forceSync"`
+	LastError      *LastError `json:"lastError,omitempty"`
+	AttachAttempts int        `json:"attachAttempts"`
+}
+
+// debugStateHandler is implemented by handlers that expose their internal
+// state on the debug endpoint.
+type debugStateHandler interface {
+	forceSyncNames() []string
+	debugState(vaName string) HandlerDebugState
+}
+
+// VolumeAttachmentDebugState is a VolumeAttachment as seen by the controller,
+// as reported on the debug endpoint.
+type VolumeAttachmentDebugState struct {
+	Name             string `json:"name"`
+	PersistentVolume string `json:"persistentVolume,omitempty"`
+	Node             string `json:"node"`
+	Attached         bool   `json:"attached"`
+	Deleted          bool   `json:"deleted"`
+	AttachError      string `json:"attachError,omitempty"`
+	DetachError      string `json:"detachError,omitempty"`
+	AttachStopped    bool   `json:"attachStopped"`
+	HandlerDebugState
+	// Queue is the state of the VolumeAttachment in the queue. Nil when it
+	// is not queued.
+	Queue *QueueItem `json:"queue,omitempty"`
+}
+
+// RegisterDebugHandlers registers HTTP handlers that report internal state
+// of the controller as JSON:
+//   - /debug/attacher/queues: items of the VolumeAttachment and
+//     PersistentVolume queues.
+//   - /debug/attacher/forcesync: VolumeAttachments that are processed again
+//     after reconciliation found a difference with the driver.
+//   - /debug/attacher/volumeattachments: all VolumeAttachments of the driver
+//     with their last error and next retry.
+//   - /debug/attacher/capabilities: capabilities of the CSI driver.
+func (ctrl *CSIAttachController) RegisterDebugHandlers(mux *http.ServeMux, capabilities DriverCapabilities) {
+	mux.HandleFunc(debugPath+"queues", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugJSON(w, map[string][]QueueItem{
+			"volumeAttachments": ctrl.vaTrackedQueue.snapshot(),
+			"persistentVolumes": ctrl.pvTrackedQueue.snapshot(),
+		})
+	})
+	mux.HandleFunc(debugPath+"forcesync", func(w http.ResponseWriter, r *http.Request) {
+		names := []string{}
+		if h, ok := ctrl.handler.(debugStateHandler); ok {
+			names = h.forceSyncNames()
+		}
+		writeDebugJSON(w, names)
+	})
+	mux.HandleFunc(debugPath+"volumeattachments", func(w http.ResponseWriter, r *http.Request) {
+		states, err := ctrl.volumeAttachmentDebugStates()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDebugJSON(w, states)
+	})
+	mux.HandleFunc(debugPath+"capabilities", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugJSON(w, capabilities)
+	})
+}
+
+// volumeAttachmentDebugStates returns all VolumeAttachments of the driver,
+// sorted by name.
+func (ctrl *CSIAttachController) volumeAttachmentDebugStates() ([]VolumeAttachmentDebugState, error) {
+	vas, err := ctrl.vaLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	h, hasDebugState := ctrl.handler.(debugStateHandler)
+	states := []VolumeAttachmentDebugState{}
+	for _, va := range vas {
+		if va.Spec.Attacher != ctrl.attacherName {
+			continue
+		}
+		state := VolumeAttachmentDebugState{
+			Name:     va.Name,
+			Node:     va.Spec.NodeName,
+			Attached: va.Status.Attached,
+			Deleted:  va.DeletionTimestamp != nil,
+			Queue:    ctrl.vaTrackedQueue.get(va.Name),
+		}
+		if va.Spec.Source.PersistentVolumeName != nil {
+			state.PersistentVolume = *va.Spec.Source.PersistentVolumeName
+		}
+		if va.Status.AttachError != nil {
+			state.AttachError = va.Status.AttachError.Message
+		}
+		if va.Status.DetachError != nil {
+			state.DetachError = va.Status.DetachError.Message
+		}
+		_, state.AttachStopped = va.Annotations[vaAttachStoppedAnnotation]
+		if hasDebugState {
+			state.HandlerDebugState = h.debugState(va.Name)
+		}
+		states = append(states, state)
+	}
+	slices.SortFunc(states, func(a, b VolumeAttachmentDebugState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return states, nil
+}
+
+func writeDebugJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		klog.Background().Error(err, "Failed to write debug response")
+	}
+}
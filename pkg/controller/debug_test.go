@@ -0,0 +1,160 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestTrackedQueue(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := newTrackedQueue(workqueue.NewTypedItemExponentialFailureRateLimiter[string](time.Hour, 10*time.Hour), "test")
+	q.clock = func() time.Time { return now }
+	defer q.ShutDown()
+	nextRetry := now.Add(time.Hour)
+
+	q.Add("a")
+	q.AddAfter("b", time.Hour)
+	expectItems(t, "after add", q, []QueueItem{
+		{Name: "a", State: queueItemQueued},
+		{Name: "b", State: queueItemWaiting, NextRetry: &nextRetry},
+	})
+
+	name, _ := q.Get()
+	if name != "a" {
+		t.Fatalf("expected item a, got %s", name)
+	}
+	expectItems(t, "after get", q, []QueueItem{
+		{Name: "a", State: queueItemProcessing},
+		{Name: "b", State: queueItemWaiting, NextRetry: &nextRetry},
+	})
+
+	q.AddRateLimited("a")
+	q.Done("a")
+	expectItems(t, "after failure", q, []QueueItem{
+		{Name: "a", State: queueItemWaiting, NextRetry: &nextRetry, Requeues: 1},
+		{Name: "b", State: queueItemWaiting, NextRetry: &nextRetry},
+	})
+
+	// The retry time has passed, the items wait for a worker.
+	now = now.Add(2 * time.Hour)
+	expectItems(t, "after retry time", q, []QueueItem{
+		{Name: "a", State: queueItemQueued, Requeues: 1},
+		{Name: "b", State: queueItemQueued},
+	})
+
+	q.Forget("a")
+	q.Add("a")
+	name, _ = q.Get()
+	q.Done(name)
+	expectItems(t, "after success", q, []QueueItem{
+		{Name: "b", State: queueItemQueued},
+	})
+}
+
+func expectItems(t *testing.T, step string, q *trackedQueue, expected []QueueItem) {
+	t.Helper()
+	if items := q.snapshot(); !reflect.DeepEqual(items, expected) {
+		t.Errorf("%s: expected items %+v, got %+v", step, expected, items)
+	}
+}
+
+func TestDebugHandlers(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	vaObj := va(false, fin, ann)
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments()
+	if err := vaInformer.Informer().GetIndexer().Add(vaObj); err != nil {
+		t.Fatalf("Failed to add VolumeAttachment: %v", err)
+	}
+	handler := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, nil).(*csiHandler)
+	ctrl := NewCSIAttachController(logger, client, testAttacherName, handler, vaInformer, informerFactory.Core().V1().PersistentVolumes(),
+		workqueue.DefaultTypedControllerRateLimiter[string](), workqueue.DefaultTypedControllerRateLimiter[string](), true, time.Minute)
+	defer ctrl.vaQueue.ShutDown()
+	defer ctrl.pvQueue.ShutDown()
+
+	handler.setForceSync(vaObj.Name)
+	handler.lastErrors.set(vaObj.Name, errors.New("mock error"))
+	ctrl.vaQueue.Add(vaObj.Name)
+	ctrl.pvQueue.Add(testPVName)
+
+	capabilities := DriverCapabilities{DriverName: testAttacherName, ControllerService: true, PublishUnpublishVolume: true}
+	mux := http.NewServeMux()
+	ctrl.RegisterDebugHandlers(mux, capabilities)
+	get := func(path string, data any) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", path, recorder.Code, recorder.Body.String())
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), data); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", path, err)
+		}
+	}
+
+	var queues map[string][]QueueItem
+	get("/debug/attacher/queues", &queues)
+	expectedQueues := map[string][]QueueItem{
+		"volumeAttachments": {{Name: vaObj.Name, State: queueItemQueued}},
+		"persistentVolumes": {{Name: testPVName, State: queueItemQueued}},
+	}
+	if !reflect.DeepEqual(queues, expectedQueues) {
+		t.Errorf("expected queues %+v, got %+v", expectedQueues, queues)
+	}
+
+	var forceSync []string
+	get("/debug/attacher/forcesync", &forceSync)
+	if !reflect.DeepEqual(forceSync, []string{vaObj.Name}) {
+		t.Errorf("expected force sync of %s, got %v", vaObj.Name, forceSync)
+	}
+
+	var states []VolumeAttachmentDebugState
+	get("/debug/attacher/volumeattachments", &states)
+	if len(states) != 1 {
+		t.Fatalf("expected one VolumeAttachment, got %+v", states)
+	}
+	state := states[0]
+	if state.Name != vaObj.Name || state.PersistentVolume != testPVName || state.Node != testNodeName || !state.ForceSync {
+		t.Errorf("unexpected VolumeAttachment state %+v", state)
+	}
+	if state.LastError == nil || state.LastError.Message != "mock error" {
+		t.Errorf("expected last error, got %+v", state.LastError)
+	}
+	if state.Queue == nil || state.Queue.State != queueItemQueued {
+		t.Errorf("expected queued VolumeAttachment, got %+v", state.Queue)
+	}
+
+	var gotCapabilities DriverCapabilities
+	get("/debug/attacher/capabilities", &gotCapabilities)
+	if gotCapabilities != capabilities {
+		t.Errorf("expected capabilities %+v, got %+v", capabilities, gotCapabilities)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	storagev1 "k8s.io/client-go/kubernetes/typed/storage/v1"
+	"k8s.io/klog/v2"
+)
+
+// dryRunClient is a Kubernetes client that does not patch PersistentVolumes
+// and VolumeAttachments. It logs the patches instead and returns the objects
+// as they would look like after the patch. All other calls, incl. all reads,
+// are passed to the real client.
+//
+// The controller modifies PersistentVolumes and VolumeAttachments only with
+// Patch calls, other write calls are not intercepted.
+type dryRunClient struct {
+	kubernetes.Interface
+}
+
+// NewDryRunClient returns a Kubernetes client that only logs patches of
+// PersistentVolumes and VolumeAttachments.
+func NewDryRunClient(client kubernetes.Interface) kubernetes.Interface {
+	return &dryRunClient{Interface: client}
+}
+
+func (c *dryRunClient) CoreV1() corev1.CoreV1Interface {
+	return &dryRunCoreV1{CoreV1Interface: c.Interface.CoreV1()}
+}
+
+func (c *dryRunClient) StorageV1() storagev1.StorageV1Interface {
+	return &dryRunStorageV1{StorageV1Interface: c.Interface.StorageV1()}
+}
+
+type dryRunCoreV1 struct {
+	corev1.CoreV1Interface
+}
+
+func (c *dryRunCoreV1) PersistentVolumes() corev1.PersistentVolumeInterface {
+	return &dryRunPersistentVolumes{PersistentVolumeInterface: c.CoreV1Interface.PersistentVolumes()}
+}
+
+type dryRunPersistentVolumes struct {
+	corev1.PersistentVolumeInterface
+}
+
+func (c *dryRunPersistentVolumes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*v1.PersistentVolume, error) {
+	klog.FromContext(ctx).Info("Dry run: skipping PersistentVolume patch", "PersistentVolume", name, "patch", string(data), "subresources", subresources)
+	pv, err := c.PersistentVolumeInterface.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	patched := &v1.PersistentVolume{}
+	if err := applyPatch(pv, patched, pt, data); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+type dryRunStorageV1 struct {
+	storagev1.StorageV1Interface
+}
+
+func (c *dryRunStorageV1) VolumeAttachments() storagev1.VolumeAttachmentInterface {
+	return &dryRunVolumeAttachments{VolumeAttachmentInterface: c.StorageV1Interface.VolumeAttachments()}
+}
+
+type dryRunVolumeAttachments struct {
+	storagev1.VolumeAttachmentInterface
+}
+
+func (c *dryRunVolumeAttachments) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*storage.VolumeAttachment, error) {
+	klog.FromContext(ctx).Info("Dry run: skipping VolumeAttachment patch", "VolumeAttachment", name, "patch", string(data), "subresources", subresources)
+	va, err := c.VolumeAttachmentInterface.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	patched := &storage.VolumeAttachment{}
+	if err := applyPatch(va, patched, pt, data); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// applyPatch applies a JSON or JSON merge patch to the original object and
+// stores the result in patched.
+func applyPatch(original, patched any, pt types.PatchType, data []byte) error {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	var patchedJSON []byte
+	switch pt {
+	case types.MergePatchType:
+		patchedJSON, err = jsonpatch.MergePatch(originalJSON, data)
+	case types.JSONPatchType:
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(data)
+		if err == nil {
+			patchedJSON, err = patch.Apply(originalJSON)
+		}
+	default:
+		return fmt.Errorf("unsupported patch type %q", pt)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(patchedJSON, patched)
+}
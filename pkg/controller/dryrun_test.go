@@ -0,0 +1,69 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestDryRunClient(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset(pv(), va(false, "", nil))
+	dryRunClient := NewDryRunClient(client)
+
+	// VolumeAttachment merge patch
+	newVA, err := markAsAttached(ctx, dryRunClient, va(false, "", nil), map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatalf("Failed to mark VolumeAttachment as attached: %v", err)
+	}
+	if !newVA.Status.Attached || !reflect.DeepEqual(newVA.Status.AttachmentMetadata, map[string]string{"foo": "bar"}) {
+		t.Errorf("Expected attached VolumeAttachment with metadata, got %+v", newVA.Status)
+	}
+
+	// PersistentVolume JSON patch
+	patch, err := addFinalizerPatch(nil, fin)
+	if err != nil {
+		t.Fatalf("Failed to create patch: %v", err)
+	}
+	newPV, err := dryRunClient.CoreV1().PersistentVolumes().Patch(ctx, testPVName, types.JSONPatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to patch PersistentVolume: %v", err)
+	}
+	if !reflect.DeepEqual(newPV.Finalizers, []string{fin}) {
+		t.Errorf("Expected finalizers %v, got %v", []string{fin}, newPV.Finalizers)
+	}
+
+	// Nothing must have been written
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("Unexpected action: %+v", action)
+		}
+	}
+	storedVA, err := client.StorageV1().VolumeAttachments().Get(ctx, newVA.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get VolumeAttachment: %v", err)
+	}
+	if storedVA.Status.Attached {
+		t.Errorf("Expected the stored VolumeAttachment to be unchanged")
+	}
+}
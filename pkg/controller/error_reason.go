@@ -0,0 +1,129 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorReason is a stable classification of attach and detach errors. It is
+// stored in VolumeAttachment annotations, so tools can act on errors without
+// parsing their messages.
+type ErrorReason string
+
+const (
+	// ErrorReasonTransient means the operation may succeed when retried,
+	// and it may be still in progress.
+	ErrorReasonTransient ErrorReason = "Transient"
+	// ErrorReasonFinal means the operation failed and it is not in progress.
+	ErrorReasonFinal ErrorReason = "Final"
+	// ErrorReasonResourceExhausted means the driver or the storage backend
+	// is out of resources or it throttles requests.
+	ErrorReasonResourceExhausted ErrorReason = "ResourceExhausted"
+	// ErrorReasonNotFound means the volume, the node or another object
+	// needed for the operation does not exist.
+	ErrorReasonNotFound ErrorReason = "NotFound"
+	// ErrorReasonPermissionDenied means the operation is not allowed with
+	// the given credentials.
+	ErrorReasonPermissionDenied ErrorReason = "PermissionDenied"
+)
+
+var errorReasons = []ErrorReason{
+	ErrorReasonTransient,
+	ErrorReasonFinal,
+	ErrorReasonResourceExhausted,
+	ErrorReasonNotFound,
+	ErrorReasonPermissionDenied,
+}
+
+// classifyError returns reason of an attach or detach error.
+//
+// A driver can override the reason derived from the gRPC code by a
+// google.rpc.ErrorInfo detail with one of the reasons, either as is
+// ("ResourceExhausted") or in the usual upper snake case
+// ("RESOURCE_EXHAUSTED").
+func classifyError(err error) ErrorReason {
+	st, ok := status.FromError(err)
+	if !ok {
+		// The error did not come from the driver.
+		switch {
+		case apierrors.IsNotFound(err):
+			return ErrorReasonNotFound
+		case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+			return ErrorReasonPermissionDenied
+		}
+		return ErrorReasonTransient
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if reason, found := parseErrorReason(info.GetReason()); found {
+				return reason
+			}
+		}
+	}
+
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		return ErrorReasonResourceExhausted
+	case codes.NotFound:
+		return ErrorReasonNotFound
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return ErrorReasonPermissionDenied
+	case codes.Canceled,
+		codes.DeadlineExceeded,
+		codes.Unavailable,
+		codes.Aborted:
+		return ErrorReasonTransient
+	}
+	return ErrorReasonFinal
+}
+
+// parseErrorReason finds a reason that matches s, ignoring case and
+// underscores.
+func parseErrorReason(s string) (ErrorReason, bool) {
+	normalized := strings.ReplaceAll(s, "_", "")
+	for _, reason := range errorReasons {
+		if strings.EqualFold(normalized, string(reason)) {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// retryDelay returns the delay requested by the driver in a
+// google.rpc.RetryInfo detail of the error.
+func retryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay().IsValid() {
+			if delay := info.GetRetryDelay().AsDuration(); delay > 0 {
+				return delay, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func statusWithErrorInfo(t *testing.T, code codes.Code, reason string) error {
+	st, err := status.New(code, "mock error").WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: "csi.example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to add error details: %s", err)
+	}
+	return st.Err()
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedReason ErrorReason
+	}{
+		{
+			name:           "plain error",
+			err:            errors.New("mock error"),
+			expectedReason: ErrorReasonTransient,
+		},
+		{
+			name:           "API object not found",
+			err:            fmt.Errorf("failed: %w", apierrors.NewNotFound(v1.Resource("persistentvolumes"), "pv1")),
+			expectedReason: ErrorReasonNotFound,
+		},
+		{
+			name:           "API forbidden",
+			err:            apierrors.NewForbidden(v1.Resource("secrets"), "secret", errors.New("mock error")),
+			expectedReason: ErrorReasonPermissionDenied,
+		},
+		{
+			name:           "gRPC ResourceExhausted",
+			err:            status.Error(codes.ResourceExhausted, "mock error"),
+			expectedReason: ErrorReasonResourceExhausted,
+		},
+		{
+			name:           "gRPC NotFound",
+			err:            status.Error(codes.NotFound, "mock error"),
+			expectedReason: ErrorReasonNotFound,
+		},
+		{
+			name:           "gRPC Unauthenticated",
+			err:            status.Error(codes.Unauthenticated, "mock error"),
+			expectedReason: ErrorReasonPermissionDenied,
+		},
+		{
+			name:           "gRPC DeadlineExceeded",
+			err:            status.Error(codes.DeadlineExceeded, "mock error"),
+			expectedReason: ErrorReasonTransient,
+		},
+		{
+			name:           "gRPC Aborted",
+			err:            status.Error(codes.Aborted, "mock error"),
+			expectedReason: ErrorReasonTransient,
+		},
+		{
+			name:           "gRPC InvalidArgument",
+			err:            status.Error(codes.InvalidArgument, "mock error"),
+			expectedReason: ErrorReasonFinal,
+		},
+		{
+			name:           "gRPC FailedPrecondition",
+			err:            status.Error(codes.FailedPrecondition, "mock error"),
+			expectedReason: ErrorReasonFinal,
+		},
+		{
+			name:           "ErrorInfo overrides code",
+			err:            statusWithErrorInfo(t, codes.Internal, "RESOURCE_EXHAUSTED"),
+			expectedReason: ErrorReasonResourceExhausted,
+		},
+		{
+			name:           "ErrorInfo with CamelCase reason",
+			err:            statusWithErrorInfo(t, codes.Unavailable, "PermissionDenied"),
+			expectedReason: ErrorReasonPermissionDenied,
+		},
+		{
+			name:           "ErrorInfo with unknown reason",
+			err:            statusWithErrorInfo(t, codes.Unavailable, "QUOTA_EXCEEDED"),
+			expectedReason: ErrorReasonTransient,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason := classifyError(test.err)
+			if reason != test.expectedReason {
+				t.Errorf("expected reason %q, got %q", test.expectedReason, reason)
+			}
+		})
+	}
+}
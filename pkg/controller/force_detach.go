@@ -0,0 +1,73 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/klog/v2"
+)
+
+// ForceDetacher is implemented by handlers that can detach a VolumeAttachment
+// outside of the controller, as the force-detach subcommand does.
+type ForceDetacher interface {
+	// ForceDetach calls ControllerUnpublish of a deleted VolumeAttachment
+	// and removes its finalizer. With skipUnpublish, only the finalizer is
+	// removed and the volume may stay attached in the storage backend.
+	ForceDetach(ctx context.Context, va *storage.VolumeAttachment, skipUnpublish bool) (*storage.VolumeAttachment, error)
+}
+
+var _ ForceDetacher = &csiHandler{}
+
+func (h *csiHandler) ForceDetach(ctx context.Context, va *storage.VolumeAttachment, skipUnpublish bool) (*storage.VolumeAttachment, error) {
+	logger := klog.FromContext(ctx).WithValues("VolumeAttachment", va.Name)
+	ctx = klog.NewContext(ctx, logger)
+	if va.Spec.Attacher != h.attacherName {
+		return va, fmt.Errorf("VolumeAttachment %s belongs to driver %s", va.Name, va.Spec.Attacher)
+	}
+	if va.DeletionTimestamp == nil {
+		// The controller would attach the volume again.
+		return va, fmt.Errorf("VolumeAttachment %s is not being deleted", va.Name)
+	}
+
+	if skipUnpublish {
+		logger.Info("Skipping ControllerUnpublish, the volume may stay attached in the storage backend")
+	} else {
+		req, err := h.getDetachRequest(ctx, va)
+		if err != nil {
+			return va, fmt.Errorf("failed to find ControllerUnpublish arguments: %w", err)
+		}
+		detachCtx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+		defer cancel()
+		if err := h.attacher.Detach(withAuditInfo(markAsMigrated(detachCtx, req.migratable), va), req.volumeHandle, req.nodeID, req.secrets); err != nil {
+			return va, fmt.Errorf("ControllerUnpublish failed: %w", err)
+		}
+		logger.Info("Detached", "volumeHandle", req.volumeHandle, "nodeID", req.nodeID)
+	}
+
+	// The caller may have no deadline, do not wait for the API server forever.
+	patchCtx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+	defer cancel()
+	newVA, err := markAsDetached(patchCtx, h.client, va)
+	if err != nil {
+		return va, fmt.Errorf("could not mark as detached: %w", err)
+	}
+	logger.Info("Marked as detached")
+	return newVA, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestForceDetach(t *testing.T) {
+	var noAttrs map[string]string
+	var noMetadata map[string]string
+	secrets := map[string]string{"foo": "bar"}
+
+	tests := []struct {
+		name             string
+		va               *storage.VolumeAttachment
+		noPV             bool
+		skipUnpublish    bool
+		calls            []csiCall
+		expectError      bool
+		expectFinalizers []string
+	}{
+		{
+			name:  "unpublish",
+			va:    deleted(va(true, fin, nil)),
+			calls: []csiCall{{"detach", testVolumeHandle, testNodeID, noAttrs, secrets, false, nil, false, noMetadata, 0}},
+		},
+		{
+			name:             "unpublish error",
+			va:               deleted(va(true, fin, nil)),
+			calls:            []csiCall{{"detach", testVolumeHandle, testNodeID, noAttrs, secrets, false, errors.New("mock error"), false, noMetadata, 0}},
+			expectError:      true,
+			expectFinalizers: []string{fin},
+		},
+		{
+			name:             "missing PV",
+			va:               deleted(va(true, fin, nil)),
+			noPV:             true,
+			expectError:      true,
+			expectFinalizers: []string{fin},
+		},
+		{
+			name:          "skip unpublish",
+			va:            deleted(va(true, fin, nil)),
+			noPV:          true,
+			skipUnpublish: true,
+		},
+		{
+			name:             "not deleted",
+			va:               va(true, fin, nil),
+			expectError:      true,
+			expectFinalizers: []string{fin},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			client := fake.NewSimpleClientset(test.va, secret())
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			if !test.noPV {
+				if err := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer().Add(pvWithSecret(pv(), "secret")); err != nil {
+					t.Fatalf("Failed to add PV: %v", err)
+				}
+			}
+			if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+				t.Fatalf("Failed to add CSINode: %v", err)
+			}
+			csiConnection := &fakeCSIConnection{t: t, calls: test.calls, lister: &fakeLister{t: t}}
+			handler := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, csiConnection, nil).(ForceDetacher)
+
+			_, err := handler.ForceDetach(ctx, test.va, test.skipUnpublish)
+			if err != nil && !test.expectError {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err == nil && test.expectError {
+				t.Errorf("expected error, got none")
+			}
+			if csiConnection.index != len(test.calls) {
+				t.Errorf("expected %d CSI calls, got %d", len(test.calls), csiConnection.index)
+			}
+
+			va, err := client.StorageV1().VolumeAttachments().Get(ctx, test.va.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get VolumeAttachment: %v", err)
+			}
+			if len(va.Finalizers) != len(test.expectFinalizers) {
+				t.Errorf("expected finalizers %v, got %v", test.expectFinalizers, va.Finalizers)
+			}
+			if expectAttached := len(test.expectFinalizers) > 0; va.Status.Attached != expectAttached {
+				t.Errorf("expected attached %t, got %t", expectAttached, va.Status.Attached)
+			}
+		})
+	}
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -37,6 +39,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/ktesting"
@@ -76,6 +79,10 @@ type testCase struct {
 	expectedCSICalls []csiCall
 	// Expected lister response
 	listerResponse map[string][]string
+	// Optional volume conditions in the lister response
+	listerConditions map[string]*csi.VolumeCondition
+	// List of expected events. Events are not checked when nil.
+	expectedEvents []string
 	// Function to perform additional checks after the test finishes
 	additionalCheck func(t *testing.T, test testCase)
 }
@@ -104,7 +111,7 @@ type csiCall struct {
 	delay time.Duration
 }
 
-type handlerFactory func(client kubernetes.Interface, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler
+type handlerFactory func(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler
 
 func runTests(t *testing.T, handlerFactory handlerFactory, tests []testCase) {
 	for _, test := range tests {
@@ -140,6 +147,7 @@ func runTests(t *testing.T, handlerFactory handlerFactory, tests []testCase) {
 			pvInformer := informers.Core().V1().PersistentVolumes()
 			nodeInformer := informers.Core().V1().Nodes()
 			csiNodeInformer := informers.Storage().V1().CSINodes()
+			scInformer := informers.Storage().V1().StorageClasses()
 			// Fill the informers with initial objects so controller can Get() them
 			for _, obj := range objs {
 				switch obj.(type) {
@@ -153,6 +161,8 @@ func runTests(t *testing.T, handlerFactory handlerFactory, tests []testCase) {
 					// Secrets are not cached in any informer
 				case *storage.CSINode:
 					csiNodeInformer.Informer().GetStore().Add(obj)
+				case *storage.StorageClass:
+					scInformer.Informer().GetStore().Add(obj)
 				default:
 					t.Fatalf("Unknown initalObject type: %+v", obj)
 				}
@@ -181,9 +191,10 @@ func runTests(t *testing.T, handlerFactory handlerFactory, tests []testCase) {
 			}
 
 			// Construct controller
-			lister := &fakeLister{t: t, publishedNodes: test.listerResponse}
+			lister := &fakeLister{t: t, publishedNodes: test.listerResponse, conditions: test.listerConditions}
 			csiConnection := &fakeCSIConnection{t: t, calls: test.expectedCSICalls, lister: lister}
-			handler := handlerFactory(client, informers, csiConnection, lister)
+			recorder := record.NewFakeRecorder(1000)
+			handler := handlerFactory(client, recorder, informers, csiConnection, lister)
 			ctrl := NewCSIAttachController(logger, client, testAttacherName, handler, vaInformer, pvInformer, workqueue.DefaultTypedControllerRateLimiter[string](), workqueue.DefaultTypedControllerRateLimiter[string](), test.listerResponse != nil, 1*time.Minute)
 
 			// Start the test by enqueueing the right event
@@ -304,6 +315,17 @@ func runTests(t *testing.T, handlerFactory handlerFactory, tests []testCase) {
 				}
 			}
 
+			if test.expectedEvents != nil {
+				close(recorder.Events)
+				events := []string{}
+				for event := range recorder.Events {
+					events = append(events, event)
+				}
+				if !reflect.DeepEqual(test.expectedEvents, events) {
+					t.Errorf("Test %q: unexpected events\nExpected:\n%s\ngot:\n%s", test.name, spew.Sdump(test.expectedEvents), spew.Sdump(events))
+				}
+			}
+
 			if test.additionalCheck != nil {
 				test.additionalCheck(t, test)
 			}
@@ -360,6 +382,11 @@ func deleted(va *storage.VolumeAttachment) *storage.VolumeAttachment {
 	return va
 }
 
+func createdAt(va *storage.VolumeAttachment, t time.Time) *storage.VolumeAttachment {
+	va.CreationTimestamp = metav1.NewTime(t)
+	return va
+}
+
 func vaAddInlineSpec(va *storage.VolumeAttachment) *storage.VolumeAttachment {
 	va.Spec.Source.InlineVolumeSpec = &v1.PersistentVolumeSpec{
 		AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
@@ -412,10 +439,51 @@ func vaWithDetachError(va *storage.VolumeAttachment, message string) *storage.Vo
 type fakeLister struct {
 	t              *testing.T
 	publishedNodes map[string][]string
+	conditions     map[string]*csi.VolumeCondition
+	// pageSize is the number of volumes in a page. Zero means all volumes
+	// are in a single page.
+	pageSize int
+	// err is returned after all pages.
+	err error
+	// listsAll is returned by ListsAllVolumes.
+	listsAll bool
+	// calls is the number of ListVolumePages calls.
+	calls int
 }
 
-func (l *fakeLister) ListVolumes(ctx context.Context) (map[string][]string, error) {
-	return l.publishedNodes, nil
+func (l *fakeLister) ListsAllVolumes() bool {
+	return l.listsAll
+}
+
+func (l *fakeLister) ListVolumePages(ctx context.Context, volumeIDs []string, pageTimeout time.Duration) attacher.VolumePages {
+	l.calls++
+	volumes := map[string]attacher.VolumeStatus{}
+	for volumeID, nodeIDs := range l.publishedNodes {
+		volumes[volumeID] = attacher.VolumeStatus{PublishedNodeIDs: nodeIDs}
+	}
+	for volumeID, condition := range l.conditions {
+		volumeStatus := volumes[volumeID]
+		volumeStatus.Condition = condition
+		volumes[volumeID] = volumeStatus
+	}
+	pageSize := l.pageSize
+	if pageSize == 0 {
+		pageSize = max(len(volumes), 1)
+	}
+	return func(yield func(map[string]attacher.VolumeStatus, error) bool) {
+		for ids := range slices.Chunk(slices.Sorted(maps.Keys(volumes)), pageSize) {
+			page := map[string]attacher.VolumeStatus{}
+			for _, id := range ids {
+				page[id] = volumes[id]
+			}
+			if !yield(page, nil) {
+				return
+			}
+		}
+		if l.err != nil {
+			yield(nil, l.err)
+		}
+	}
 }
 
 func (l *fakeLister) Add(volumeHandle string, nodeID string) {
@@ -463,7 +531,8 @@ func (f *fakeCSIConnection) Attach(ctx context.Context, volumeID string, readOnl
 	// If caller has set long delay, return when deadline expires
 	select {
 	case <-ctx.Done():
-		return nil, true, ctx.Err()
+		// Timeout, the volume may be attached, as with the real attacher.
+		return nil, false, ctx.Err()
 	case <-time.After(call.delay):
 		break
 	}
@@ -0,0 +1,124 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// AttachmentState is the state of a VolumeAttachment, as reported by
+// the inspect subcommand.
+type AttachmentState struct {
+	Name             string `json:"name"`
+	PersistentVolume string `json:"persistentVolume,omitempty"`
+	Node             string `json:"node"`
+	NodeID           string `json:"nodeID,omitempty"`
+	VolumeHandle     string `json:"volumeHandle,omitempty"`
+	Attached         bool   `json:"attached"`
+	Deleted          bool   `json:"deleted"`
+	// LastError is the detach error or, when there is none, the attach
+	// error of the VolumeAttachment.
+	LastError string `json:"lastError,omitempty"`
+	// Published is true when the CSI driver reports the volume as
+	// published on the node. Nil when the driver was not asked.
+	Published *bool `json:"published,omitempty"`
+	// Drift is true when Published differs from Attached. Such
+	// VolumeAttachments are processed again by the reconciler.
+	Drift bool `json:"drift"`
+	// Error is the reason why the volume handle or node ID could not be
+	// found.
+	Error string `json:"error,omitempty"`
+}
+
+// Inspector is implemented by handlers that can report the state of
+// VolumeAttachments without changing them.
+type Inspector interface {
+	// InspectVolumeAttachments returns the state of the given
+	// VolumeAttachments, sorted by name. When the handler has
+	// a VolumeLister, the state is compared with the CSI driver the same
+	// way as ReconcileVA does.
+	InspectVolumeAttachments(ctx context.Context, vas []*storage.VolumeAttachment) ([]AttachmentState, error)
+}
+
+var _ Inspector = &csiHandler{}
+
+func (h *csiHandler) InspectVolumeAttachments(ctx context.Context, vas []*storage.VolumeAttachment) ([]AttachmentState, error) {
+	logger := klog.FromContext(ctx)
+	vas = slices.Clone(vas)
+	slices.SortFunc(vas, func(a, b *storage.VolumeAttachment) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	states := make([]AttachmentState, len(vas))
+	vaVolumes := make([]vaVolume, 0, len(vas))
+	// Index of each vaVolume in states.
+	indexes := make([]int, 0, len(vas))
+	for i, va := range vas {
+		state := &states[i]
+		state.Name = va.Name
+		state.Node = va.Spec.NodeName
+		state.Attached = va.Status.Attached
+		state.Deleted = va.DeletionTimestamp != nil
+		if va.Spec.Source.PersistentVolumeName != nil {
+			state.PersistentVolume = *va.Spec.Source.PersistentVolumeName
+		}
+		if va.Status.AttachError != nil {
+			state.LastError = va.Status.AttachError.Message
+		}
+		if va.Status.DetachError != nil {
+			state.LastError = va.Status.DetachError.Message
+		}
+
+		v, err := h.resolveVAVolume(ctx, logger, va)
+		if err != nil {
+			state.Error = err.Error()
+			// Report at least the node ID, when it is known.
+			state.NodeID, _ = h.getNodeID(logger, h.attacherName, va.Spec.NodeName, va)
+			continue
+		}
+		state.NodeID = v.nodeID
+		state.VolumeHandle = v.volumeHandle
+		vaVolumes = append(vaVolumes, v)
+		indexes = append(indexes, i)
+	}
+	if h.CSIVolumeLister == nil || len(vaVolumes) == 0 {
+		return states, nil
+	}
+
+	volumeHandles := sets.New[string]()
+	for _, v := range vaVolumes {
+		volumeHandles.Insert(v.volumeHandle)
+	}
+	published, err := h.matchPublishedVolumes(ctx, vaVolumes, sets.List(volumeHandles))
+	if err != nil {
+		return nil, fmt.Errorf("failed to ListVolumes: %w", err)
+	}
+	for i, v := range vaVolumes {
+		state := &states[indexes[i]]
+		found := published.vaNames.Has(v.va.Name)
+		state.Published = &found
+		state.Drift = state.Attached != found
+	}
+	return states, nil
+}
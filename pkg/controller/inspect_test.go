@@ -0,0 +1,98 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+	"k8s.io/utils/ptr"
+)
+
+func TestInspectVolumeAttachments(t *testing.T) {
+	attached := va(true, fin, nil)
+	detachFailed := vaWithDetachError(deleted(createVolumeAttachment(testAttacherName, testPVName, "node2", true, fin, ann)), "mock error")
+	missingPV := createVolumeAttachment(testAttacherName, "pv2", testNodeName, false, "", nil)
+
+	tests := []struct {
+		name           string
+		publishedNodes map[string][]string
+		noLister       bool
+		expectedStates []AttachmentState
+	}{
+		{
+			name:           "published",
+			publishedNodes: map[string][]string{testVolumeHandle: {testNodeID}},
+			expectedStates: []AttachmentState{
+				{Name: "pv1-node1", PersistentVolume: testPVName, Node: testNodeName, NodeID: testNodeID, VolumeHandle: testVolumeHandle, Attached: true, Published: ptr.To(true)},
+				{Name: "pv1-node2", PersistentVolume: testPVName, Node: "node2", NodeID: "nodeID1", VolumeHandle: testVolumeHandle, Attached: true, Deleted: true, LastError: "mock error", Published: ptr.To(true)},
+				{Name: "pv2-node1", PersistentVolume: "pv2", Node: testNodeName, NodeID: testNodeID, Error: `failed to get PV spec: persistentvolume "pv2" not found`},
+			},
+		},
+		{
+			name:           "not published",
+			publishedNodes: map[string][]string{},
+			expectedStates: []AttachmentState{
+				{Name: "pv1-node1", PersistentVolume: testPVName, Node: testNodeName, NodeID: testNodeID, VolumeHandle: testVolumeHandle, Attached: true, Published: ptr.To(false), Drift: true},
+				{Name: "pv1-node2", PersistentVolume: testPVName, Node: "node2", NodeID: "nodeID1", VolumeHandle: testVolumeHandle, Attached: true, Deleted: true, LastError: "mock error", Published: ptr.To(false), Drift: true},
+				{Name: "pv2-node1", PersistentVolume: "pv2", Node: testNodeName, NodeID: testNodeID, Error: `failed to get PV spec: persistentvolume "pv2" not found`},
+			},
+		},
+		{
+			name:     "no lister",
+			noLister: true,
+			expectedStates: []AttachmentState{
+				{Name: "pv1-node1", PersistentVolume: testPVName, Node: testNodeName, NodeID: testNodeID, VolumeHandle: testVolumeHandle, Attached: true},
+				{Name: "pv1-node2", PersistentVolume: testPVName, Node: "node2", NodeID: "nodeID1", VolumeHandle: testVolumeHandle, Attached: true, Deleted: true, LastError: "mock error"},
+				{Name: "pv2-node1", PersistentVolume: "pv2", Node: testNodeName, NodeID: testNodeID, Error: `failed to get PV spec: persistentvolume "pv2" not found`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			client := fake.NewSimpleClientset()
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			if err := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer().Add(pv()); err != nil {
+				t.Fatalf("Failed to add PV: %v", err)
+			}
+			if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+				t.Fatalf("Failed to add CSINode: %v", err)
+			}
+			var lister VolumeLister
+			if !test.noLister {
+				lister = &fakeLister{t: t, publishedNodes: test.publishedNodes}
+			}
+			handler := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, lister).(Inspector)
+
+			states, err := handler.InspectVolumeAttachments(ctx, []*storage.VolumeAttachment{missingPV, detachFailed, attached})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(states, test.expectedStates) {
+				t.Errorf("expected states:\n%+v\ngot:\n%+v", test.expectedStates, states)
+			}
+		})
+	}
+}
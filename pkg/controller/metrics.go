@@ -0,0 +1,279 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	metricsSubsystem = "csi_attacher"
+	labelDriverName  = "driver_name"
+)
+
+var (
+	abnormalVolumes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "abnormal_volumes",
+			Help:           "Number of volumes the CSI driver reports with an abnormal volume condition.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	attachRetries = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "attach_retries_total",
+			Help:           "Number of failed attach attempts, including the last attempt before attaching is stopped.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	attachStopped = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "attach_stopped_total",
+			Help:           "Number of VolumeAttachments the attacher stopped attaching after the maximum number of attempts.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	orphanedAttachments = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "orphaned_attachments",
+			Help:           "Number of volumes the CSI driver reports as published on a node without a VolumeAttachment.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	orphansOnUnknownNodes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "orphaned_attachments_unknown_node",
+			Help:           "Number of volumes the CSI driver reports as published on a node ID without a CSINode. They are never detached.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	orphansDetached = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "orphaned_attachments_detached_total",
+			Help:           "Number of volumes without a VolumeAttachment that the attacher detached.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	reconcileFullPassDuration = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "reconcile_full_pass_duration_seconds",
+			Help:           "Time it took the VolumeAttachment reconciler to check all VolumeAttachments in its last complete pass.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	reconcileFullPassTimestamp = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "reconcile_full_pass_completion_timestamp_seconds",
+			Help:           "Unix time when the VolumeAttachment reconciler last checked all VolumeAttachments.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	attachLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "attach_duration_seconds",
+			Help:           "Time from creation of a VolumeAttachment until the attacher marked it as attached.",
+			Buckets:        latencyBuckets,
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	detachLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "detach_duration_seconds",
+			Help:           "Time from deletion of a VolumeAttachment until the attacher removed its finalizer.",
+			Buckets:        latencyBuckets,
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	reconcileDrift = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "reconcile_drift_total",
+			Help:           "Number of VolumeAttachments whose attached status did not match the state reported by the CSI driver.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	forceSyncRequeues = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "force_sync_requeues_total",
+			Help:           "Number of VolumeAttachments the VolumeAttachment reconciler requeued for forced processing.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	pvFinalizersAdded = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "pv_finalizers_added_total",
+			Help:           "Number of PersistentVolumes the attacher added its finalizer to.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	pvFinalizersRemoved = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "pv_finalizers_removed_total",
+			Help:           "Number of PersistentVolumes the attacher removed its finalizer from.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{labelDriverName},
+	)
+
+	registerMetrics sync.Once
+)
+
+// latencyBuckets are buckets of attach and detach latency, from 0.5 second
+// to about an hour.
+var latencyBuckets = metrics.ExponentialBuckets(0.5, 2, 14)
+
+// RegisterMetrics registers the controller metrics in the default legacy
+// registry.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(abnormalVolumes, attachRetries, attachStopped, orphanedAttachments, orphansOnUnknownNodes, orphansDetached,
+			reconcileFullPassDuration, reconcileFullPassTimestamp, attachLatency, detachLatency, reconcileDrift,
+			forceSyncRequeues, pvFinalizersAdded, pvFinalizersRemoved)
+	})
+}
+
+// observeAttached records attach latency of a VolumeAttachment that was just
+// marked as attached.
+func observeAttached(attacherName string, va *storage.VolumeAttachment) {
+	attachLatency.WithLabelValues(attacherName).Observe(time.Since(va.CreationTimestamp.Time).Seconds())
+}
+
+// observeDetached records detach latency of a VolumeAttachment whose
+// finalizer was just removed.
+func observeDetached(attacherName string, va *storage.VolumeAttachment) {
+	if va.DeletionTimestamp == nil {
+		return
+	}
+	detachLatency.WithLabelValues(attacherName).Observe(time.Since(va.DeletionTimestamp.Time).Seconds())
+}
+
+// States of VolumeAttachments reported by the volumeattachments metric.
+const (
+	vaStateAttaching = "attaching"
+	vaStateAttached  = "attached"
+	vaStateDetaching = "detaching"
+	vaStateError     = "error"
+)
+
+var vaStates = []string{vaStateAttaching, vaStateAttached, vaStateDetaching, vaStateError}
+
+// getVAState returns the state of a VolumeAttachment as reported by the
+// volumeattachments metric.
+func getVAState(va *storage.VolumeAttachment) string {
+	switch {
+	case va.DeletionTimestamp != nil && va.Status.DetachError != nil:
+		return vaStateError
+	case va.DeletionTimestamp != nil:
+		return vaStateDetaching
+	case va.Status.Attached:
+		return vaStateAttached
+	case va.Status.AttachError != nil:
+		return vaStateError
+	default:
+		return vaStateAttaching
+	}
+}
+
+var vaStatesDesc = metrics.NewDesc(
+	metricsSubsystem+"_volumeattachments",
+	"Number of VolumeAttachments of the CSI driver by their state.",
+	[]string{labelDriverName, "state"}, nil,
+	metrics.ALPHA, "",
+)
+
+// vaStateCollector reports the number of VolumeAttachments of the driver by
+// their state, as found in the informer cache when metrics are scraped.
+type vaStateCollector struct {
+	metrics.BaseStableCollector
+
+	attacherName string
+	vaIndexer    cache.Indexer
+}
+
+// NewVolumeAttachmentStateCollector returns a collector of the number of
+// VolumeAttachments by state. vaIndexer must be the indexer of the
+// VolumeAttachment informer used by the controller.
+func NewVolumeAttachmentStateCollector(attacherName string, vaIndexer cache.Indexer) metrics.StableCollector {
+	return &vaStateCollector{
+		attacherName: attacherName,
+		vaIndexer:    vaIndexer,
+	}
+}
+
+func (c *vaStateCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- vaStatesDesc
+}
+
+func (c *vaStateCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	vas, err := listVAsByIndex(c.vaIndexer, vaByAttacherIndex, c.attacherName)
+	if err != nil {
+		// The indexes are added when the controller is created.
+		return
+	}
+	counts := map[string]int{}
+	for _, va := range vas {
+		counts[getVAState(va)]++
+	}
+	for _, state := range vaStates {
+		ch <- metrics.NewLazyConstMetric(vaStatesDesc, metrics.GaugeValue, float64(counts[state]), c.attacherName, state)
+	}
+}
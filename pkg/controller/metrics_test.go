@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestGetVAState(t *testing.T) {
+	tests := []struct {
+		name     string
+		va       *storage.VolumeAttachment
+		expected string
+	}{
+		{"attaching", va(false, "", nil), vaStateAttaching},
+		{"attached", va(true, fin, nil), vaStateAttached},
+		{"attach error", vaWithAttachError(va(false, fin, nil), "mock error"), vaStateError},
+		{"detaching", deleted(va(true, fin, nil)), vaStateDetaching},
+		{"detach error", deleted(vaWithDetachError(va(true, fin, nil), "mock error")), vaStateError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if state := getVAState(test.va); state != test.expected {
+				t.Errorf("expected state %q, got %q", test.expected, state)
+			}
+		})
+	}
+}
+
+func TestVolumeAttachmentStateCollector(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	vas := []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, "pv1", testNodeName, true, fin, nil),
+		createVolumeAttachment(testAttacherName, "pv2", testNodeName, true, fin, nil),
+		deleted(createVolumeAttachment(testAttacherName, "pv3", testNodeName, true, fin, nil)),
+		createVolumeAttachment("other-driver", "pv4", testNodeName, true, fin, nil),
+	}
+	for _, va := range vas {
+		if err := vaInformer.GetIndexer().Add(va); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+
+	expected := `
+# HELP csi_attacher_volumeattachments [ALPHA] Number of VolumeAttachments of the CSI driver by their state.
+# TYPE csi_attacher_volumeattachments gauge
+csi_attacher_volumeattachments{driver_name="csi/test",state="attached"} 2
+csi_attacher_volumeattachments{driver_name="csi/test",state="attaching"} 0
+csi_attacher_volumeattachments{driver_name="csi/test",state="detaching"} 1
+csi_attacher_volumeattachments{driver_name="csi/test",state="error"} 0
+`
+	collector := NewVolumeAttachmentStateCollector(testAttacherName, vaInformer.GetIndexer())
+	if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(expected), "csi_attacher_volumeattachments"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// errNodeBusy is returned when a VolumeAttachment cannot be processed because
+// its node has reached the limit of in-flight operations. It is not a failure
+// of the VolumeAttachment, it will be re-queued when the node becomes free.
+var errNodeBusy = errors.New("too many attach / detach operations in flight on the node")
+
+// nodeLimiter limits number of concurrent attach / detach operations per node.
+// It remembers VolumeAttachments that did not get a slot, so they can be
+// re-queued when a slot is released.
+type nodeLimiter struct {
+	// limit is the max. number of in-flight operations per node. Zero or
+	// negative value means no limit.
+	limit int
+
+	mux      sync.Mutex
+	inFlight map[string]int
+	waiting  map[string]sets.Set[string]
+}
+
+func newNodeLimiter(limit int) *nodeLimiter {
+	return &nodeLimiter{
+		limit:    limit,
+		inFlight: map[string]int{},
+		waiting:  map[string]sets.Set[string]{},
+	}
+}
+
+// tryAcquire takes a slot of the node for VolumeAttachment vaName. When there
+// is no free slot, it returns false and vaName is remembered as waiting for
+// the node.
+func (l *nodeLimiter) tryAcquire(nodeName, vaName string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.inFlight[nodeName] >= l.limit {
+		if l.waiting[nodeName] == nil {
+			l.waiting[nodeName] = sets.New[string]()
+		}
+		l.waiting[nodeName].Insert(vaName)
+		return false
+	}
+	l.inFlight[nodeName]++
+	return true
+}
+
+// release frees a slot of the node acquired by tryAcquire and returns names
+// of all VolumeAttachments that are waiting for the node. The caller should
+// re-queue them, they compete for the free slot again.
+func (l *nodeLimiter) release(nodeName string) []string {
+	if l.limit <= 0 {
+		return nil
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.inFlight[nodeName]--
+	if l.inFlight[nodeName] <= 0 {
+		delete(l.inFlight, nodeName)
+	}
+	waiting := l.waiting[nodeName]
+	delete(l.waiting, nodeName)
+	return sets.List(waiting)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeLimiter(t *testing.T) {
+	l := newNodeLimiter(2)
+
+	if !l.tryAcquire("node1", "va1") || !l.tryAcquire("node1", "va2") {
+		t.Fatalf("Expected the first two operations on node1 to get a slot")
+	}
+	if !l.tryAcquire("node2", "va3") {
+		t.Fatalf("Expected an operation on node2 to get a slot")
+	}
+	if l.tryAcquire("node1", "va4") || l.tryAcquire("node1", "va5") || l.tryAcquire("node1", "va4") {
+		t.Fatalf("Expected operations over the limit on node1 to wait")
+	}
+
+	if waiting := l.release("node2"); len(waiting) != 0 {
+		t.Errorf("Expected no VolumeAttachments waiting for node2, got %v", waiting)
+	}
+	waiting := l.release("node1")
+	if expected := []string{"va4", "va5"}; !reflect.DeepEqual(waiting, expected) {
+		t.Errorf("Expected %v waiting for node1, got %v", expected, waiting)
+	}
+	if waiting := l.release("node1"); len(waiting) != 0 {
+		t.Errorf("Expected waiting VolumeAttachments to be returned only once, got %v", waiting)
+	}
+	if !l.tryAcquire("node1", "va4") || !l.tryAcquire("node1", "va5") {
+		t.Errorf("Expected released slots of node1 to be free")
+	}
+}
+
+func TestNodeLimiterUnlimited(t *testing.T) {
+	l := newNodeLimiter(0)
+	for i := 0; i < 100; i++ {
+		if !l.tryAcquire("node1", "va1") {
+			t.Fatalf("Expected unlimited limiter to always give a slot")
+		}
+	}
+	if waiting := l.release("node1"); waiting != nil {
+		t.Errorf("Expected no waiting VolumeAttachments, got %v", waiting)
+	}
+}
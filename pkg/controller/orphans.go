@@ -0,0 +1,312 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-csi/external-attacher/v4/pkg/attacher"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// orphanedAttachment is a volume that the CSI driver reports as published on
+// a node, but there is no VolumeAttachment of the volume and the node.
+type orphanedAttachment struct {
+	volumeHandle string
+	nodeID       string
+}
+
+// orphans remembers when the reconciler found each orphaned attachment, so
+// it is detached only after a grace period. It is used only by the
+// reconciler, which runs in a single goroutine.
+type orphans struct {
+	firstSeen  map[orphanedAttachment]time.Time
+	lastUpdate time.Time
+	clock      func() time.Time
+}
+
+func newOrphans() *orphans {
+	return &orphans{
+		firstSeen: map[orphanedAttachment]time.Time{},
+		clock:     time.Now,
+	}
+}
+
+// update replaces the remembered orphaned attachments with the current ones.
+// Orphaned attachments that were not found now are forgotten, their grace
+// period starts again when they are found next time.
+func (o *orphans) update(current []orphanedAttachment) {
+	now := o.clock()
+	o.lastUpdate = now
+	firstSeen := make(map[orphanedAttachment]time.Time, len(current))
+	for _, a := range current {
+		if t, found := o.firstSeen[a]; found {
+			firstSeen[a] = t
+		} else {
+			firstSeen[a] = now
+		}
+	}
+	o.firstSeen = firstSeen
+}
+
+// age returns for how long the orphaned attachment was known at the last
+// update. Zero means the last update found it for the first time.
+func (o *orphans) age(a orphanedAttachment) time.Duration {
+	return o.lastUpdate.Sub(o.firstSeen[a])
+}
+
+func (o *orphans) forget(a orphanedAttachment) {
+	delete(o.firstSeen, a)
+}
+
+// sortOrphans sorts orphaned attachments by volume handle and node ID.
+func sortOrphans(found []orphanedAttachment) {
+	slices.SortFunc(found, func(a, b orphanedAttachment) int {
+		if c := strings.Compare(a.volumeHandle, b.volumeHandle); c != 0 {
+			return c
+		}
+		return strings.Compare(a.nodeID, b.nodeID)
+	})
+}
+
+// syncOrphans reports volumes published on nodes without a VolumeAttachment
+// and, when enabled, detaches them after the grace period. complete is false
+// when some VolumeAttachments of the driver could not be matched with the
+// published volumes, nothing is detached then. vaVolumes are volumes of all
+// VolumeAttachments of the shard.
+func (h *csiHandler) syncOrphans(ctx context.Context, found []orphanedAttachment, vaVolumes []vaVolume, complete bool) {
+	logger := klog.FromContext(ctx)
+	// Orphaned attachments were matched only with VolumeAttachments of
+	// their window, or they may have got a VolumeAttachment since an
+	// earlier window of the pass.
+	attached := sets.New[orphanedAttachment]()
+	for _, v := range vaVolumes {
+		attached.Insert(orphanedAttachment{volumeHandle: v.volumeHandle, nodeID: v.nodeID})
+	}
+	found = slices.DeleteFunc(found, attached.Has)
+	var nodeNames map[string]string
+	if len(found) > 0 {
+		nodeNames = h.nodeNamesByID(logger)
+	}
+	if h.shard != nil {
+		// Orphaned attachments on nodes of other shards are handled by
+		// other replicas.
+		found = slices.DeleteFunc(found, func(a orphanedAttachment) bool {
+			return !h.ownsNode(nodeNames[a.nodeID])
+		})
+	}
+	sortOrphans(found)
+	orphanedAttachments.WithLabelValues(h.attacherName).Set(float64(len(found)))
+	unknownNodes := 0
+	for _, a := range found {
+		if nodeNames[a.nodeID] == "" {
+			unknownNodes++
+		}
+	}
+	orphansOnUnknownNodes.WithLabelValues(h.attacherName).Set(float64(unknownNodes))
+	h.orphans.update(found)
+	if len(found) == 0 {
+		return
+	}
+
+	gracePeriod := h.getSettings().OrphanDetachGracePeriod
+	var knownVAs sets.Set[string]
+	for _, a := range found {
+		nodeName := nodeNames[a.nodeID]
+		pv := h.getPVByVolumeHandle(logger, a.volumeHandle)
+		objects := h.orphanEventObjects(pv, nodeName)
+		node := fmt.Sprintf("node %q", nodeName)
+		if nodeName == "" {
+			node = fmt.Sprintf("unknown node with ID %q", a.nodeID)
+		}
+		age := h.orphans.age(a)
+		if age == 0 {
+			logger.Info("Volume is published on a node without a VolumeAttachment", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID, "node", nodeName)
+			for _, obj := range objects {
+				h.eventRecorder.Event(obj, v1.EventTypeWarning, reasonOrphanedAttachment,
+					fmt.Sprintf("Volume %q is attached to %s without a VolumeAttachment", a.volumeHandle, node))
+			}
+		}
+		if gracePeriod <= 0 || age < gracePeriod {
+			continue
+		}
+		if nodeName == "" {
+			// The node ID may belong to another cluster or host that
+			// shares the storage backend, it is only reported.
+			logger.V(2).Info("Not detaching orphaned volume, no CSINode has its node ID", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID)
+			continue
+		}
+		if !complete {
+			logger.V(2).Info("Not detaching orphaned volume, some VolumeAttachments could not be checked", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID)
+			continue
+		}
+
+		// A VolumeAttachment may have been created since the
+		// VolumeAttachments were listed.
+		if knownVAs == nil {
+			knownVAs = sets.New[string]()
+			for _, v := range vaVolumes {
+				knownVAs.Insert(v.va.Name)
+			}
+		}
+		if h.hasNewVolumeAttachment(ctx, logger, a, knownVAs) {
+			logger.V(2).Info("Not detaching orphaned volume, a new VolumeAttachment uses it", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID)
+			continue
+		}
+
+		if h.shard != nil && !h.shard.Acquire(nodeName) {
+			logger.V(2).Info("Not detaching orphaned volume, the node is not in the shard of this replica", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID)
+			continue
+		}
+		logger.Info("Detaching orphaned volume", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID, "node", nodeName, "age", age)
+		err := h.detachOrphan(ctx, a, pv, nodeName)
+		if h.shard != nil {
+			h.shard.Release(nodeName)
+		}
+		if err != nil {
+			logger.Error(err, "Failed to detach orphaned volume", "volumeHandle", a.volumeHandle, "nodeID", a.nodeID)
+			for _, obj := range objects {
+				h.eventRecorder.Event(obj, v1.EventTypeWarning, reasonOrphanDetachFailed,
+					fmt.Sprintf("Failed to detach volume %q from %s without a VolumeAttachment: %s", a.volumeHandle, node, err))
+			}
+			continue
+		}
+		h.orphans.forget(a)
+		orphansDetached.WithLabelValues(h.attacherName).Inc()
+		for _, obj := range objects {
+			h.eventRecorder.Event(obj, v1.EventTypeNormal, reasonOrphanDetached,
+				fmt.Sprintf("Volume %q detached from %s, it had no VolumeAttachment for %s", a.volumeHandle, node, age.Round(time.Second)))
+		}
+	}
+}
+
+// nodeNamesByID maps node IDs of the driver to node names, using CSINodes.
+func (h *csiHandler) nodeNamesByID(logger klog.Logger) map[string]string {
+	names := map[string]string{}
+	csiNodes, err := h.csiNodeLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list CSINodes")
+		return names
+	}
+	for _, csiNode := range csiNodes {
+		if nodeID, found := GetNodeIDFromCSINode(h.attacherName, csiNode); found {
+			names[nodeID] = csiNode.Name
+		}
+	}
+	return names
+}
+
+// getPVByVolumeHandle returns a PV of the volume. Nil when there is none.
+func (h *csiHandler) getPVByVolumeHandle(logger klog.Logger, volumeHandle string) *v1.PersistentVolume {
+	objs, err := h.pvIndexer.ByIndex(pvByVolumeHandleIndex, volumeHandle)
+	if err != nil {
+		logger.V(4).Info("Failed to find PersistentVolume of volume", "volumeHandle", volumeHandle, "err", err)
+		return nil
+	}
+	for _, obj := range objs {
+		if pv, ok := obj.(*v1.PersistentVolume); ok {
+			return pv
+		}
+	}
+	return nil
+}
+
+// orphanEventObjects returns objects to report events about an orphaned
+// attachment on: the PV of the volume, if it exists, and the node.
+func (h *csiHandler) orphanEventObjects(pv *v1.PersistentVolume, nodeName string) []runtime.Object {
+	var objects []runtime.Object
+	if pv != nil {
+		objects = append(objects, pv)
+	}
+	if nodeName != "" {
+		// The same reference as kubelet uses for events of its node.
+		objects = append(objects, &v1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)})
+	}
+	return objects
+}
+
+// hasNewVolumeAttachment returns true when a VolumeAttachment that is not in
+// knownVAs uses the volume on the node.
+func (h *csiHandler) hasNewVolumeAttachment(ctx context.Context, logger klog.Logger, a orphanedAttachment, knownVAs sets.Set[string]) bool {
+	vas, err := listVAsByIndex(h.vaIndexer, vaByAttacherIndex, h.attacherName)
+	if err != nil {
+		logger.Error(err, "Failed to list VolumeAttachments")
+		// Be safe, do not detach anything.
+		return true
+	}
+	for _, va := range vas {
+		if knownVAs.Has(va.Name) {
+			continue
+		}
+		if h.shard != nil && !h.ownsNode(va.Spec.NodeName) {
+			// Orphaned attachments are detached only on nodes of the
+			// shard.
+			continue
+		}
+		v, err := h.resolveVAVolume(ctx, logger, va)
+		if err != nil {
+			logger.V(4).Info("Failed to find volume of VolumeAttachment", "VolumeAttachment", va.Name, "err", err)
+			// It may be the VolumeAttachment of the volume.
+			return true
+		}
+		if v.volumeHandle == a.volumeHandle && v.nodeID == a.nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// detachOrphan calls ControllerUnpublish of an orphaned attachment. Secrets
+// are taken from the PV of the volume, if it exists.
+func (h *csiHandler) detachOrphan(ctx context.Context, a orphanedAttachment, pv *v1.PersistentVolume, nodeName string) error {
+	logger := klog.FromContext(ctx)
+	var secrets map[string]string
+	migratable := false
+	info := attacher.AuditInfo{Node: nodeName}
+	if pv != nil {
+		info.PersistentVolume = pv.Name
+		if h.translator.IsPVMigratable(pv) {
+			var err error
+			pv, err = h.translator.TranslateInTreePVToCSI(logger, pv)
+			if err != nil {
+				return fmt.Errorf("failed to translate in tree pv to CSI: %w", err)
+			}
+			migratable = true
+		}
+		csiSource, err := getCSISource(&pv.Spec)
+		if err != nil {
+			return err
+		}
+		secrets, err = h.getCredentialsFromPV(ctx, pv, csiSource)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.getSettings().Timeout)
+	defer cancel()
+	return h.attacher.Detach(attacher.WithAuditInfo(markAsMigrated(ctx, migratable), info), a.volumeHandle, a.nodeID, secrets)
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	csitranslator "k8s.io/csi-translation-lib"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestReconcileOrphans(t *testing.T) {
+	const orphanNode = "node2"
+	const orphanNodeID = "nodeID2"
+	secrets := map[string]string{"foo": "bar"}
+	orphanDetach := csiCall{"detach", testVolumeHandle, orphanNodeID, nil, secrets, false, nil, false, nil, 0}
+
+	orphanCSINode := csiNode()
+	orphanCSINode.Name = orphanNode
+	orphanCSINode.Spec.Drivers[0].NodeID = orphanNodeID
+
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		// extraVA is a VolumeAttachment that cannot be matched with
+		// the published volumes.
+		extraVA *storage.VolumeAttachment
+		// unknownNode removes the CSINode of the orphaned attachment.
+		unknownNode    bool
+		expectedCalls  []csiCall
+		expectedEvents []string
+	}{
+		{
+			name: "detach disabled",
+			expectedEvents: []string{
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+			},
+		},
+		{
+			name:          "detach after grace period",
+			gracePeriod:   time.Hour,
+			expectedCalls: []csiCall{orphanDetach},
+			expectedEvents: []string{
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+				`Normal OrphanDetached Volume "handle1" detached from node "node2", it had no VolumeAttachment for 2h0m0s`,
+				`Normal OrphanDetached Volume "handle1" detached from node "node2", it had no VolumeAttachment for 2h0m0s`,
+			},
+		},
+		{
+			name:        "unknown VolumeAttachment -> no detach",
+			gracePeriod: time.Hour,
+			extraVA:     createVolumeAttachment(testAttacherName, "missing-pv", testNodeName, true, fin, nil),
+			expectedEvents: []string{
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+				`Warning OrphanedAttachment Volume "handle1" is attached to node "node2" without a VolumeAttachment`,
+			},
+		},
+		{
+			name:        "unknown node -> no detach",
+			gracePeriod: time.Hour,
+			unknownNode: true,
+			expectedEvents: []string{
+				`Warning OrphanedAttachment Volume "handle1" is attached to unknown node with ID "nodeID2" without a VolumeAttachment`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			client := fake.NewSimpleClientset(secret())
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+			pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+			if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+				t.Fatalf("Failed to add indexers: %v", err)
+			}
+			if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+				t.Fatalf("Failed to add indexers: %v", err)
+			}
+			vas := []*storage.VolumeAttachment{va(true, fin, nil)}
+			if test.extraVA != nil {
+				vas = append(vas, test.extraVA)
+			}
+			for _, obj := range vas {
+				if err := vaInformer.GetIndexer().Add(obj); err != nil {
+					t.Fatalf("Failed to add VolumeAttachment: %v", err)
+				}
+			}
+			if err := pvInformer.GetIndexer().Add(pvWithSecret(pv(), "secret")); err != nil {
+				t.Fatalf("Failed to add PV: %v", err)
+			}
+			csiNodes := []*storage.CSINode{csiNode()}
+			if !test.unknownNode {
+				csiNodes = append(csiNodes, orphanCSINode)
+			}
+			for _, obj := range csiNodes {
+				if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(obj); err != nil {
+					t.Fatalf("Failed to add CSINode: %v", err)
+				}
+			}
+
+			lister := &fakeLister{t: t, publishedNodes: map[string][]string{testVolumeHandle: {testNodeID, orphanNodeID}}}
+			csiConnection := &fakeCSIConnection{t: t, calls: test.expectedCalls, lister: lister}
+			recorder := record.NewFakeRecorder(100)
+			h := csiHandlerFactory(client, recorder, informerFactory, csiConnection, lister).(*csiHandler)
+			h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, OrphanDetachGracePeriod: test.gracePeriod})
+			queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+			defer queue.ShutDown()
+			h.Init(queue, queue)
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			h.orphans.clock = func() time.Time { return now }
+
+			// The first reconciliation finds the orphan, the second one
+			// runs after the grace period.
+			for range 2 {
+				if err := h.ReconcileVA(ctx); err != nil {
+					t.Fatalf("ReconcileVA failed: %v", err)
+				}
+				now = now.Add(2 * time.Hour)
+			}
+
+			if csiConnection.index != len(test.expectedCalls) {
+				t.Errorf("expected %d CSI calls, got %d", len(test.expectedCalls), csiConnection.index)
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if !reflect.DeepEqual(events, test.expectedEvents) {
+				t.Errorf("expected events:\n%q\ngot:\n%q", test.expectedEvents, events)
+			}
+		})
+	}
+}
+
+func TestHasNewVolumeAttachment(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	newVA := va(false, "", nil)
+	if err := vaInformer.GetIndexer().Add(newVA); err != nil {
+		t.Fatalf("Failed to add VolumeAttachment: %v", err)
+	}
+	if err := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer().Add(pv()); err != nil {
+		t.Fatalf("Failed to add PV: %v", err)
+	}
+	if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+		t.Fatalf("Failed to add CSINode: %v", err)
+	}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(10), informerFactory, nil, nil).(*csiHandler)
+
+	orphan := orphanedAttachment{volumeHandle: testVolumeHandle, nodeID: testNodeID}
+	if !h.hasNewVolumeAttachment(ctx, logger, orphan, sets.New[string]()) {
+		t.Errorf("expected new VolumeAttachment of the orphan")
+	}
+	if h.hasNewVolumeAttachment(ctx, logger, orphan, sets.New(newVA.Name)) {
+		t.Errorf("expected no new VolumeAttachment when it is known")
+	}
+	other := orphanedAttachment{volumeHandle: testVolumeHandle, nodeID: "nodeID2"}
+	if h.hasNewVolumeAttachment(ctx, logger, other, sets.New[string]()) {
+		t.Errorf("expected no new VolumeAttachment of another node")
+	}
+}
+
+func TestReconcileOrphanAttachedDuringPass(t *testing.T) {
+	const orphanNode = "node2"
+	const orphanNodeID = "nodeID2"
+	logger, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	pv2 := pvWithName(pv(), "pv2")
+	pv2.Spec.CSI.VolumeHandle = "handle2"
+	for _, obj := range []*v1.PersistentVolume{pv(), pv2} {
+		if err := pvInformer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Failed to add PV: %v", err)
+		}
+	}
+	// Two VolumeAttachments, so each pass takes two reconciliations with
+	// batch size 1.
+	for _, obj := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, "pv1", testNodeName, true, fin, nil),
+		createVolumeAttachment(testAttacherName, "pv2", testNodeName, true, fin, nil),
+	} {
+		if err := vaInformer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+	orphanCSINode := csiNode()
+	orphanCSINode.Name = orphanNode
+	orphanCSINode.Spec.Drivers[0].NodeID = orphanNodeID
+	for _, obj := range []*storage.CSINode{csiNode(), orphanCSINode} {
+		if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Failed to add CSINode: %v", err)
+		}
+	}
+
+	lister := &fakeLister{t: t, publishedNodes: map[string][]string{testVolumeHandle: {testNodeID, orphanNodeID}, "handle2": {testNodeID}}}
+	// No detach is expected.
+	csiConnection := &fakeCSIConnection{t: t, lister: lister}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(100), informerFactory, csiConnection, lister).(*csiHandler)
+	h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, OrphanDetachGracePeriod: time.Hour, ReconcileBatchSize: 1})
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+	h.Init(queue, queue)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.orphans.clock = func() time.Time { return now }
+	reconcile := func() {
+		if err := h.ReconcileVA(ctx); err != nil {
+			t.Fatalf("ReconcileVA failed: %v", err)
+		}
+		now = now.Add(2 * time.Hour)
+	}
+
+	// The first pass finds the orphan, the second one records it again in
+	// its first window.
+	reconcile()
+	reconcile()
+	reconcile()
+	if _, found := h.orphans.firstSeen[orphanedAttachment{volumeHandle: testVolumeHandle, nodeID: orphanNodeID}]; !found {
+		t.Fatalf("expected the orphan to be found by the first pass")
+	}
+
+	// The volume gets a VolumeAttachment before the last window of the
+	// pass, it must not be detached.
+	if err := vaInformer.GetIndexer().Add(createVolumeAttachment(testAttacherName, "pv1", orphanNode, true, fin, nil)); err != nil {
+		t.Fatalf("Failed to add VolumeAttachment: %v", err)
+	}
+	reconcile()
+	reconcile()
+	if !h.reconcilePass.started.IsZero() {
+		t.Fatalf("expected the pass to be finished")
+	}
+	if csiConnection.index != 0 {
+		t.Errorf("expected no CSI calls, got %d", csiConnection.index)
+	}
+	if len(h.orphans.firstSeen) != 0 {
+		t.Errorf("expected no orphans, got %v", h.orphans.firstSeen)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// StorageClass parameters with ControllerPublish secret, the same as
+	// used by the external-provisioner.
+	publishSecretNameKey      = "csi.storage.k8s.io/controller-publish-secret-name"
+	publishSecretNamespaceKey = "csi.storage.k8s.io/controller-publish-secret-namespace"
+
+	tokenPVName       = "pv.name"
+	tokenPVCName      = "pvc.name"
+	tokenPVCNamespace = "pvc.namespace"
+
+	// Name of PersistentVolume informer index by StorageClass name.
+	pvByStorageClassIndex = "ByStorageClass"
+	// Name of the index of fallbackSecrets by secret.
+	fallbackSecretIndex = "BySecret"
+)
+
+// fallbackSecret is the resolved fallback secret of a PV. The secret of a PV
+// depends also on its StorageClass, so it cannot be indexed by the PV
+// informer: the informer computes old index values of an updated PV again,
+// with the StorageClass as it is now. The handler keeps fallbackSecrets in
+// its own indexer instead and resolves them again when a PV or a
+// StorageClass changes.
+type fallbackSecret struct {
+	pvName string
+	secret string
+}
+
+func newFallbackSecrets() cache.Indexer {
+	keyFunc := func(obj any) (string, error) {
+		return obj.(*fallbackSecret).pvName, nil
+	}
+	return cache.NewIndexer(keyFunc, cache.Indexers{
+		fallbackSecretIndex: func(obj any) ([]string, error) {
+			return []string{obj.(*fallbackSecret).secret}, nil
+		},
+	})
+}
+
+func pvByStorageClassIndexFunc(obj any) ([]string, error) {
+	pv, ok := obj.(*v1.PersistentVolume)
+	if !ok || pv.Spec.StorageClassName == "" {
+		return nil, nil
+	}
+	return []string{pv.Spec.StorageClassName}, nil
+}
+
+// watchFallbackSecrets keeps fallbackSecrets up to date with PVs and
+// StorageClasses. scInformer may be nil when StorageClass secrets are not
+// used.
+func (h *csiHandler) watchFallbackSecrets(logger klog.Logger, pvInformer coreinformers.PersistentVolumeInformer, scInformer storageinformers.StorageClassInformer) {
+	h.fallbackSecrets = newFallbackSecrets()
+	pvInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if pv, ok := obj.(*v1.PersistentVolume); ok {
+				h.indexFallbackSecret(pv)
+			}
+		},
+		UpdateFunc: func(old, new any) {
+			oldPV, ok := old.(*v1.PersistentVolume)
+			if !ok {
+				return
+			}
+			pv, ok := new.(*v1.PersistentVolume)
+			if !ok || oldPV.ResourceVersion == pv.ResourceVersion {
+				return
+			}
+			h.indexFallbackSecret(pv)
+		},
+		DeleteFunc: func(obj any) {
+			if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok && unknown.Obj != nil {
+				obj = unknown.Obj
+			}
+			if pv, ok := obj.(*v1.PersistentVolume); ok {
+				h.unindexFallbackSecret(pv.Name)
+			}
+		},
+	})
+	if scInformer == nil {
+		return
+	}
+	if err := addIndexers(pvInformer.Informer(), cache.Indexers{pvByStorageClassIndex: pvByStorageClassIndexFunc}); err != nil {
+		logger.Error(err, "Failed to add PersistentVolume indexers")
+	}
+	scInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if sc, ok := obj.(*storage.StorageClass); ok {
+				h.reindexFallbackSecrets(sc.Name)
+			}
+		},
+		UpdateFunc: func(old, new any) {
+			oldSC, ok := old.(*storage.StorageClass)
+			if !ok {
+				return
+			}
+			sc, ok := new.(*storage.StorageClass)
+			if !ok || oldSC.ResourceVersion == sc.ResourceVersion {
+				return
+			}
+			h.reindexFallbackSecrets(sc.Name)
+		},
+		DeleteFunc: func(obj any) {
+			if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok && unknown.Obj != nil {
+				obj = unknown.Obj
+			}
+			if sc, ok := obj.(*storage.StorageClass); ok {
+				h.reindexFallbackSecrets(sc.Name)
+			}
+		},
+	})
+}
+
+// indexFallbackSecret resolves the fallback secret of the PV and stores it in
+// fallbackSecrets. PVs with ControllerPublishSecretRef and CSI PVs of other
+// drivers have no fallback secret.
+func (h *csiHandler) indexFallbackSecret(pv *v1.PersistentVolume) {
+	// The secret is resolved under the lock, so a StorageClass event cannot
+	// store a newer secret of the PV in between.
+	h.fallbackSecretsMux.Lock()
+	defer h.fallbackSecretsMux.Unlock()
+	h.indexFallbackSecretLocked(pv)
+}
+
+func (h *csiHandler) indexFallbackSecretLocked(pv *v1.PersistentVolume) {
+	var secretRef *v1.SecretReference
+	if pv.Spec.CSI == nil || (pv.Spec.CSI.Driver == h.attacherName && pv.Spec.CSI.ControllerPublishSecretRef == nil) {
+		// Errors are reported when the PV is attached.
+		secretRef, _ = h.getFallbackSecretRef(pv)
+	}
+	if secretRef == nil {
+		_ = h.fallbackSecrets.Delete(&fallbackSecret{pvName: pv.Name})
+		return
+	}
+	_ = h.fallbackSecrets.Update(&fallbackSecret{pvName: pv.Name, secret: secretKey(secretRef.Namespace, secretRef.Name)})
+}
+
+// unindexFallbackSecret removes a deleted PV from fallbackSecrets.
+func (h *csiHandler) unindexFallbackSecret(pvName string) {
+	h.fallbackSecretsMux.Lock()
+	defer h.fallbackSecretsMux.Unlock()
+	_ = h.fallbackSecrets.Delete(&fallbackSecret{pvName: pvName})
+}
+
+// reindexFallbackSecrets resolves fallback secrets of all PVs of the
+// StorageClass again.
+func (h *csiHandler) reindexFallbackSecrets(scName string) {
+	h.fallbackSecretsMux.Lock()
+	defer h.fallbackSecretsMux.Unlock()
+	// List the PVs under the lock, so a PV deleted in the meantime is not
+	// indexed again.
+	pvs, err := h.pvIndexer.ByIndex(pvByStorageClassIndex, scName)
+	if err != nil {
+		klog.Background().Error(err, "Failed to list PersistentVolumes by StorageClass", "StorageClass", scName)
+		return
+	}
+	for _, obj := range pvs {
+		if pv, ok := obj.(*v1.PersistentVolume); ok {
+			h.indexFallbackSecretLocked(pv)
+		}
+	}
+}
+
+// getFallbackSecretRef returns ControllerPublish secret of a PV that does not
+// have ControllerPublishSecretRef. The secret is taken from parameters of the
+// PV's StorageClass or from the driver-wide default secret, in this order.
+// It returns nil when there is no fallback secret.
+func (h *csiHandler) getFallbackSecretRef(pv *v1.PersistentVolume) (*v1.SecretReference, error) {
+	if h.scLister != nil && pv.Spec.StorageClassName != "" {
+		sc, err := h.scLister.Get(pv.Spec.StorageClassName)
+		switch {
+		case err == nil:
+			nameTemplate, hasName := sc.Parameters[publishSecretNameKey]
+			namespaceTemplate, hasNamespace := sc.Parameters[publishSecretNamespaceKey]
+			if hasName != hasNamespace {
+				return nil, fmt.Errorf("StorageClass %q must specify both %s and %s parameters", sc.Name, publishSecretNameKey, publishSecretNamespaceKey)
+			}
+			if hasName {
+				return resolveSecretRef(pv, nameTemplate, namespaceTemplate)
+			}
+		case apierrs.IsNotFound(err):
+			// The StorageClass may have been deleted after the PV was
+			// provisioned, fall back to the default secret.
+		default:
+			return nil, err
+		}
+	}
+	if h.defaultSecretRef != nil {
+		return resolveSecretRef(pv, h.defaultSecretRef.Name, h.defaultSecretRef.Namespace)
+	}
+	return nil, nil
+}
+
+// listVAsByFallbackSecret returns VolumeAttachments of PVs without
+// ControllerPublishSecretRef whose fallback secret has the given key.
+func (h *csiHandler) listVAsByFallbackSecret(key string) ([]*storage.VolumeAttachment, error) {
+	if h.fallbackSecrets == nil {
+		return nil, nil
+	}
+	secrets, err := h.fallbackSecrets.ByIndex(fallbackSecretIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	var vas []*storage.VolumeAttachment
+	for _, obj := range secrets {
+		pvVAs, err := listVAsByIndex(h.vaIndexer, vaByPVNameIndex, obj.(*fallbackSecret).pvName)
+		if err != nil {
+			return nil, err
+		}
+		vas = append(vas, pvVAs...)
+	}
+	return vas, nil
+}
+
+// resolveSecretRef resolves templates of secret name and namespace. The
+// namespace may contain ${pv.name} and ${pvc.namespace}, the name may contain
+// also ${pvc.name}.
+func resolveSecretRef(pv *v1.PersistentVolume, nameTemplate, namespaceTemplate string) (*v1.SecretReference, error) {
+	params := map[string]string{
+		tokenPVName: pv.Name,
+	}
+	if pv.Spec.ClaimRef != nil {
+		params[tokenPVCNamespace] = pv.Spec.ClaimRef.Namespace
+	}
+	namespace, err := resolveTemplate(namespaceTemplate, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret namespace %q: %s", namespaceTemplate, err)
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("secret namespace %q resolved from %q is not valid: %s", namespace, namespaceTemplate, strings.Join(errs, ", "))
+	}
+
+	if pv.Spec.ClaimRef != nil {
+		params[tokenPVCName] = pv.Spec.ClaimRef.Name
+	}
+	name, err := resolveTemplate(nameTemplate, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret name %q: %s", nameTemplate, err)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("secret name %q resolved from %q is not valid: %s", name, nameTemplate, strings.Join(errs, ", "))
+	}
+
+	return &v1.SecretReference{Name: name, Namespace: namespace}, nil
+}
+
+// resolveTemplate replaces ${token} in the template with values from params.
+// It fails when the template contains a token that is not in params.
+func resolveTemplate(template string, params map[string]string) (string, error) {
+	missing := sets.New[string]()
+	resolved := os.Expand(template, func(token string) string {
+		value, found := params[token]
+		if !found {
+			missing.Insert(token)
+		}
+		return value
+	})
+	if missing.Len() > 0 {
+		return "", fmt.Errorf("unknown or unavailable tokens: %q", sets.List(missing))
+	}
+	return resolved, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestResolveSecretRef(t *testing.T) {
+	tests := []struct {
+		name              string
+		pv                *v1.PersistentVolume
+		nameTemplate      string
+		namespaceTemplate string
+		expectedRef       *v1.SecretReference
+		expectError       bool
+	}{
+		{
+			name:              "no templates",
+			pv:                pv(),
+			nameTemplate:      "secret",
+			namespaceTemplate: "default",
+			expectedRef:       &v1.SecretReference{Name: "secret", Namespace: "default"},
+		},
+		{
+			name:              "PV templates",
+			pv:                pv(),
+			nameTemplate:      "${pv.name}-secret",
+			namespaceTemplate: "ns-${pv.name}",
+			expectedRef:       &v1.SecretReference{Name: "pv1-secret", Namespace: "ns-pv1"},
+		},
+		{
+			name:              "PVC templates",
+			pv:                pvWithClaimRef(pv()),
+			nameTemplate:      "${pvc.namespace}-${pvc.name}",
+			namespaceTemplate: "${pvc.namespace}",
+			expectedRef:       &v1.SecretReference{Name: "default-pvc1", Namespace: "default"},
+		},
+		{
+			name:              "PVC template without ClaimRef",
+			pv:                pv(),
+			nameTemplate:      "${pvc.name}",
+			namespaceTemplate: "default",
+			expectError:       true,
+		},
+		{
+			name:              "PVC name in namespace",
+			pv:                pvWithClaimRef(pv()),
+			nameTemplate:      "secret",
+			namespaceTemplate: "${pvc.name}",
+			expectError:       true,
+		},
+		{
+			name:              "unknown token",
+			pv:                pv(),
+			nameTemplate:      "${pvc.annotations}",
+			namespaceTemplate: "default",
+			expectError:       true,
+		},
+		{
+			name:              "invalid name",
+			pv:                pv(),
+			nameTemplate:      "Secret_1",
+			namespaceTemplate: "default",
+			expectError:       true,
+		},
+		{
+			name:              "invalid namespace",
+			pv:                pv(),
+			nameTemplate:      "secret",
+			namespaceTemplate: "",
+			expectError:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := resolveSecretRef(test.pv, test.nameTemplate, test.namespaceTemplate)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ref, test.expectedRef) {
+				t.Errorf("Expected %+v, got %+v", test.expectedRef, ref)
+			}
+		})
+	}
+}
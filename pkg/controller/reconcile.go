@@ -0,0 +1,128 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// reconcilePass is the state of a pass of the VolumeAttachment reconciler
+// through all VolumeAttachments of the driver. A pass may take several
+// reconciliations, each of them checks a window of VolumeAttachments sorted
+// by name. Results that need all VolumeAttachments, such as orphaned
+// attachments, are collected through the pass and used when it completes.
+// It is used only by the reconciler, which runs in a single goroutine.
+type reconcilePass struct {
+	// cursor is the name of the last VolumeAttachment checked in the pass.
+	// The next window starts after it.
+	cursor string
+	// started is the time when the pass started. Zero when no pass is in
+	// progress.
+	started time.Time
+	// abnormal are volume handles of volumes with an abnormal condition.
+	abnormal sets.Set[string]
+	// orphans are volumes published on nodes without a VolumeAttachment.
+	orphans sets.Set[orphanedAttachment]
+	// complete is false when some VolumeAttachments could not be matched
+	// with volumes of the driver during the pass.
+	complete bool
+	// published are all VolumeAttachments matched with volumes of the
+	// driver, when the driver lists all its volumes at once. Nil when the
+	// volumes were not listed in the pass.
+	published *publishedVolumes
+	// listedVolumes are VolumeAttachments matched with published, with
+	// their volumes, by name.
+	listedVolumes map[string]vaVolume
+	clock         func() time.Time
+}
+
+func newReconcilePass() *reconcilePass {
+	return &reconcilePass{clock: time.Now}
+}
+
+// start starts a new pass, when none is in progress.
+func (p *reconcilePass) start() {
+	if !p.started.IsZero() {
+		return
+	}
+	p.cursor = ""
+	p.started = p.clock()
+	p.abnormal = sets.New[string]()
+	p.orphans = sets.New[orphanedAttachment]()
+	p.complete = true
+	p.published = nil
+	p.listedVolumes = nil
+}
+
+// listed stores volumes listed for the whole pass and VolumeAttachments
+// matched with them.
+func (p *reconcilePass) listed(vaVolumes []vaVolume, published *publishedVolumes) {
+	p.published = published
+	p.abnormal = p.abnormal.Union(published.abnormal)
+	p.orphans.Insert(published.orphans...)
+	p.listedVolumes = make(map[string]vaVolume, len(vaVolumes))
+	for _, v := range vaVolumes {
+		p.listedVolumes[v.va.Name] = v
+	}
+}
+
+// changedSinceListing returns true when the VolumeAttachment was not matched
+// with volumes listed in the pass, e.g. because it was created or changed
+// after they were listed.
+func (p *reconcilePass) changedSinceListing(va *storage.VolumeAttachment) bool {
+	if p.listedVolumes == nil {
+		return false
+	}
+	v, found := p.listedVolumes[va.Name]
+	return !found || v.va.ResourceVersion != va.ResourceVersion
+}
+
+// window returns at most batchSize VolumeAttachments that follow the cursor,
+// sorted by name. Zero batchSize means no limit. last is true when there are
+// no more VolumeAttachments after the window.
+func (p *reconcilePass) window(vas []*storage.VolumeAttachment, batchSize int) (window []*storage.VolumeAttachment, last bool) {
+	vas = slices.Clone(vas)
+	slices.SortFunc(vas, func(a, b *storage.VolumeAttachment) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	first, _ := slices.BinarySearchFunc(vas, p.cursor, func(va *storage.VolumeAttachment, name string) int {
+		if va.Name <= name {
+			return -1
+		}
+		return 1
+	})
+	vas = vas[first:]
+	if batchSize > 0 && len(vas) > batchSize {
+		return vas[:batchSize], false
+	}
+	return vas, true
+}
+
+// finish ends the pass and returns how long it took.
+func (p *reconcilePass) finish() time.Duration {
+	duration := p.clock().Sub(p.started)
+	p.started = time.Time{}
+	p.cursor = ""
+	p.published = nil
+	p.listedVolumes = nil
+	return duration
+}
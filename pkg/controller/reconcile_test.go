@@ -0,0 +1,358 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	csitranslator "k8s.io/csi-translation-lib"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestReconcilePassWindow(t *testing.T) {
+	var vas []*storage.VolumeAttachment
+	for _, name := range []string{"c", "a", "d", "b"} {
+		vas = append(vas, createVolumeAttachment(testAttacherName, name, testNodeName, true, fin, nil))
+	}
+	names := func(vas []*storage.VolumeAttachment) []string {
+		var names []string
+		for _, va := range vas {
+			names = append(names, *va.Spec.Source.PersistentVolumeName)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name          string
+		cursor        string
+		batchSize     int
+		expectedNames []string
+		expectedLast  bool
+	}{
+		{
+			name:          "no limit",
+			expectedNames: []string{"a", "b", "c", "d"},
+			expectedLast:  true,
+		},
+		{
+			name:          "first window",
+			batchSize:     3,
+			expectedNames: []string{"a", "b", "c"},
+		},
+		{
+			name:          "last window",
+			cursor:        "c-" + testNodeName,
+			batchSize:     3,
+			expectedNames: []string{"d"},
+			expectedLast:  true,
+		},
+		{
+			name:          "cursor of a deleted VolumeAttachment",
+			cursor:        "bb-" + testNodeName,
+			batchSize:     1,
+			expectedNames: []string{"c"},
+		},
+		{
+			name:         "after the last VolumeAttachment",
+			cursor:       "e-" + testNodeName,
+			batchSize:    1,
+			expectedLast: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pass := newReconcilePass()
+			pass.start()
+			pass.cursor = test.cursor
+			window, last := pass.window(vas, test.batchSize)
+			if got := names(window); !reflect.DeepEqual(got, test.expectedNames) {
+				t.Errorf("expected window %v, got %v", test.expectedNames, got)
+			}
+			if last != test.expectedLast {
+				t.Errorf("expected last %t, got %t", test.expectedLast, last)
+			}
+		})
+	}
+}
+
+func TestReconcileVAWindows(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   int
+		maxRequeues int
+		// expectedRequeues are VolumeAttachments requeued by each
+		// reconciliation.
+		expectedRequeues [][]string
+		// expectedPasses are numbers of complete passes after each
+		// reconciliation.
+		expectedPasses []int
+	}{
+		{
+			name:             "no limits",
+			expectedRequeues: [][]string{{"pv1-node1", "pv2-node1", "pv3-node1"}, {"pv1-node1", "pv2-node1", "pv3-node1"}},
+			expectedPasses:   []int{1, 2},
+		},
+		{
+			name:             "batch size",
+			batchSize:        2,
+			expectedRequeues: [][]string{{"pv1-node1", "pv2-node1"}, {"pv3-node1"}, {"pv1-node1", "pv2-node1"}},
+			expectedPasses:   []int{0, 1, 1},
+		},
+		{
+			name:             "max requeues",
+			maxRequeues:      2,
+			expectedRequeues: [][]string{{"pv1-node1", "pv2-node1"}, {"pv3-node1"}, {"pv1-node1", "pv2-node1"}},
+			expectedPasses:   []int{0, 1, 1},
+		},
+		{
+			name:             "batch size and max requeues",
+			batchSize:        2,
+			maxRequeues:      1,
+			expectedRequeues: [][]string{{"pv1-node1"}, {"pv2-node1"}, {"pv3-node1"}},
+			expectedPasses:   []int{0, 0, 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			client := fake.NewSimpleClientset()
+			informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+			vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+			pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+			if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+				t.Fatalf("Failed to add indexers: %v", err)
+			}
+			if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+				t.Fatalf("Failed to add indexers: %v", err)
+			}
+			for i := 1; i <= 3; i++ {
+				pv := pv()
+				pv.Name = fmt.Sprintf("pv%d", i)
+				pv.Spec.CSI.VolumeHandle = fmt.Sprintf("vol%d", i)
+				if err := pvInformer.GetIndexer().Add(pv); err != nil {
+					t.Fatalf("Failed to add PV: %v", err)
+				}
+				// Attached, but the driver reports no published volumes.
+				va := createVolumeAttachment(testAttacherName, pv.Name, testNodeName, true, fin, nil)
+				if err := vaInformer.GetIndexer().Add(va); err != nil {
+					t.Fatalf("Failed to add VolumeAttachment: %v", err)
+				}
+			}
+			if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+				t.Fatalf("Failed to add CSINode: %v", err)
+			}
+
+			lister := &fakeLister{t: t, publishedNodes: map[string][]string{}}
+			h := csiHandlerFactory(client, record.NewFakeRecorder(100), informerFactory, nil, lister).(*csiHandler)
+			h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, ReconcileBatchSize: test.batchSize, ReconcileMaxRequeues: test.maxRequeues})
+			queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+			defer queue.ShutDown()
+			h.Init(queue, queue)
+
+			passes := 0
+			for i := range test.expectedRequeues {
+				if err := h.ReconcileVA(ctx); err != nil {
+					t.Fatalf("ReconcileVA failed: %v", err)
+				}
+				// A complete pass is finished.
+				if h.reconcilePass.started.IsZero() {
+					passes++
+				}
+
+				var requeued []string
+				for queue.Len() > 0 {
+					name, _ := queue.Get()
+					if !h.consumeForceSync(name) {
+						t.Errorf("expected forceSync of requeued VolumeAttachment %s", name)
+					}
+					requeued = append(requeued, name)
+					queue.Done(name)
+				}
+				slices.Sort(requeued)
+				if !reflect.DeepEqual(requeued, test.expectedRequeues[i]) {
+					t.Errorf("reconciliation %d: expected requeued %v, got %v", i, test.expectedRequeues[i], requeued)
+				}
+				if passes != test.expectedPasses[i] {
+					t.Errorf("reconciliation %d: expected %d complete passes, got %d", i, test.expectedPasses[i], passes)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileVAListsOncePerPass(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		pv := pv()
+		pv.Name = fmt.Sprintf("pv%d", i)
+		pv.Spec.CSI.VolumeHandle = fmt.Sprintf("vol%d", i)
+		if err := pvInformer.GetIndexer().Add(pv); err != nil {
+			t.Fatalf("Failed to add PV: %v", err)
+		}
+		// Attached, but the driver reports no published volumes.
+		va := createVolumeAttachment(testAttacherName, pv.Name, testNodeName, true, fin, nil)
+		va.ResourceVersion = "1"
+		if err := vaInformer.GetIndexer().Add(va); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+	if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+		t.Fatalf("Failed to add CSINode: %v", err)
+	}
+
+	lister := &fakeLister{t: t, publishedNodes: map[string][]string{}, listsAll: true}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(100), informerFactory, nil, lister).(*csiHandler)
+	h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, ReconcileBatchSize: 1})
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+	h.Init(queue, queue)
+
+	// expectedRequeues are VolumeAttachments requeued by each
+	// reconciliation. pv2-node1 changes after the volumes were listed, so
+	// it is not checked in the first pass.
+	expectedRequeues := [][]string{{"pv1-node1"}, nil, {"pv3-node1"}, {"pv1-node1"}}
+	// expectedCalls are numbers of ListVolumes after each reconciliation.
+	expectedCalls := []int{1, 1, 1, 2}
+	for i := range expectedRequeues {
+		if err := h.ReconcileVA(ctx); err != nil {
+			t.Fatalf("ReconcileVA failed: %v", err)
+		}
+		if i == 0 {
+			obj, _, _ := vaInformer.GetIndexer().GetByKey("pv2-node1")
+			va := obj.(*storage.VolumeAttachment).DeepCopy()
+			va.ResourceVersion = "2"
+			if err := vaInformer.GetIndexer().Update(va); err != nil {
+				t.Fatalf("Failed to update VolumeAttachment: %v", err)
+			}
+		}
+
+		var requeued []string
+		for queue.Len() > 0 {
+			name, _ := queue.Get()
+			h.consumeForceSync(name)
+			requeued = append(requeued, name)
+			queue.Done(name)
+		}
+		if !reflect.DeepEqual(requeued, expectedRequeues[i]) {
+			t.Errorf("reconciliation %d: expected requeued %v, got %v", i, expectedRequeues[i], requeued)
+		}
+		if lister.calls != expectedCalls[i] {
+			t.Errorf("reconciliation %d: expected %d ListVolumes calls, got %d", i, expectedCalls[i], lister.calls)
+		}
+	}
+}
+
+// countingCSINodeLister counts CSINodes got by node name, i.e. resolved
+// volumes of VolumeAttachments.
+type countingCSINodeLister struct {
+	storagelisters.CSINodeLister
+	gets int
+}
+
+func (l *countingCSINodeLister) Get(name string) (*storage.CSINode, error) {
+	l.gets++
+	return l.CSINodeLister.Get(name)
+}
+
+func TestReconcileVAResolvesWindow(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	vaInformer := informerFactory.Storage().V1().VolumeAttachments().Informer()
+	pvInformer := informerFactory.Core().V1().PersistentVolumes().Informer()
+	if err := addIndexers(vaInformer, vaIndexers()); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	if err := addIndexers(pvInformer, pvIndexers(logger, csitranslator.New())); err != nil {
+		t.Fatalf("Failed to add indexers: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		pv := pv()
+		pv.Name = fmt.Sprintf("pv%d", i)
+		pv.Spec.CSI.VolumeHandle = fmt.Sprintf("vol%d", i)
+		if err := pvInformer.GetIndexer().Add(pv); err != nil {
+			t.Fatalf("Failed to add PV: %v", err)
+		}
+		va := createVolumeAttachment(testAttacherName, pv.Name, testNodeName, true, fin, nil)
+		if err := vaInformer.GetIndexer().Add(va); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+	if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+		t.Fatalf("Failed to add CSINode: %v", err)
+	}
+
+	// The fake lister returns all volumes for each window, vol1 is seen
+	// as an orphaned attachment in windows without pv1-node1 until the
+	// pass completes.
+	lister := &fakeLister{t: t, publishedNodes: map[string][]string{
+		"vol1": {testNodeID},
+		"vol2": {testNodeID},
+		"vol3": {testNodeID},
+	}}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(100), informerFactory, nil, lister).(*csiHandler)
+	csiNodeLister := &countingCSINodeLister{CSINodeLister: h.csiNodeLister}
+	h.csiNodeLister = csiNodeLister
+	h.UpdateSettings(HandlerSettings{Timeout: timeout, MaxRetryDelay: 5 * time.Minute, ReconcileBatchSize: 1})
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+	h.Init(queue, queue)
+
+	// expectedResolved are numbers of VolumeAttachments resolved by each
+	// reconciliation. The last window of the pass resolves all of them to
+	// match the orphaned attachments.
+	expectedResolved := []int{1, 1, 1 + 3}
+	for i, expected := range expectedResolved {
+		csiNodeLister.gets = 0
+		if err := h.ReconcileVA(ctx); err != nil {
+			t.Fatalf("ReconcileVA failed: %v", err)
+		}
+		if csiNodeLister.gets != expected {
+			t.Errorf("reconciliation %d: expected %d resolved VolumeAttachments, got %d", i, expected, csiNodeLister.gets)
+		}
+		if queue.Len() != 0 {
+			t.Errorf("reconciliation %d: expected no requeued VolumeAttachments, got %d", i, queue.Len())
+		}
+	}
+	if !h.reconcilePass.started.IsZero() {
+		t.Errorf("expected a complete pass")
+	}
+	if len(h.orphans.firstSeen) != 0 {
+		t.Errorf("expected no orphans, got %v", h.orphans.firstSeen)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/yaml"
+)
+
+// RetryRule is a backoff of VolumeAttachments that failed with one of the
+// gRPC codes. The delay starts at InitialDelay and doubles with each failure,
+// up to MaxDelay. InitialDelay equal to MaxDelay is a fixed interval.
+type RetryRule struct {
+	// Codes are names of gRPC codes, e.g. "ResourceExhausted" or
+	// "RESOURCE_EXHAUSTED". Not used in the default rule.
+	Codes        []string        `json:"codes,omitempty"`
+	InitialDelay metav1.Duration `json:"initialDelay"`
+	MaxDelay     metav1.Duration `json:"maxDelay"`
+}
+
+// RetryPolicyConfig is a retry policy of VolumeAttachments, as read from the
+// policy file.
+type RetryPolicyConfig struct {
+	// Default is used for errors that do not match any rule. Errors that do
+	// not come from the CSI driver match gRPC code "Unknown".
+	Default RetryRule   `json:"default"`
+	Rules   []RetryRule `json:"rules,omitempty"`
+}
+
+// DefaultRetryPolicyConfig returns the retry policy used when there is no
+// policy file. Errors without a rule use exponential backoff from
+// initialDelay to maxDelay.
+func DefaultRetryPolicyConfig(initialDelay, maxDelay time.Duration) RetryPolicyConfig {
+	return RetryPolicyConfig{
+		Default: RetryRule{
+			InitialDelay: metav1.Duration{Duration: initialDelay},
+			MaxDelay:     metav1.Duration{Duration: maxDelay},
+		},
+		Rules: []RetryRule{
+			{
+				// The driver or the backend is overloaded, give it time
+				// to recover.
+				Codes:        []string{codes.ResourceExhausted.String(), codes.Unavailable.String()},
+				InitialDelay: metav1.Duration{Duration: 10 * initialDelay},
+				MaxDelay:     metav1.Duration{Duration: 2 * maxDelay},
+			},
+			{
+				// Another operation with the volume is in progress,
+				// it is likely to finish soon.
+				Codes:        []string{codes.Aborted.String()},
+				InitialDelay: metav1.Duration{Duration: initialDelay / 10},
+				MaxDelay:     metav1.Duration{Duration: 10 * initialDelay},
+			},
+			{
+				// Retries are unlikely to help until something changes.
+				Codes:        []string{codes.NotFound.String(), codes.InvalidArgument.String()},
+				InitialDelay: metav1.Duration{Duration: maxDelay},
+				MaxDelay:     metav1.Duration{Duration: maxDelay},
+			},
+		},
+	}
+}
+
+// LoadRetryPolicyConfig reads a retry policy file in YAML or JSON. Fields
+// that are not in the file are taken from defaults, the rules in the file
+// replace all default rules.
+func LoadRetryPolicyConfig(path string, defaults RetryPolicyConfig) (RetryPolicyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RetryPolicyConfig{}, err
+	}
+	config := defaults
+	// Unmarshal reuses the backing array of slices.
+	config.Rules = slices.Clone(defaults.Rules)
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return RetryPolicyConfig{}, fmt.Errorf("failed to parse retry policy %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// RetryPolicy is a rate limiter of the VolumeAttachment queue that computes
+// the delay from the gRPC code of the last error of each VolumeAttachment.
+// The error must be set by SetError before the VolumeAttachment is re-queued.
+type RetryPolicy struct {
+	defaultRule retryRule
+	rules       map[codes.Code]retryRule
+
+	mux   sync.Mutex
+	items map[string]*retryState
+}
+
+var _ workqueue.TypedRateLimiter[string] = &RetryPolicy{}
+
+type retryRule struct {
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+type retryState struct {
+	code codes.Code
+	// failures is the number of failures with the current code.
+	failures int
+	// requeues is the number of all failures.
+	requeues int
+}
+
+// NewRetryPolicy creates a new RetryPolicy from the config.
+func NewRetryPolicy(config RetryPolicyConfig) (*RetryPolicy, error) {
+	defaultRule, rules, err := parseRetryPolicyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &RetryPolicy{
+		defaultRule: defaultRule,
+		rules:       rules,
+		items:       map[string]*retryState{},
+	}, nil
+}
+
+// Validate returns an error when the config cannot be used by a RetryPolicy.
+func (c RetryPolicyConfig) Validate() error {
+	_, _, err := parseRetryPolicyConfig(c)
+	return err
+}
+
+// Update replaces rules of the policy with rules from the config. Backoff of
+// items that are already failing continues with the new rules.
+func (p *RetryPolicy) Update(config RetryPolicyConfig) error {
+	defaultRule, rules, err := parseRetryPolicyConfig(config)
+	if err != nil {
+		return err
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.defaultRule = defaultRule
+	p.rules = rules
+	return nil
+}
+
+func parseRetryPolicyConfig(config RetryPolicyConfig) (retryRule, map[codes.Code]retryRule, error) {
+	defaultRule, err := newRetryRule(config.Default)
+	if err != nil {
+		return retryRule{}, nil, fmt.Errorf("invalid default rule: %s", err)
+	}
+	rules := map[codes.Code]retryRule{}
+	for i, r := range config.Rules {
+		rule, err := newRetryRule(r)
+		if err != nil {
+			return retryRule{}, nil, fmt.Errorf("invalid rule %d: %s", i, err)
+		}
+		if len(r.Codes) == 0 {
+			return retryRule{}, nil, fmt.Errorf("invalid rule %d: no codes", i)
+		}
+		for _, name := range r.Codes {
+			code, found := parseCode(name)
+			if !found {
+				return retryRule{}, nil, fmt.Errorf("invalid rule %d: unknown gRPC code %q", i, name)
+			}
+			if _, exists := rules[code]; exists {
+				return retryRule{}, nil, fmt.Errorf("invalid rule %d: gRPC code %s is already used by another rule", i, code)
+			}
+			rules[code] = rule
+		}
+	}
+	return defaultRule, rules, nil
+}
+
+func newRetryRule(r RetryRule) (retryRule, error) {
+	if r.InitialDelay.Duration <= 0 {
+		return retryRule{}, fmt.Errorf("initialDelay must be greater than zero")
+	}
+	if r.MaxDelay.Duration < r.InitialDelay.Duration {
+		return retryRule{}, fmt.Errorf("maxDelay must not be smaller than initialDelay")
+	}
+	return retryRule{initialDelay: r.InitialDelay.Duration, maxDelay: r.MaxDelay.Duration}, nil
+}
+
+// parseCode finds a gRPC code by its name, ignoring case and underscores.
+func parseCode(name string) (codes.Code, bool) {
+	normalized := strings.ReplaceAll(name, "_", "")
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(normalized, c.String()) {
+			return c, true
+		}
+	}
+	return codes.OK, false
+}
+
+// SetError records the last error of the item. The backoff restarts from
+// the initial delay when the error has a different code than the previous one.
+// It is safe to call SetError on nil RetryPolicy.
+func (p *RetryPolicy) SetError(item string, err error) {
+	if p == nil {
+		return
+	}
+	code := status.Code(err)
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	state, found := p.items[item]
+	if !found {
+		p.items[item] = &retryState{code: code}
+		return
+	}
+	if state.code != code {
+		state.code = code
+		state.failures = 0
+	}
+}
+
+// When returns the delay of the next retry of the item.
+func (p *RetryPolicy) When(item string) time.Duration {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	state, found := p.items[item]
+	if !found {
+		// The error was not set, e.g. the VolumeAttachment could not be
+		// read from the informer.
+		state = &retryState{code: codes.Unknown}
+		p.items[item] = state
+	}
+	rule, found := p.rules[state.code]
+	if !found {
+		rule = p.defaultRule
+	}
+
+	exp := state.failures
+	state.failures++
+	state.requeues++
+
+	backoff := float64(rule.initialDelay.Nanoseconds()) * math.Pow(2, float64(exp))
+	if backoff > float64(rule.maxDelay.Nanoseconds()) {
+		return rule.maxDelay
+	}
+	return time.Duration(backoff)
+}
+
+// Forget resets the backoff of the item.
+func (p *RetryPolicy) Forget(item string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	delete(p.items, item)
+}
+
+// NumRequeues returns the number of failures of the item.
+func (p *RetryPolicy) NumRequeues(item string) int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if state, found := p.items[item]; found {
+		return state.requeues
+	}
+	return 0
+}
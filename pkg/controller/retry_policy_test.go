@@ -0,0 +1,337 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy, err := NewRetryPolicy(DefaultRetryPolicyConfig(time.Second, 5*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create policy: %s", err)
+	}
+
+	tests := []struct {
+		name           string
+		errs           []error
+		expectedDelays []time.Duration
+	}{
+		{
+			name:           "error from outside of the driver",
+			errs:           []error{errors.New("mock error"), errors.New("mock error"), errors.New("mock error")},
+			expectedDelays: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name: "wrapped timeout",
+			errs: []error{
+				fmt.Errorf("failed to attach: %w", status.Error(codes.DeadlineExceeded, "mock error")),
+				fmt.Errorf("failed to attach: %w", status.Error(codes.DeadlineExceeded, "mock error")),
+			},
+			expectedDelays: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name: "resource exhausted",
+			errs: []error{
+				status.Error(codes.ResourceExhausted, "mock error"),
+				status.Error(codes.Unavailable, "mock error"),
+				status.Error(codes.Unavailable, "mock error"),
+			},
+			expectedDelays: []time.Duration{10 * time.Second, 10 * time.Second, 20 * time.Second},
+		},
+		{
+			name: "aborted",
+			errs: []error{
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+			},
+			expectedDelays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name: "not found is fixed",
+			errs: []error{
+				status.Error(codes.NotFound, "mock error"),
+				status.Error(codes.NotFound, "mock error"),
+				status.Error(codes.InvalidArgument, "mock error"),
+			},
+			expectedDelays: []time.Duration{5 * time.Minute, 5 * time.Minute, 5 * time.Minute},
+		},
+		{
+			name: "code change restarts backoff",
+			errs: []error{
+				errors.New("mock error"),
+				errors.New("mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				errors.New("mock error"),
+			},
+			expectedDelays: []time.Duration{time.Second, 2 * time.Second, 100 * time.Millisecond, time.Second},
+		},
+		{
+			name: "max delay",
+			errs: []error{
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+				status.Error(codes.Aborted, "mock error"),
+			},
+			expectedDelays: []time.Duration{
+				100 * time.Millisecond,
+				200 * time.Millisecond,
+				400 * time.Millisecond,
+				800 * time.Millisecond,
+				1600 * time.Millisecond,
+				3200 * time.Millisecond,
+				6400 * time.Millisecond,
+				10 * time.Second,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item := test.name
+			defer policy.Forget(item)
+			for i, err := range test.errs {
+				policy.SetError(item, err)
+				delay := policy.When(item)
+				if delay != test.expectedDelays[i] {
+					t.Errorf("failure %d: expected delay %s, got %s", i, test.expectedDelays[i], delay)
+				}
+			}
+			if requeues := policy.NumRequeues(item); requeues != len(test.errs) {
+				t.Errorf("expected %d requeues, got %d", len(test.errs), requeues)
+			}
+			policy.Forget(item)
+			if requeues := policy.NumRequeues(item); requeues != 0 {
+				t.Errorf("expected 0 requeues after Forget, got %d", requeues)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyCap(t *testing.T) {
+	policy, err := NewRetryPolicy(DefaultRetryPolicyConfig(time.Second, 5*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create policy: %s", err)
+	}
+	var delay time.Duration
+	for range 100 {
+		delay = policy.When("item")
+	}
+	if delay != 5*time.Minute {
+		t.Errorf("expected delay capped to %s, got %s", 5*time.Minute, delay)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	second := metav1.Duration{Duration: time.Second}
+	minute := metav1.Duration{Duration: time.Minute}
+	tests := []struct {
+		name        string
+		config      RetryPolicyConfig
+		expectError bool
+	}{
+		{
+			name: "valid config",
+			config: RetryPolicyConfig{
+				Default: RetryRule{InitialDelay: second, MaxDelay: minute},
+				Rules: []RetryRule{
+					{Codes: []string{"RESOURCE_EXHAUSTED", "unavailable"}, InitialDelay: minute, MaxDelay: minute},
+				},
+			},
+		},
+		{
+			name: "missing default",
+			config: RetryPolicyConfig{
+				Rules: []RetryRule{
+					{Codes: []string{"Aborted"}, InitialDelay: second, MaxDelay: minute},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "max smaller than initial",
+			config: RetryPolicyConfig{
+				Default: RetryRule{InitialDelay: minute, MaxDelay: second},
+			},
+			expectError: true,
+		},
+		{
+			name: "rule without codes",
+			config: RetryPolicyConfig{
+				Default: RetryRule{InitialDelay: second, MaxDelay: minute},
+				Rules: []RetryRule{
+					{InitialDelay: second, MaxDelay: minute},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "unknown code",
+			config: RetryPolicyConfig{
+				Default: RetryRule{InitialDelay: second, MaxDelay: minute},
+				Rules: []RetryRule{
+					{Codes: []string{"Throttled"}, InitialDelay: second, MaxDelay: minute},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "duplicate code",
+			config: RetryPolicyConfig{
+				Default: RetryRule{InitialDelay: second, MaxDelay: minute},
+				Rules: []RetryRule{
+					{Codes: []string{"Aborted"}, InitialDelay: second, MaxDelay: minute},
+					{Codes: []string{"ABORTED"}, InitialDelay: second, MaxDelay: minute},
+				},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewRetryPolicy(test.config)
+			if err != nil && !test.expectError {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && test.expectError {
+				t.Errorf("expected error, got none")
+			}
+			if validateErr := test.config.Validate(); (validateErr != nil) != (err != nil) {
+				t.Errorf("expected Validate error %v, got %v", err, validateErr)
+			}
+		})
+	}
+}
+
+func TestLoadRetryPolicyConfig(t *testing.T) {
+	defaults := DefaultRetryPolicyConfig(time.Second, 5*time.Minute)
+	tests := []struct {
+		name           string
+		content        string
+		expectedConfig RetryPolicyConfig
+		expectError    bool
+	}{
+		{
+			name:           "empty file",
+			content:        "",
+			expectedConfig: defaults,
+		},
+		{
+			name: "default only",
+			content: `
+default:
+  maxDelay: 10m
+`,
+			expectedConfig: RetryPolicyConfig{
+				Default: RetryRule{
+					InitialDelay: metav1.Duration{Duration: time.Second},
+					MaxDelay:     metav1.Duration{Duration: 10 * time.Minute},
+				},
+				Rules: defaults.Rules,
+			},
+		},
+		{
+			name: "rules replace defaults",
+			content: `
+rules:
+- codes: [ResourceExhausted]
+  initialDelay: 30s
+  maxDelay: 30m
+`,
+			expectedConfig: RetryPolicyConfig{
+				Default: defaults.Default,
+				Rules: []RetryRule{
+					{
+						Codes:        []string{"ResourceExhausted"},
+						InitialDelay: metav1.Duration{Duration: 30 * time.Second},
+						MaxDelay:     metav1.Duration{Duration: 30 * time.Minute},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown field",
+			content: `
+rules:
+- code: ResourceExhausted
+  initialDelay: 30s
+  maxDelay: 30m
+`,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatalf("failed to write policy: %s", err)
+			}
+			config, err := LoadRetryPolicyConfig(path, defaults)
+			if err != nil && !test.expectError {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && test.expectError {
+				t.Errorf("expected error, got none")
+			}
+			if err == nil && !reflect.DeepEqual(config, test.expectedConfig) {
+				t.Errorf("expected config %+v, got %+v", test.expectedConfig, config)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyUpdate(t *testing.T) {
+	policy, err := NewRetryPolicy(DefaultRetryPolicyConfig(time.Second, 5*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create policy: %s", err)
+	}
+	policy.SetError("item", errors.New("mock error"))
+	if delay := policy.When("item"); delay != time.Second {
+		t.Errorf("expected delay %s, got %s", time.Second, delay)
+	}
+
+	if err := policy.Update(RetryPolicyConfig{}); err == nil {
+		t.Errorf("expected error of invalid policy, got none")
+	}
+	if err := policy.Update(DefaultRetryPolicyConfig(10*time.Second, 5*time.Minute)); err != nil {
+		t.Fatalf("failed to update policy: %s", err)
+	}
+	// The backoff of the item continues with the new rules.
+	if delay := policy.When("item"); delay != 20*time.Second {
+		t.Errorf("expected delay %s after update, got %s", 20*time.Second, delay)
+	}
+	if requeues := policy.NumRequeues("item"); requeues != 2 {
+		t.Errorf("expected 2 requeues, got %d", requeues)
+	}
+}
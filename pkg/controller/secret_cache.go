@@ -0,0 +1,113 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// secretCache caches content of secrets used in ControllerPublish and
+// ControllerUnpublish calls for a limited time. Only secrets that were
+// requested are cached. Errors are never cached, so a missing secret is
+// read again on the next attempt.
+type secretCache struct {
+	client kubernetes.Interface
+	// ttl is the time a secret stays in the cache. Zero disables the cache,
+	// all secrets are read from the API server.
+	ttl time.Duration
+	now func() time.Time
+
+	mux     sync.Mutex
+	secrets map[string]cachedSecret
+	// generation is incremented by each invalidate. A secret read from the
+	// API server is cached only when no invalidate happened during the
+	// read, it could be older than the change that invalidated it.
+	generation uint64
+}
+
+type cachedSecret struct {
+	data    map[string][]byte
+	expires time.Time
+}
+
+func newSecretCache(client kubernetes.Interface, ttl time.Duration) *secretCache {
+	return &secretCache{
+		client:  client,
+		ttl:     ttl,
+		now:     time.Now,
+		secrets: map[string]cachedSecret{},
+	}
+}
+
+// get returns data of the secret, either from the cache or from the API
+// server.
+func (c *secretCache) get(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	key := secretKey(namespace, name)
+	var generation uint64
+	if c.ttl > 0 {
+		c.mux.Lock()
+		cached, found := c.secrets[key]
+		generation = c.generation
+		c.mux.Unlock()
+		if found && c.now().Before(cached.expires) {
+			return maps.Clone(cached.data), nil
+		}
+	}
+
+	secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl > 0 {
+		c.mux.Lock()
+		if c.generation == generation {
+			c.secrets[key] = cachedSecret{
+				data:    maps.Clone(secret.Data),
+				expires: c.now().Add(c.ttl),
+			}
+		}
+		c.mux.Unlock()
+	}
+	return secret.Data, nil
+}
+
+// invalidate removes the secret from the cache.
+func (c *secretCache) invalidate(namespace, name string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.secrets, secretKey(namespace, name))
+	c.generation++
+}
+
+// StripSecretData is an informer transform function that removes content of
+// secrets. The attacher watches secrets only to learn about their changes,
+// it does not need to keep their content in memory.
+func StripSecretData(obj any) (any, error) {
+	if secret, ok := obj.(*v1.Secret); ok {
+		secret.Data = nil
+		secret.StringData = nil
+		secret.ManagedFields = nil
+	}
+	return obj, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestSecretCache(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+		Data:       map[string][]byte{"foo": []byte("bar")},
+	})
+	now := time.Now()
+	c := newSecretCache(client, time.Minute)
+	c.now = func() time.Time { return now }
+
+	countGets := func() int {
+		gets := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "secrets" {
+				gets++
+			}
+		}
+		return gets
+	}
+	expectGet := func(name string, expectedData map[string][]byte, expectedGets int) {
+		t.Helper()
+		data, err := c.get(ctx, "default", name)
+		if expectedData == nil {
+			if err == nil {
+				t.Errorf("Expected error, got none")
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if !reflect.DeepEqual(data, expectedData) {
+			t.Errorf("Expected data %v, got %v", expectedData, data)
+		}
+		if gets := countGets(); gets != expectedGets {
+			t.Errorf("Expected %d secret GETs, got %d", expectedGets, gets)
+		}
+	}
+
+	data := map[string][]byte{"foo": []byte("bar")}
+	expectGet("secret", data, 1)
+	// Served from the cache.
+	expectGet("secret", data, 1)
+
+	// Expired.
+	now = now.Add(2 * time.Minute)
+	expectGet("secret", data, 2)
+	expectGet("secret", data, 2)
+
+	// Invalidated.
+	c.invalidate("default", "secret")
+	expectGet("secret", data, 3)
+
+	// Errors are not cached.
+	expectGet("missing", nil, 4)
+	expectGet("missing", nil, 5)
+}
+
+func TestSecretCacheInvalidatedDuringGet(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+	})
+	c := newSecretCache(client, time.Minute)
+	// The secret changes after the attacher read it, but before it is
+	// stored in the cache.
+	client.PrependReactor("get", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		c.invalidate("default", "secret")
+		return false, nil, nil
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := c.get(ctx, "default", "secret"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if actions := len(client.Actions()); actions != 2 {
+		t.Errorf("Expected the secret not to be cached, got %d API calls", actions)
+	}
+}
+
+func TestSecretCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+	})
+	c := newSecretCache(client, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := c.get(ctx, "default", "secret"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if actions := len(client.Actions()); actions != 3 {
+		t.Errorf("Expected 3 API calls with disabled cache, got %d", actions)
+	}
+}
+
+func TestStripSecretData(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+		Data:       map[string][]byte{"foo": []byte("bar")},
+		StringData: map[string]string{"foo": "bar"},
+	}
+	obj, err := StripSecretData(secret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stripped := obj.(*v1.Secret)
+	if stripped.Data != nil || stripped.StringData != nil {
+		t.Errorf("Expected secret without data, got %+v", stripped)
+	}
+	if stripped.Name != "secret" || stripped.Namespace != "default" {
+		t.Errorf("Expected secret metadata to be preserved, got %+v", stripped.ObjectMeta)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// Shard is the part of VolumeAttachments that this replica of the
+// external-attacher processes when several replicas run in the sharded mode.
+// VolumeAttachments are assigned by their node name, PersistentVolumes by
+// their name.
+type Shard interface {
+	// Acquire returns true when the key belongs to the shard. Then the
+	// caller processes the key and calls Release when it is done. The
+	// shard is not handed over to another replica while a key is acquired.
+	Acquire(key string) bool
+	Release(key string)
+	// Owns returns true when the key belongs to the shard.
+	Owns(key string) bool
+}
+
+// SetShard limits the controller to VolumeAttachments and PersistentVolumes
+// of the shard. It must be called before Run.
+func (ctrl *CSIAttachController) SetShard(shard Shard) {
+	ctrl.shard = shard
+	ctrl.handler.SetShard(shard)
+}
+
+// RequeueAll adds all VolumeAttachments of the driver and PersistentVolumes
+// with the finalizer of the driver to the queues. It is called when the
+// shard changes, VolumeAttachments that were skipped before may belong to
+// it now.
+func (ctrl *CSIAttachController) RequeueAll(logger klog.Logger) {
+	vas, err := ctrl.vaLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list VolumeAttachments")
+	} else {
+		for _, va := range vas {
+			if va.Spec.Attacher == ctrl.attacherName {
+				ctrl.vaQueue.Add(va.Name)
+			}
+		}
+	}
+	pvs, err := ctrl.pvLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list PersistentVolumes")
+		return
+	}
+	for _, pv := range pvs {
+		if ctrl.processFinalizers(pv) {
+			ctrl.pvQueue.Add(pv.Name)
+		}
+	}
+}
+
+// SetShard limits reconciliation of the handler to VolumeAttachments of the
+// shard.
+func (h *csiHandler) SetShard(shard Shard) {
+	h.shard = shard
+}
+
+// ownsNode returns true when VolumeAttachments of the node belong to the
+// shard of this replica. It is always true when sharding is disabled.
+func (h *csiHandler) ownsNode(nodeName string) bool {
+	return h.shard == nil || h.shard.Owns(nodeName)
+}
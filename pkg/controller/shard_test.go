@@ -0,0 +1,147 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	storage "k8s.io/api/storage/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+// fakeShard is a Shard that owns the given keys.
+type fakeShard struct {
+	keys     []string
+	acquired int
+}
+
+func (s *fakeShard) Acquire(key string) bool {
+	if !s.Owns(key) {
+		return false
+	}
+	s.acquired++
+	return true
+}
+
+func (s *fakeShard) Release(key string) {
+	s.acquired--
+}
+
+func (s *fakeShard) Owns(key string) bool {
+	return slices.Contains(s.keys, key)
+}
+
+// syncHandler is a Handler that reports synced VolumeAttachments.
+type syncHandler struct {
+	Handler
+	synced []string
+}
+
+func (h *syncHandler) SyncNewOrUpdatedVolumeAttachment(ctx context.Context, va *storage.VolumeAttachment) {
+	h.synced = append(h.synced, va.Name)
+}
+
+func (h *syncHandler) SetShard(shard Shard) {}
+
+func newShardTestController(t *testing.T) (*CSIAttachController, *syncHandler) {
+	vaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, obj := range []*storage.VolumeAttachment{
+		createVolumeAttachment(testAttacherName, "pv1", "node1", false, "", nil),
+		createVolumeAttachment(testAttacherName, "pv1", "node2", false, "", nil),
+		createVolumeAttachment("other", "pv2", "node1", false, "", nil),
+	} {
+		if err := vaIndexer.Add(obj); err != nil {
+			t.Fatalf("Failed to add VolumeAttachment: %v", err)
+		}
+	}
+	pvIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := pvIndexer.Add(pv()); err != nil {
+		t.Fatalf("Failed to add PersistentVolume: %v", err)
+	}
+	if err := pvIndexer.Add(pvDeleted(pvWithName(pvWithFinalizer(), "pv2"))); err != nil {
+		t.Fatalf("Failed to add PersistentVolume: %v", err)
+	}
+	handler := &syncHandler{}
+	ctrl := &CSIAttachController{
+		attacherName: testAttacherName,
+		handler:      handler,
+		vaQueue:      workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		pvQueue:      workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		vaLister:     storagelisters.NewVolumeAttachmentLister(vaIndexer),
+		pvLister:     corelisters.NewPersistentVolumeLister(pvIndexer),
+	}
+	t.Cleanup(ctrl.vaQueue.ShutDown)
+	t.Cleanup(ctrl.pvQueue.ShutDown)
+	return ctrl, handler
+}
+
+func TestSyncVASkipsOtherShards(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	ctrl, handler := newShardTestController(t)
+	shard := &fakeShard{keys: []string{"node1"}}
+	ctrl.SetShard(shard)
+
+	ctrl.vaQueue.Add("pv1-node1")
+	ctrl.vaQueue.Add("pv1-node2")
+	ctrl.syncVA(ctx)
+	ctrl.syncVA(ctx)
+
+	if expected := []string{"pv1-node1"}; !reflect.DeepEqual(handler.synced, expected) {
+		t.Errorf("expected synced VolumeAttachments %v, got %v", expected, handler.synced)
+	}
+	if shard.acquired != 0 {
+		t.Errorf("expected all keys to be released, got %d acquired", shard.acquired)
+	}
+	if ctrl.vaQueue.Len() != 0 {
+		t.Errorf("expected skipped VolumeAttachment not to be queued again, got %d queued", ctrl.vaQueue.Len())
+	}
+}
+
+func TestRequeueAll(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	ctrl, _ := newShardTestController(t)
+
+	ctrl.RequeueAll(klog.FromContext(ctx))
+
+	var vas []string
+	for ctrl.vaQueue.Len() > 0 {
+		name, _ := ctrl.vaQueue.Get()
+		vas = append(vas, name)
+		ctrl.vaQueue.Done(name)
+	}
+	slices.Sort(vas)
+	if expected := []string{"pv1-node1", "pv1-node2"}; !reflect.DeepEqual(vas, expected) {
+		t.Errorf("expected queued VolumeAttachments %v, got %v", expected, vas)
+	}
+	var pvs []string
+	for ctrl.pvQueue.Len() > 0 {
+		name, _ := ctrl.pvQueue.Get()
+		pvs = append(pvs, name)
+		ctrl.pvQueue.Done(name)
+	}
+	if expected := []string{"pv2"}; !reflect.DeepEqual(pvs, expected) {
+		t.Errorf("expected queued PersistentVolumes %v, got %v", expected, pvs)
+	}
+}
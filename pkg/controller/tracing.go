@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans of the controller. It uses the global tracer provider,
+// the spans are not recorded unless tracing is enabled.
+var tracer = otel.Tracer("github.com/kubernetes-csi/external-attacher/v4/pkg/controller")
+
+// Span attributes.
+const (
+	attrVolumeAttachment = attribute.Key("k8s.volumeattachment.name")
+	attrPersistentVolume = attribute.Key("k8s.persistentvolume.name")
+	attrNode             = attribute.Key("k8s.node.name")
+	attrVolumeHandle     = attribute.Key("csi.volume_handle")
+	attrNodeID           = attribute.Key("csi.node_id")
+	attrSecret           = attribute.Key("k8s.secret.name")
+	attrSubresource      = attribute.Key("k8s.subresource")
+)
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span and records the error, if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
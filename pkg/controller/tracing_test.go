@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2/ktesting"
+)
+
+// spanRecorder is a span exporter that remembers exported spans.
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestAttachSpans(t *testing.T) {
+	recorder := &spanRecorder{}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(recorder)))
+
+	_, ctx := ktesting.NewTestContext(t)
+	pv := pvWithSecret(pv(), "secret")
+	attaching := va(false, "", nil)
+	client := fake.NewSimpleClientset(pv, attaching, secret())
+	informerFactory := informers.NewSharedInformerFactory(client, time.Hour)
+	if err := informerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer().Add(pv); err != nil {
+		t.Fatalf("Failed to add PV: %v", err)
+	}
+	if err := informerFactory.Storage().V1().CSINodes().Informer().GetIndexer().Add(csiNode()); err != nil {
+		t.Fatalf("Failed to add CSINode: %v", err)
+	}
+	calls := []csiCall{{"attach", testVolumeHandle, testNodeID, nil, map[string]string{"foo": "bar"}, false, nil, false, nil, 0}}
+	lister := &fakeLister{t: t, publishedNodes: map[string][]string{}}
+	csiConnection := &fakeCSIConnection{t: t, calls: calls, lister: lister}
+	h := csiHandlerFactory(client, record.NewFakeRecorder(100), informerFactory, csiConnection, lister).(*csiHandler)
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+	h.Init(queue, queue)
+
+	ctx, root := startSpan(ctx, "syncVA", attrVolumeAttachment.String(attaching.Name))
+	h.SyncNewOrUpdatedVolumeAttachment(ctx, attaching)
+	root.End()
+
+	if csiConnection.index != len(calls) {
+		t.Fatalf("expected %d CSI calls, got %d", len(calls), csiConnection.index)
+	}
+	var names []string
+	for _, span := range recorder.spans {
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is not in the trace of syncVA", span.Name())
+		}
+		names = append(names, span.Name())
+	}
+	expectedNames := []string{
+		"GetPersistentVolume",
+		"PatchPersistentVolume",
+		"GetSecret",
+		// Finalizer and node ID of the VolumeAttachment.
+		"PatchVolumeAttachment",
+		"Attach",
+		// Status of the VolumeAttachment.
+		"PatchVolumeAttachment",
+		"syncVA",
+	}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected spans %v, got %v", expectedNames, names)
+	}
+}
@@ -18,10 +18,13 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
@@ -32,14 +35,16 @@ import (
 // nothing to detach).
 type trivialHandler struct {
 	client           kubernetes.Interface
+	eventRecorder    record.EventRecorder
+	pvLister         corelisters.PersistentVolumeLister
 	vaQueue, pvQueue workqueue.TypedRateLimitingInterface[string]
 }
 
 var _ Handler = &trivialHandler{}
 
 // NewTrivialHandler provides new Handler for Volumeattachments and PV object handling.
-func NewTrivialHandler(client kubernetes.Interface) Handler {
-	return &trivialHandler{client: client}
+func NewTrivialHandler(client kubernetes.Interface, eventRecorder record.EventRecorder, pvLister corelisters.PersistentVolumeLister) Handler {
+	return &trivialHandler{client: client, eventRecorder: eventRecorder, pvLister: pvLister}
 }
 
 func (h *trivialHandler) Init(vaQueue workqueue.TypedRateLimitingInterface[string], pvQueue workqueue.TypedRateLimitingInterface[string]) {
@@ -47,6 +52,15 @@ func (h *trivialHandler) Init(vaQueue workqueue.TypedRateLimitingInterface[strin
 	h.pvQueue = pvQueue
 }
 
+func (h *trivialHandler) UpdateSettings(settings HandlerSettings) {
+	// The trivial handler does not have any settings.
+}
+
+func (h *trivialHandler) SetShard(shard Shard) {
+	// VolumeAttachments are sharded by the controller, the trivial handler
+	// does not reconcile them.
+}
+
 func (h *trivialHandler) ReconcileVA(ctx context.Context) error {
 	return nil
 }
@@ -63,6 +77,7 @@ func (h *trivialHandler) SyncNewOrUpdatedVolumeAttachment(ctx context.Context, v
 			return
 		}
 		logger.V(2).Info("Marked VolumeAttachment as attached")
+		recordVolumeEvent(h.eventRecorder, h.pvLister, va, v1.EventTypeNormal, reasonAttached, fmt.Sprintf("Volume %q attached to node %q", getVolumeName(va), va.Spec.NodeName))
 	}
 	h.vaQueue.Forget(va.Name)
 }
@@ -31,10 +31,11 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 )
 
-func trivialHandlerFactory(client kubernetes.Interface, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
-	return NewTrivialHandler(client)
+func trivialHandlerFactory(client kubernetes.Interface, recorder record.EventRecorder, informerFactory informers.SharedInformerFactory, csi attacher.Attacher, lister VolumeLister) Handler {
+	return NewTrivialHandler(client, recorder, informerFactory.Core().V1().PersistentVolumes().Lister())
 }
 
 func TestTrivialHandler(t *testing.T) {
@@ -54,6 +55,25 @@ func TestTrivialHandler(t *testing.T) {
 						va(false, "", nil),
 						va(true, "", nil)), "status"),
 			},
+			expectedEvents: []string{
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+			},
+		},
+		{
+			name:           "add -> events on VA, PV and PVC",
+			initialObjects: []runtime.Object{pvWithClaimRef(pv())},
+			addedVA:        va(false, "", nil),
+			expectedActions: []core.Action{
+				core.NewPatchSubresourceAction(vaGroupResourceVersion, metav1.NamespaceNone, testPVName+"-"+testNodeName,
+					types.MergePatchType, patch(
+						va(false, "", nil),
+						va(true, "", nil)), "status"),
+			},
+			expectedEvents: []string{
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+				`Normal Attached Volume "pv1" attached to node "node1"`,
+			},
 		},
 		{
 			name:      "update -> successful write",
@@ -32,6 +32,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
@@ -46,8 +49,10 @@ func markAsAttached(ctx context.Context, client kubernetes.Interface, va *storag
 	if err != nil {
 		return va, err
 	}
-	newVA, err := client.StorageV1().VolumeAttachments().Patch(ctx, va.Name, types.MergePatchType, patch,
+	patchCtx, span := startSpan(ctx, "PatchVolumeAttachment", attrVolumeAttachment.String(va.Name), attrSubresource.String("status"))
+	newVA, err := client.StorageV1().VolumeAttachments().Patch(patchCtx, va.Name, types.MergePatchType, patch,
 		metav1.PatchOptions{}, "status")
+	endSpan(span, err)
 	if err != nil {
 		return va, err
 	}
@@ -91,7 +96,9 @@ func markAsDetached(ctx context.Context, client kubernetes.Interface, va *storag
 		if err != nil {
 			return va, err
 		}
-		newVA, err := client.StorageV1().VolumeAttachments().Patch(ctx, va.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		patchCtx, span := startSpan(ctx, "PatchVolumeAttachment", attrVolumeAttachment.String(va.Name))
+		newVA, err := client.StorageV1().VolumeAttachments().Patch(patchCtx, va.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		endSpan(span, err)
 		if err != nil {
 			return va, err
 		}
@@ -108,7 +115,9 @@ func markAsDetached(ctx context.Context, client kubernetes.Interface, va *storag
 	if err != nil {
 		return va, err
 	}
-	newVA, err := client.StorageV1().VolumeAttachments().Patch(ctx, va.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	patchCtx, span := startSpan(ctx, "PatchVolumeAttachment", attrVolumeAttachment.String(va.Name), attrSubresource.String("status"))
+	newVA, err := client.StorageV1().VolumeAttachments().Patch(patchCtx, va.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	endSpan(span, err)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			// The VolumeAttachment does not have any finalizer, it might have been deleted by the API server.
@@ -122,8 +131,106 @@ func markAsDetached(ctx context.Context, client kubernetes.Interface, va *storag
 
 const (
 	vaNodeIDAnnotation = "csi.alpha.kubernetes.io/node-id"
+	// vaVolumeConditionAnnotation holds the message of an abnormal volume
+	// condition reported by the CSI driver.
+	vaVolumeConditionAnnotation = "csi.alpha.kubernetes.io/volume-condition"
+	// vaAttachErrorReasonAnnotation and vaDetachErrorReasonAnnotation hold
+	// ErrorReason of the last attach and detach error.
+	vaAttachErrorReasonAnnotation = "csi.alpha.kubernetes.io/attach-error-reason"
+	vaDetachErrorReasonAnnotation = "csi.alpha.kubernetes.io/detach-error-reason"
+	// vaDetachedAnnotation is set to "true" when all ControllerPublish
+	// calls of the VolumeAttachment failed with a final error, i.e. the
+	// volume was never attached and it does not need ControllerUnpublish.
+	// It is removed before each ControllerPublish call.
+	vaDetachedAnnotation = "csi.alpha.kubernetes.io/detached"
+	// vaAttachStoppedAnnotation is set when the attacher stopped attaching
+	// the VolumeAttachment after the maximum number of attempts. It holds a
+	// hash of the VolumeAttachment and PersistentVolume specs.
+	vaAttachStoppedAnnotation = "csi.alpha.kubernetes.io/attach-stopped"
+	// vaAttachRetryAnnotation can be set by the user to retry attaching of a
+	// stopped VolumeAttachment. The attacher removes it.
+	vaAttachRetryAnnotation = "csi.alpha.kubernetes.io/attach-retry"
 )
 
+// controllerAnnotations are VolumeAttachment annotations that only the
+// controller sets when it saves an attach or detach result. Their changes do
+// not need another sync.
+var controllerAnnotations = []string{
+	vaVolumeConditionAnnotation,
+	vaAttachErrorReasonAnnotation,
+	vaDetachErrorReasonAnnotation,
+	vaDetachedAnnotation,
+	vaAttachStoppedAnnotation,
+}
+
+// Reasons of events emitted on VolumeAttachments, PersistentVolumes and
+// PersistentVolumeClaims.
+const (
+	reasonAttaching     = "Attaching"
+	reasonAttached      = "Attached"
+	reasonAttachFailed  = "AttachFailed"
+	reasonAttachStopped = "AttachStopped"
+	reasonDetached      = "Detached"
+	reasonDetachFailed  = "DetachFailed"
+
+	reasonVolumeConditionAbnormal = "VolumeConditionAbnormal"
+	reasonVolumeConditionNormal   = "VolumeConditionNormal"
+
+	reasonOrphanedAttachment = "OrphanedAttachment"
+	reasonOrphanDetached     = "OrphanDetached"
+	reasonOrphanDetachFailed = "OrphanDetachFailed"
+)
+
+// recordVolumeEvent records an event on the VolumeAttachment and, if the
+// VolumeAttachment references a PersistentVolume, on the PersistentVolume and
+// the PersistentVolumeClaim bound to it.
+func recordVolumeEvent(eventRecorder record.EventRecorder, pvLister corelisters.PersistentVolumeLister, va *storage.VolumeAttachment, eventtype, reason, message string) {
+	eventRecorder.Event(va, eventtype, reason, message)
+	if va.Spec.Source.PersistentVolumeName == nil {
+		return
+	}
+	pv, err := pvLister.Get(*va.Spec.Source.PersistentVolumeName)
+	if err != nil {
+		// The PV may be already deleted, there is nothing to report the event on.
+		return
+	}
+	eventRecorder.Event(pv, eventtype, reason, message)
+	if pv.Spec.ClaimRef != nil {
+		eventRecorder.Event(pv.Spec.ClaimRef, eventtype, reason, message)
+	}
+}
+
+// getVolumeName returns name of the volume referenced by VolumeAttachment
+// suitable for events and log messages: either name of the PersistentVolume
+// or volume handle of an inline volume.
+func getVolumeName(va *storage.VolumeAttachment) string {
+	if va.Spec.Source.PersistentVolumeName != nil {
+		return *va.Spec.Source.PersistentVolumeName
+	}
+	if spec := va.Spec.Source.InlineVolumeSpec; spec != nil && spec.CSI != nil {
+		return spec.CSI.VolumeHandle
+	}
+	return ""
+}
+
+// listVAsByIndex returns VolumeAttachments from the informer indexer that
+// match given value of the index.
+func listVAsByIndex(indexer cache.Indexer, indexName, value string) ([]*storage.VolumeAttachment, error) {
+	objs, err := indexer.ByIndex(indexName, value)
+	if err != nil {
+		return nil, err
+	}
+	vas := make([]*storage.VolumeAttachment, 0, len(objs))
+	for _, obj := range objs {
+		va, ok := obj.(*storage.VolumeAttachment)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object in VolumeAttachment index: %T", obj)
+		}
+		vas = append(vas, va)
+	}
+	return vas, nil
+}
+
 // SanitizeDriverName sanitizes provided driver name.
 func SanitizeDriverName(driver string) string {
 	re := regexp.MustCompile("[^a-zA-Z0-9-]")
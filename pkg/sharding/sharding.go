@@ -0,0 +1,380 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sharding distributes VolumeAttachments among active replicas of
+// the external-attacher.
+//
+// Each replica holds its own Lease in the coordination.k8s.io API group and
+// renews it periodically. Replicas with a Lease renewed within its duration
+// are members of the group. The 32-bit FNV hash space of keys (node names) is
+// split into equal ranges, one per member, in the order of member
+// identities.
+//
+// When the members change, each replica stops taking new keys, waits until
+// keys it no longer owns are released and then acknowledges the new members
+// in an annotation of its Lease. A replica takes keys again only when all
+// members have acknowledged the same members, so a key is never processed
+// by two replicas at the same time. A replica that cannot renew its Lease
+// within the renew deadline stops taking keys, before the other replicas
+// consider its Lease expired. When it still processes some keys at that time,
+// it exits, the same way as a leader that lost its leader election, because
+// the processing may last longer than the rest of the lease duration.
+package sharding
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// groupLabel is the label of Leases of all replicas of a driver.
+	groupLabel = "csi.alpha.kubernetes.io/attacher-shard-group"
+	// membersAnnotation is the annotation of a Lease with the members
+	// acknowledged by the replica.
+	membersAnnotation = "csi.alpha.kubernetes.io/attacher-shard-members"
+	// leaseGCFactor is the number of lease durations after which Leases of
+	// replicas that are gone are deleted.
+	leaseGCFactor = 10
+)
+
+// Config are options of a Sharder.
+type Config struct {
+	// Namespace of the Leases.
+	Namespace string
+	// Group is the name of the group of replicas, unique for the driver.
+	// It must be a valid label value.
+	Group string
+	// Identity of this replica, unique in the group.
+	Identity string
+	// LeaseDuration is the time after which a Lease that was not renewed
+	// is considered expired.
+	LeaseDuration time.Duration
+	// RenewDeadline is the time after which a replica that could not renew
+	// its Lease stops processing. It must be shorter than LeaseDuration.
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval of Lease renewals.
+	RetryPeriod time.Duration
+}
+
+// observedLease is when a Lease of a member was seen renewed. Time of the
+// local clock is used, so clocks of replicas do not need to be in sync.
+type observedLease struct {
+	renewTime metav1.MicroTime
+	observed  time.Time
+}
+
+// Sharder is a shard of a replica of the external-attacher.
+type Sharder struct {
+	client   kubernetes.Interface
+	config   Config
+	onChange func()
+	clock    func() time.Time
+	// exit ends the process.
+	exit func()
+
+	// observed are Leases of the group by identity. Used only by Run.
+	observed map[string]observedLease
+	// deadline fires when the Lease was not renewed within the renew
+	// deadline. Used only by Run.
+	deadline *time.Timer
+
+	mutex sync.Mutex
+	// members are identities of the members, sorted.
+	members []string
+	// acked is the hash of members acknowledged in the Lease of this
+	// replica.
+	acked string
+	// active is true when all members acknowledged the members.
+	active bool
+	// renewed is the last time the Lease of this replica was renewed.
+	renewed time.Time
+	// acquired is the number of acquired keys.
+	acquired map[string]int
+}
+
+// NewSharder returns a new Sharder. onChange is called when the replica
+// starts processing its shard after the members changed.
+func NewSharder(client kubernetes.Interface, config Config, onChange func()) (*Sharder, error) {
+	if config.Group == "" || config.Identity == "" {
+		return nil, fmt.Errorf("group and identity of the shard must be set")
+	}
+	if config.RenewDeadline >= config.LeaseDuration {
+		return nil, fmt.Errorf("renew deadline %s must be shorter than lease duration %s", config.RenewDeadline, config.LeaseDuration)
+	}
+	if config.RetryPeriod <= 0 || config.RetryPeriod >= config.RenewDeadline {
+		return nil, fmt.Errorf("retry period %s must be positive and shorter than renew deadline %s", config.RetryPeriod, config.RenewDeadline)
+	}
+	return &Sharder{
+		client:   client,
+		config:   config,
+		onChange: onChange,
+		clock:    time.Now,
+		exit:     func() { klog.FlushAndExit(klog.ExitFlushTimeout, 1) },
+		observed: map[string]observedLease{},
+		acquired: map[string]int{},
+	}, nil
+}
+
+// Run renews the Lease of the replica and follows the members until ctx is
+// done. The Lease is left to expire, keys that are being processed while the
+// replica shuts down are not handed over before that.
+func (s *Sharder) Run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	s.deadline = time.AfterFunc(s.config.RenewDeadline, func() { s.renewDeadlineMissed(logger) })
+	defer s.deadline.Stop()
+	wait.UntilWithContext(ctx, s.sync, s.config.RetryPeriod)
+}
+
+// Acquire returns true when the key belongs to the shard of the replica.
+func (s *Sharder) Acquire(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ownsLocked(key) {
+		return false
+	}
+	s.acquired[key]++
+	return true
+}
+
+// Release releases a key returned by Acquire.
+func (s *Sharder) Release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.acquired[key]--
+	if s.acquired[key] <= 0 {
+		delete(s.acquired, key)
+	}
+}
+
+// Owns returns true when the key belongs to the shard of the replica.
+func (s *Sharder) Owns(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ownsLocked(key)
+}
+
+func (s *Sharder) ownsLocked(key string) bool {
+	if !s.active || s.clock().Sub(s.renewed) >= s.config.RenewDeadline {
+		return false
+	}
+	return owner(s.members, key) == s.config.Identity
+}
+
+// owner returns the member that owns the key. Members own equal ranges of
+// the hash space of keys.
+func owner(members []string, key string) string {
+	if len(members) == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return members[uint64(h.Sum32())*uint64(len(members))>>32]
+}
+
+// membersHash returns a hash of sorted members, acknowledged in Leases.
+func membersHash(members []string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(members, "\n")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Sharder) leaseName() string {
+	return "external-attacher-shard-" + s.config.Group + "-" + s.config.Identity
+}
+
+// sync renews the Lease of the replica, finds the current members and
+// acknowledges them when the replica released all keys it no longer owns.
+func (s *Sharder) sync(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	leases, err := s.client.CoordinationV1().Leases(s.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{groupLabel: s.config.Group}.String(),
+	})
+	if err != nil {
+		logger.Error(err, "Failed to list shard Leases")
+		s.checkRenewDeadline(logger)
+		return
+	}
+
+	now := s.clock()
+	members := []string{s.config.Identity}
+	acks := map[string]string{}
+	var own *coordinationv1.Lease
+	seen := map[string]bool{}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		identity := ptr.Deref(lease.Spec.HolderIdentity, "")
+		if identity == s.config.Identity {
+			own = lease
+			continue
+		}
+		if identity == "" || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		seen[identity] = true
+		observed, found := s.observed[identity]
+		if !found || !observed.renewTime.Equal(lease.Spec.RenewTime) {
+			observed = observedLease{renewTime: *lease.Spec.RenewTime, observed: now}
+			s.observed[identity] = observed
+		}
+		duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		expired := now.Sub(observed.observed)
+		switch {
+		case expired < duration:
+			members = append(members, identity)
+			acks[identity] = lease.Annotations[membersAnnotation]
+		case expired >= leaseGCFactor*duration:
+			logger.V(2).Info("Deleting expired shard Lease", "lease", lease.Name, "identity", identity)
+			err := s.client.CoordinationV1().Leases(s.config.Namespace).Delete(ctx, lease.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+			})
+			if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				logger.Error(err, "Failed to delete expired shard Lease", "lease", lease.Name)
+			}
+		}
+	}
+	for identity := range s.observed {
+		if !seen[identity] {
+			delete(s.observed, identity)
+		}
+	}
+	slices.Sort(members)
+	hash := membersHash(members)
+
+	s.mutex.Lock()
+	if !slices.Equal(s.members, members) {
+		logger.Info("Shard members changed, waiting for all members to acknowledge them", "members", members)
+		s.members = members
+		s.active = false
+	}
+	ack := s.acked
+	if s.releasedLocked() {
+		ack = hash
+	}
+	s.mutex.Unlock()
+
+	if err := s.renew(ctx, own, ack); err != nil {
+		logger.Error(err, "Failed to renew shard Lease")
+		s.checkRenewDeadline(logger)
+		return
+	}
+
+	active := ack == hash
+	for _, identity := range members {
+		if identity != s.config.Identity && acks[identity] != hash {
+			active = false
+		}
+	}
+	if s.deadline != nil {
+		s.deadline.Reset(s.config.RenewDeadline - s.clock().Sub(now))
+	}
+	s.mutex.Lock()
+	s.acked = ack
+	s.renewed = now
+	activated := active && !s.active
+	s.active = active
+	s.mutex.Unlock()
+	if activated {
+		logger.Info("Processing shard", "members", members, "identity", s.config.Identity)
+		s.onChange()
+	}
+}
+
+// releasedLocked returns true when no key owned by another member is
+// acquired.
+func (s *Sharder) releasedLocked() bool {
+	for key := range s.acquired {
+		if owner(s.members, key) != s.config.Identity {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRenewDeadline stops processing when the Lease was not renewed within
+// the renew deadline.
+func (s *Sharder) checkRenewDeadline(logger klog.Logger) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.active && s.clock().Sub(s.renewed) >= s.config.RenewDeadline {
+		logger.Error(nil, "Shard Lease was not renewed within the renew deadline, stopped processing")
+		s.active = false
+	}
+}
+
+// renewDeadlineMissed stops processing when the Lease was not renewed within
+// the renew deadline, even when a renewal hangs. Keys that are being processed
+// cannot be stopped, so the process exits before other replicas take them
+// over.
+func (s *Sharder) renewDeadlineMissed(logger klog.Logger) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.active {
+		logger.Error(nil, "Shard Lease was not renewed within the renew deadline, stopped processing")
+		s.active = false
+	}
+	if len(s.acquired) > 0 {
+		logger.Error(nil, "Shard Lease was not renewed within the renew deadline while processing keys, exiting", "keys", len(s.acquired))
+		s.exit()
+	}
+}
+
+// renew creates or updates the Lease of the replica with the acknowledged
+// members.
+func (s *Sharder) renew(ctx context.Context, lease *coordinationv1.Lease, ack string) error {
+	now := metav1.NewMicroTime(s.clock())
+	if lease == nil {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.leaseName(),
+				Namespace: s.config.Namespace,
+				Labels:    map[string]string{groupLabel: s.config.Group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(s.config.Identity),
+				LeaseDurationSeconds: ptr.To(int32(s.config.LeaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		lease.Annotations = map[string]string{membersAnnotation: ack}
+		_, err := s.client.CoordinationV1().Leases(s.config.Namespace).Create(ctx, lease, metav1.CreateOptions{})
+		return err
+	}
+	lease = lease.DeepCopy()
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[membersAnnotation] = ack
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(s.config.LeaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+	_, err := s.client.CoordinationV1().Leases(s.config.Namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2/ktesting"
+)
+
+// testCluster are replicas with a shared fake clock.
+type testCluster struct {
+	t       *testing.T
+	ctx     context.Context
+	client  kubernetes.Interface
+	now     time.Time
+	changes map[string]int
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	_, ctx := ktesting.NewTestContext(t)
+	return &testCluster{
+		t:       t,
+		ctx:     ctx,
+		client:  fake.NewSimpleClientset(),
+		now:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		changes: map[string]int{},
+	}
+}
+
+func (c *testCluster) newSharder(identity string) *Sharder {
+	s, err := NewSharder(c.client, Config{
+		Namespace:     "default",
+		Group:         "csi-test",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}, func() { c.changes[identity]++ })
+	if err != nil {
+		c.t.Fatalf("Failed to create sharder: %v", err)
+	}
+	s.clock = func() time.Time { return c.now }
+	return s
+}
+
+// tick advances the clock by the retry period and syncs the replicas one by
+// one.
+func (c *testCluster) tick(sharders ...*Sharder) {
+	c.now = c.now.Add(2 * time.Second)
+	for _, s := range sharders {
+		s.sync(c.ctx)
+	}
+}
+
+// nodes returns test node names.
+func nodes() []string {
+	var names []string
+	for i := 0; i < 100; i++ {
+		names = append(names, fmt.Sprintf("node-%d", i))
+	}
+	return names
+}
+
+// nodeOf returns a node owned by the identity when the members are active.
+func nodeOf(t *testing.T, members []string, identity string) string {
+	for _, node := range nodes() {
+		if owner(members, node) == identity {
+			return node
+		}
+	}
+	t.Fatalf("No node is owned by %s", identity)
+	return ""
+}
+
+// checkOwners checks that each node is owned by exactly one of the sharders.
+func checkOwners(t *testing.T, sharders ...*Sharder) {
+	t.Helper()
+	counts := map[string]int{}
+	for _, node := range nodes() {
+		owners := 0
+		for _, s := range sharders {
+			if s.Owns(node) {
+				owners++
+				counts[s.config.Identity]++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("expected node %s to have one owner, got %d", node, owners)
+		}
+	}
+	for _, s := range sharders {
+		if counts[s.config.Identity] == 0 {
+			t.Errorf("expected %s to own some nodes", s.config.Identity)
+		}
+	}
+}
+
+// checkNoOwner checks that no node is owned by any of the sharders.
+func checkNoOwner(t *testing.T, sharders ...*Sharder) {
+	t.Helper()
+	for _, node := range nodes() {
+		for _, s := range sharders {
+			if s.Owns(node) {
+				t.Errorf("expected node %s not to be owned by %s", node, s.config.Identity)
+			}
+		}
+	}
+}
+
+func TestNewSharder(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{
+			name:   "valid",
+			config: Config{Group: "g", Identity: "a", LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 2 * time.Second},
+		},
+		{
+			name:        "missing identity",
+			config:      Config{Group: "g", LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 2 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "renew deadline longer than lease duration",
+			config:      Config{Group: "g", Identity: "a", LeaseDuration: 10 * time.Second, RenewDeadline: 15 * time.Second, RetryPeriod: 2 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "retry period longer than renew deadline",
+			config:      Config{Group: "g", Identity: "a", LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 10 * time.Second},
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewSharder(fake.NewSimpleClientset(), test.config, func() {})
+			if test.expectError != (err != nil) {
+				t.Errorf("expected error: %v, got %v", test.expectError, err)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	c := newTestCluster(t)
+	a := c.newSharder("a")
+	b := c.newSharder("b")
+
+	c.tick(a)
+	checkOwners(t, a)
+	if c.changes["a"] != 1 {
+		t.Errorf("expected a to be notified once, got %d", c.changes["a"])
+	}
+
+	// b acknowledges the members, but starts processing only when a
+	// acknowledged them too.
+	c.tick(b)
+	checkNoOwner(t, b)
+	if !a.Owns(nodeOf(t, []string{"a", "b"}, "b")) {
+		t.Errorf("expected a to own all nodes until it sees b")
+	}
+	c.tick(a)
+	checkNoOwner(t, b)
+	c.tick(b)
+	checkOwners(t, a, b)
+	if c.changes["a"] != 2 || c.changes["b"] != 1 {
+		t.Errorf("expected a to be notified twice and b once, got %v", c.changes)
+	}
+}
+
+func TestHandOverAcquiredKey(t *testing.T) {
+	c := newTestCluster(t)
+	a := c.newSharder("a")
+	b := c.newSharder("b")
+	c.tick(a)
+
+	node := nodeOf(t, []string{"a", "b"}, "b")
+	if !a.Acquire(node) {
+		t.Fatalf("expected a to acquire %s", node)
+	}
+
+	// a does not acknowledge b while it processes a node of b.
+	for i := 0; i < 3; i++ {
+		c.tick(b, a)
+	}
+	checkNoOwner(t, a, b)
+	if b.Acquire(node) {
+		t.Fatalf("expected b not to acquire %s while a processes it", node)
+	}
+
+	a.Release(node)
+	c.tick(a, b, a)
+	checkOwners(t, a, b)
+	if !b.Acquire(node) {
+		t.Errorf("expected b to acquire %s", node)
+	}
+}
+
+func TestLeave(t *testing.T) {
+	c := newTestCluster(t)
+	a := c.newSharder("a")
+	b := c.newSharder("b")
+	c.tick(a, b, a, b)
+	checkOwners(t, a, b)
+
+	// b is gone, a takes over its nodes when its Lease expires after the
+	// lease duration.
+	node := nodeOf(t, []string{"a", "b"}, "b")
+	for i := 0; i < 7; i++ {
+		c.tick(a)
+		if a.Owns(node) {
+			t.Fatalf("expected a not to own %s before the Lease of b expires", node)
+		}
+	}
+	c.tick(a)
+	for _, node := range nodes() {
+		if !a.Owns(node) {
+			t.Errorf("expected a to own %s", node)
+		}
+	}
+}
+
+func TestRenewDeadline(t *testing.T) {
+	c := newTestCluster(t)
+	a := c.newSharder("a")
+	c.tick(a)
+	checkOwners(t, a)
+
+	// a stops processing when it cannot renew its Lease.
+	c.now = c.now.Add(10 * time.Second)
+	checkNoOwner(t, a)
+}
+
+func TestRenewDeadlineExit(t *testing.T) {
+	tests := []struct {
+		name       string
+		acquire    bool
+		expectExit bool
+	}{
+		{
+			name:       "no key acquired -> stops processing",
+			acquire:    false,
+			expectExit: false,
+		},
+		{
+			name:       "key acquired -> exits",
+			acquire:    true,
+			expectExit: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			client := fake.NewSimpleClientset()
+			// The Lease is created, but it cannot be renewed.
+			client.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("mock error")
+			})
+			s, err := NewSharder(client, Config{
+				Namespace:     "default",
+				Group:         "csi-test",
+				Identity:      "a",
+				LeaseDuration: 300 * time.Millisecond,
+				RenewDeadline: 200 * time.Millisecond,
+				RetryPeriod:   50 * time.Millisecond,
+			}, func() {})
+			if err != nil {
+				t.Fatalf("Failed to create sharder: %v", err)
+			}
+			exited := make(chan struct{})
+			s.exit = func() { close(exited) }
+			acquired := make(chan bool)
+			s.onChange = func() {
+				if test.acquire {
+					acquired <- s.Acquire("node")
+				}
+			}
+			go s.Run(ctx)
+
+			if test.acquire && !<-acquired {
+				t.Fatalf("expected the key to be acquired")
+			}
+			select {
+			case <-exited:
+				if !test.expectExit {
+					t.Errorf("expected no exit")
+				}
+			case <-time.After(time.Second):
+				if test.expectExit {
+					t.Errorf("expected exit after the renew deadline")
+				}
+			}
+			if s.Owns("node") {
+				t.Errorf("expected the replica to stop processing")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fileSpan is a span as written by the file exporter, one JSON object per
+// line.
+type fileSpan struct {
+	TraceID      string            `json:"traceID"`
+	SpanID       string            `json:"spanID"`
+	ParentSpanID string            `json:"parentSpanID,omitempty"`
+	Name         string            `json:"name"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// FileExporter is a span exporter that writes spans to a file as JSON lines,
+// for offline analysis without a tracing backend.
+type FileExporter struct {
+	mutex sync.Mutex
+	w     io.WriteCloser
+	enc   *json.Encoder
+}
+
+var _ sdktrace.SpanExporter = &FileExporter{}
+
+// NewFileExporter returns a span exporter that writes to w. w is closed on
+// Shutdown.
+func NewFileExporter(w io.WriteCloser) *FileExporter {
+	return &FileExporter{w: w, enc: json.NewEncoder(w)}
+}
+
+// ExportSpans writes spans to the file.
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.w == nil {
+		return nil
+	}
+	for _, span := range spans {
+		if err := e.enc.Encode(toFileSpan(span)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown closes the file.
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.w == nil {
+		return nil
+	}
+	err := e.w.Close()
+	e.w = nil
+	return err
+}
+
+func toFileSpan(span sdktrace.ReadOnlySpan) fileSpan {
+	s := fileSpan{
+		TraceID: span.SpanContext().TraceID().String(),
+		SpanID:  span.SpanContext().SpanID().String(),
+		Name:    span.Name(),
+		Kind:    span.SpanKind().String(),
+		Start:   span.StartTime(),
+		End:     span.EndTime(),
+		Status:  span.Status().Code.String(),
+		Error:   span.Status().Description,
+	}
+	if span.Parent().IsValid() {
+		s.ParentSpanID = span.Parent().SpanID().String()
+	}
+	if attrs := span.Attributes(); len(attrs) > 0 {
+		s.Attributes = make(map[string]string, len(attrs))
+		for _, attr := range attrs {
+			s.Attributes[string(attr.Key)] = attr.Value.Emit()
+		}
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing sets up OpenTelemetry tracing of the external-attacher.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Supported exporters.
+const (
+	// ExporterOTLP sends spans to an OTLP gRPC endpoint.
+	ExporterOTLP = "otlp"
+	// ExporterFile writes spans to a local file as JSON lines.
+	ExporterFile = "file"
+)
+
+// serviceName is the name of the service in exported spans.
+const serviceName = "csi-attacher"
+
+// Options are options of tracing.
+type Options struct {
+	// Exporter is ExporterOTLP or ExporterFile.
+	Exporter string
+	// Endpoint is the OTLP gRPC endpoint. When empty, the endpoint is
+	// taken from OTEL_EXPORTER_OTLP_ENDPOINT environment variable or the
+	// default localhost:4317 is used.
+	Endpoint string
+	// Insecure disables TLS of the connection to the OTLP endpoint. When
+	// false, TLS is used unless OTEL_EXPORTER_OTLP_INSECURE or
+	// OTEL_EXPORTER_OTLP_TRACES_INSECURE environment variable disables it.
+	Insecure bool
+	// File is the path of the file for ExporterFile. Spans are appended to
+	// the file.
+	File string
+	// SamplingRatio is the ratio of traces to record, from 0 to 1.
+	SamplingRatio float64
+}
+
+// Validate checks that the options are valid.
+func (o *Options) Validate() error {
+	switch o.Exporter {
+	case ExporterOTLP:
+	case ExporterFile:
+		if o.File == "" {
+			return fmt.Errorf("tracing file must be set for the %s exporter", ExporterFile)
+		}
+		if o.Insecure {
+			return fmt.Errorf("insecure tracing can be set only for the %s exporter", ExporterOTLP)
+		}
+	default:
+		return fmt.Errorf("unknown tracing exporter %q, expected %s or %s", o.Exporter, ExporterOTLP, ExporterFile)
+	}
+	if o.SamplingRatio < 0 || o.SamplingRatio > 1 {
+		return fmt.Errorf("tracing sampling ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Setup creates a tracer provider with the exporter of the options and
+// installs it as the global OpenTelemetry tracer provider, together with
+// W3C trace context propagation, so gRPC calls instrumented by
+// connection.WithOtelTracing carry the trace context to the CSI driver. The
+// returned function flushes remaining spans and stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	var processor sdktrace.SpanProcessor
+	switch opts.Exporter {
+	case ExporterOTLP:
+		var exporterOpts []otlptracegrpc.Option
+		if opts.Endpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case ExporterFile:
+		f, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tracing file: %w", err)
+		}
+		// Write each span when it ends, so no span is lost when the
+		// process exits.
+		processor = sdktrace.NewSimpleSpanProcessor(NewFileExporter(f))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SamplingRatio))),
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
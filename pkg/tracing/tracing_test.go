@@ -0,0 +1,143 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		expectError bool
+	}{
+		{
+			name: "otlp",
+			opts: Options{Exporter: ExporterOTLP, SamplingRatio: 1},
+		},
+		{
+			name: "file",
+			opts: Options{Exporter: ExporterFile, File: "/tmp/spans", SamplingRatio: 0.5},
+		},
+		{
+			name:        "file without path",
+			opts:        Options{Exporter: ExporterFile, SamplingRatio: 1},
+			expectError: true,
+		},
+		{
+			name: "insecure otlp",
+			opts: Options{Exporter: ExporterOTLP, Insecure: true, SamplingRatio: 1},
+		},
+		{
+			name:        "insecure file",
+			opts:        Options{Exporter: ExporterFile, File: "/tmp/spans", Insecure: true, SamplingRatio: 1},
+			expectError: true,
+		},
+		{
+			name:        "unknown exporter",
+			opts:        Options{Exporter: "jaeger", SamplingRatio: 1},
+			expectError: true,
+		},
+		{
+			name:        "invalid sampling ratio",
+			opts:        Options{Exporter: ExporterOTLP, SamplingRatio: 2},
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.opts.Validate()
+			if test.expectError && err == nil {
+				t.Errorf("expected error, got none")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(ctx, Options{Exporter: ExporterFile, File: path, SamplingRatio: 1})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	tracer := otel.Tracer("test")
+	ctx, parent := tracer.Start(ctx, "syncVA")
+	parent.SetAttributes(attribute.String("volumeattachment", "va1"))
+	_, child := tracer.Start(ctx, "ControllerPublishVolume")
+	child.SetStatus(codes.Error, "mock error")
+	child.End()
+	parent.End()
+
+	// The trace context is propagated to the driver.
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if carrier.Get("traceparent") == "" {
+		t.Errorf("expected traceparent to be propagated, got %v", carrier)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open spans: %v", err)
+	}
+	defer f.Close()
+	var spans []fileSpan
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s fileSpan
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatalf("Failed to parse span %q: %v", scanner.Text(), err)
+		}
+		spans = append(spans, s)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	if gotChild.Name != "ControllerPublishVolume" || gotParent.Name != "syncVA" {
+		t.Errorf("unexpected span names %q, %q", gotChild.Name, gotParent.Name)
+	}
+	if gotChild.TraceID != gotParent.TraceID || gotChild.ParentSpanID != gotParent.SpanID {
+		t.Errorf("expected ControllerPublishVolume to be a child of syncVA, got %+v and %+v", gotChild, gotParent)
+	}
+	if gotChild.Status != "Error" || gotChild.Error != "mock error" {
+		t.Errorf("expected error status, got %q: %q", gotChild.Status, gotChild.Error)
+	}
+	if gotParent.Attributes["volumeattachment"] != "va1" {
+		t.Errorf("expected volumeattachment attribute, got %v", gotParent.Attributes)
+	}
+}